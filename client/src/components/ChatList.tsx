@@ -1,5 +1,5 @@
 import { useEffect, useState } from 'react';
-import { Chat, User } from '../types';
+import { Chat, User, getPeer } from '../types';
 import { chatAPI } from '../api/client';
 import LoadingSpinner from './LoadingSpinner';
 
@@ -34,8 +34,12 @@ const ChatList = ({ currentUser, selectedChat, onChatSelect }: ChatListProps) =>
     }
   };
 
-  const getOtherUser = (chat: Chat) => {
-    return chat.user1.id === currentUser.id ? chat.user2 : chat.user1;
+  // Group chats are displayed with their own title and avatar
+  const getOtherUser = (chat: Chat): User => {
+    if (chat.type === 'group') {
+      return { id: chat.id, display_name: chat.title || 'Group', username: '', avatar_url: chat.avatar_url } as User;
+    }
+    return getPeer(chat, currentUser.id) as User;
   };
 
   const formatLastSeen = (lastSeen: string) => {
@@ -1,6 +1,7 @@
 import { useState, KeyboardEvent } from 'react';
 import { chatAPI, e2eeAPI } from '../api/client';
 import { encryptForBundle } from '../crypto/e2ee';
+import { getPeer } from '../types';
 
 interface MessageInputProps {
   chatId: string | null;
@@ -25,9 +26,9 @@ const MessageInput = ({ chatId, onMessageSent }: MessageInputProps) => {
           const chatRes = await chatAPI.getChat(chatId);
           if (chatRes?.success && chatRes?.data) {
             const chat = chatRes.data;
-            const peerUserId = chat.user1.id === currentUserId ? chat.user2.id : chat.user1.id;
+            const peerUserId = getPeer(chat, currentUserId)?.id;
             
-            const prekeyRes = await e2eeAPI.fetchPreKeyBundle(peerUserId);
+            const prekeyRes = peerUserId ? await e2eeAPI.fetchPreKeyBundle(peerUserId) : null;
             if (prekeyRes?.success && prekeyRes?.data) {
               const enc = await encryptForBundle(prekeyRes.data, message.trim());
               response = await chatAPI.sendEncryptedMessage({
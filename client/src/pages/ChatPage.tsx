@@ -3,7 +3,7 @@ import { useAuth } from '../hooks/useAuth';
 import ChatList from '../components/ChatList';
 import MessageList from '../components/MessageList';
 import MessageInput from '../components/MessageInput';
-import { Chat, User } from '../types';
+import { Chat, User, getPeer } from '../types';
 import { chatAPI } from '../api/client';
 
 const ChatPage = () => {
@@ -244,7 +244,7 @@ const ChatPage = () => {
                   <div className="flex items-center justify-between">
                     <div className="flex items-center space-x-3">
                       <h2 className="text-lg font-semibold text-gray-900">
-                        {selectedChat.user1.id === user.id ? selectedChat.user2.display_name : selectedChat.user1.display_name}
+                        {selectedChat.type === 'group' ? selectedChat.title : getPeer(selectedChat, user.id)?.display_name}
                       </h2>
                       <span 
                         className="text-sm text-green-600"
@@ -254,7 +254,9 @@ const ChatPage = () => {
                       </span>
                     </div>
                     <div className="text-sm text-gray-500">
-                      @{selectedChat.user1.id === user.id ? selectedChat.user2.username : selectedChat.user1.username}
+                      {selectedChat.type === 'group'
+                        ? `${selectedChat.members.length} members`
+                        : `@${getPeer(selectedChat, user.id)?.username}`}
                     </div>
                   </div>
                 </div>
@@ -21,16 +21,52 @@ export interface Message {
   nonce?: string;
   alg?: string;
   ephemeral_pub?: string;
+  attachments?: Attachment[];
+}
+
+export interface Attachment {
+  id: string;
+  chat_id: string;
+  uploader_id: string;
+  message_id?: string;
+  file_name: string;
+  content_type: string;
+  size: number;
+  width?: number;
+  height?: number;
+  encrypted: boolean;
+  key_metadata?: string;
+  status: 'uploading' | 'ready';
+  uploaded_size: number;
+  created_at: string;
+  // Signed, short-lived download links
+  url?: string;
+  thumbnail_url?: string;
+}
+
+export interface ChatMember {
+  id: string;
+  chat_id: string;
+  user_id: string;
+  role: 'owner' | 'admin' | 'member';
+  joined_at: string;
+  user: User;
 }
 
 export interface Chat {
   id: string;
-  user1: User;
-  user2: User;
+  type: 'direct' | 'group';
+  title?: string;
+  avatar_url?: string;
+  members: ChatMember[];
   created_at: string;
   updated_at: string;
 }
 
+// Returns the other participant of a direct chat.
+export const getPeer = (chat: Chat, currentUserId: string): User | undefined =>
+  chat.members.find((m) => m.user_id !== currentUserId)?.user;
+
 export interface AuthResponse {
   success: boolean;
   data: {
@@ -13,9 +13,9 @@ export class WebSocketClient {
     private onDisconnect?: () => void
   ) {}
 
-  connect(userId: number) {
+  connect(token: string) {
     try {
-      this.ws = new WebSocket(`${this.url}?user_id=${userId}`);
+      this.ws = new WebSocket(`${this.url}?token=${encodeURIComponent(token)}`);
       
       this.ws.onopen = () => {
         console.log('WebSocket connected');
@@ -53,11 +53,10 @@ export class WebSocketClient {
       console.log(`Reconnecting... Attempt ${this.reconnectAttempts}`);
       
       setTimeout(() => {
-        // Caller should re-supply a valid userId on next connect; keep it simple for now
-        // In production, inject a function to read current userId from auth state
-        const userId = Number(localStorage.getItem('user_id') || '0');
-        if (userId > 0) {
-          this.connect(userId);
+        // Re-read the access token: it may have been refreshed while we were disconnected
+        const token = localStorage.getItem('access_token');
+        if (token) {
+          this.connect(token);
         }
       }, this.reconnectDelay * this.reconnectAttempts);
     } else {
@@ -3,6 +3,8 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -15,6 +17,21 @@ type Config struct {
 	DBName     string
 	JWTSecret  string
 	ServerPort string
+	// How long after sending a message its author may edit it or delete it
+	// for everyone. Zero disables the limit.
+	MessageEditWindow time.Duration
+
+	// Attachment storage: 'local' keeps files under StorageDir, 's3' uses an
+	// S3-compatible bucket (AWS, MinIO, ...)
+	StorageBackend string
+	StorageDir     string
+	S3Endpoint     string
+	S3Region       string
+	S3Bucket       string
+	S3AccessKey    string
+	S3SecretKey    string
+	// Maximum attachment size in bytes
+	MaxUploadSize int64
 }
 
 var AppConfig *Config
@@ -26,13 +43,22 @@ func LoadConfig() {
 	}
 
 	AppConfig = &Config{
-		DBHost:     getEnv("DB_HOST", "localhost"),
-		DBPort:     getEnv("DB_PORT", "5432"),
-		DBUser:     getEnv("DB_USER", "postgres"),
-		DBPassword: getEnv("DB_PASSWORD", "password"),
-		DBName:     getEnv("DB_NAME", "tether_messenger"),
-		JWTSecret:  getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-this-in-production"),
-		ServerPort: getEnv("SERVER_PORT", "8081"),
+		DBHost:            getEnv("DB_HOST", "localhost"),
+		DBPort:            getEnv("DB_PORT", "5432"),
+		DBUser:            getEnv("DB_USER", "postgres"),
+		DBPassword:        getEnv("DB_PASSWORD", "password"),
+		DBName:            getEnv("DB_NAME", "tether_messenger"),
+		JWTSecret:         getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-this-in-production"),
+		ServerPort:        getEnv("SERVER_PORT", "8081"),
+		MessageEditWindow: getEnvDuration("MESSAGE_EDIT_WINDOW", 48*time.Hour),
+		StorageBackend:    getEnv("STORAGE_BACKEND", "local"),
+		StorageDir:        getEnv("STORAGE_DIR", "./data/attachments"),
+		S3Endpoint:        getEnv("S3_ENDPOINT", "http://localhost:9000"),
+		S3Region:          getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:          getEnv("S3_BUCKET", "tether-attachments"),
+		S3AccessKey:       getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:       getEnv("S3_SECRET_KEY", ""),
+		MaxUploadSize:     getEnvInt64("MAX_UPLOAD_SIZE", 25<<20),
 	}
 }
 
@@ -42,3 +68,29 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt64(key string, defaultValue int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return d
+}
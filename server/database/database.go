@@ -3,9 +3,12 @@ package database
 import (
 	"fmt"
 	"log"
+	"strings"
 	"tether-server/config"
 	"tether-server/models"
+	"tether-server/utils"
 
+	"github.com/google/uuid"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -26,39 +29,374 @@ func ConnectDB() {
 		log.Fatal("Failed to connect to database. \n", err)
 	}
 
-	// Force drop all tables and recreate
-	log.Println("Dropping all existing tables...")
-	db.Exec("DROP TABLE IF EXISTS messages CASCADE")
-	db.Exec("DROP TABLE IF EXISTS chats CASCADE")
+	// Leftovers of the integer-id schema. Current tables are kept and
+	// upgraded in place by AutoMigrate and the migrations below.
 	db.Exec("DROP TABLE IF EXISTS verification_codes CASCADE")
-	db.Exec("DROP TABLE IF EXISTS users CASCADE")
-
-	// Also drop any sequences that might exist
 	db.Exec("DROP SEQUENCE IF EXISTS users_id_seq CASCADE")
 	db.Exec("DROP SEQUENCE IF EXISTS chats_id_seq CASCADE")
 	db.Exec("DROP SEQUENCE IF EXISTS messages_id_seq CASCADE")
 
-	log.Println("Creating new UUID-based structure...")
+	// Status history starts with the table; older cards get theirs rebuilt
+	// from the activity log
+	backfillStatusHistory := !db.Migrator().HasTable(&models.CardStatusChange{})
+
+	// Join tables with their own columns
+	if err := db.SetupJoinTable(&models.Card{}, "Assignees", &models.CardAssignee{}); err != nil {
+		log.Fatal("Failed to set up card assignees. \n", err)
+	}
+	if err := db.SetupJoinTable(&models.Card{}, "Labels", &models.CardLabel{}); err != nil {
+		log.Fatal("Failed to set up card labels. \n", err)
+	}
 
 	// Auto Migrate to create new structure
 	err = db.AutoMigrate(
 		&models.User{},
 		&models.Chat{},
+		&models.ChatMember{},
 		&models.Message{},
+		&models.MessageEdit{},
+		&models.MessageHide{},
+		&models.MessageReaction{},
+		&models.Attachment{},
 		&models.EmailVerification{},
 		&models.RefreshToken{},
 		&models.DeviceKey{},
 		&models.OneTimePreKey{},
 		&models.Workspace{},
 		&models.WorkspaceMember{},
+		&models.WorkspaceInvitation{},
 		&models.Board{},
+		&models.BoardMember{},
 		&models.Column{},
+		&models.Company{},
+		&models.Contact{},
 		&models.Card{},
+		&models.Activity{},
+		&models.CardComment{},
+		&models.CommentMention{},
+		&models.Notification{},
+		&models.Checklist{},
+		&models.ChecklistItem{},
+		&models.Label{},
+		&models.CardLabel{},
+		&models.CardAssignee{},
+		&models.CardStatusChange{},
+		&models.CustomField{},
+		&models.CardFieldValue{},
 	)
 	if err != nil {
 		log.Fatal("Failed to migrate database. \n", err)
 	}
 
+	if err := migrateDirectChats(db); err != nil {
+		log.Fatal("Failed to migrate direct chats. \n", err)
+	}
+
+	if err := migrateRanks(db); err != nil {
+		log.Fatal("Failed to migrate card and column positions. \n", err)
+	}
+
+	if err := migrateCardAssignees(db); err != nil {
+		log.Fatal("Failed to migrate card assignees. \n", err)
+	}
+
+	if err := migrateCardContacts(db); err != nil {
+		log.Fatal("Failed to migrate card contacts. \n", err)
+	}
+
+	if backfillStatusHistory {
+		if err := migrateStatusHistory(db); err != nil {
+			log.Fatal("Failed to build card status history. \n", err)
+		}
+	}
+
+	if err := createIndexes(db); err != nil {
+		log.Fatal("Failed to create indexes. \n", err)
+	}
+
 	DB = db
 	log.Println("Database connected successfully")
 }
+
+// migrateDirectChats moves the participants of chats created before chat
+// membership existed (chats.user1_id / chats.user2_id) into chat_members and
+// drops the old columns.
+func migrateDirectChats(db *gorm.DB) error {
+	if !db.Migrator().HasColumn("chats", "user1_id") {
+		return nil
+	}
+
+	log.Println("Migrating direct chats to chat_members...")
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, column := range []string{"user1_id", "user2_id"} {
+			if err := tx.Exec(fmt.Sprintf(`INSERT INTO chat_members (id, chat_id, user_id, role, joined_at)
+				SELECT gen_random_uuid(), id, %s, 'member', created_at FROM chats WHERE %s IS NOT NULL
+				ON CONFLICT (chat_id, user_id) DO NOTHING`, column, column)).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Exec("UPDATE chats SET type = 'direct', created_by_id = user1_id WHERE created_by_id IS NULL").Error; err != nil {
+			return err
+		}
+		if err := tx.Migrator().DropColumn("chats", "user1_id"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn("chats", "user2_id")
+	})
+}
+
+// migrateRanks replaces the integer positions of columns and cards with
+// ranks, keeping the existing order, and drops the position columns.
+func migrateRanks(db *gorm.DB) error {
+	for _, t := range []struct{ table, parent string }{
+		{"columns", "board_id"},
+		{"cards", "column_id"},
+	} {
+		if !db.Migrator().HasColumn(t.table, "position") {
+			continue
+		}
+		log.Printf("Migrating %s positions to ranks...", t.table)
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var rows []struct {
+				ID       string
+				ParentID string
+			}
+			if err := tx.Raw(fmt.Sprintf("SELECT id, %s AS parent_id FROM %s ORDER BY %s, position, created_at, id",
+				t.parent, t.table, t.parent)).Scan(&rows).Error; err != nil {
+				return err
+			}
+			for start := 0; start < len(rows); {
+				end := start
+				for end < len(rows) && rows[end].ParentID == rows[start].ParentID {
+					end++
+				}
+				for i, rank := range utils.RankSequence(end - start) {
+					if err := tx.Table(t.table).Where("id = ?", rows[start+i].ID).Update("rank", rank).Error; err != nil {
+						return err
+					}
+				}
+				start = end
+			}
+			return tx.Migrator().DropColumn(t.table, "position")
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateCardAssignees moves the single assignee of cards created before
+// cards could have several (cards.assignee_id) into card_assignees and drops
+// the old column.
+func migrateCardAssignees(db *gorm.DB) error {
+	if !db.Migrator().HasColumn("cards", "assignee_id") {
+		return nil
+	}
+
+	log.Println("Migrating card assignees to card_assignees...")
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`INSERT INTO card_assignees (card_id, user_id, created_at)
+			SELECT id, assignee_id, updated_at FROM cards WHERE assignee_id IS NOT NULL
+			ON CONFLICT (card_id, user_id) DO NOTHING`).Error; err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn("cards", "assignee_id")
+	})
+}
+
+// migrateCardContacts turns the lead details stored on CRM cards
+// (cards.lead_name, contact_email, contact_phone and company) into contacts
+// and companies of the board's workspace, reusing those with the same email
+// or domain, and drops the old columns. Cards on boards outside a workspace
+// keep the details in their description.
+func migrateCardContacts(db *gorm.DB) error {
+	if !db.Migrator().HasColumn("cards", "lead_name") {
+		return nil
+	}
+
+	log.Println("Migrating card leads to contacts and companies...")
+	return db.Transaction(func(tx *gorm.DB) error {
+		var cards []struct {
+			ID           uuid.UUID
+			Description  string
+			LeadName     string
+			ContactEmail string
+			ContactPhone string
+			Company      string
+			CreatedByID  uuid.UUID
+			WorkspaceID  *uuid.UUID
+		}
+		if err := tx.Raw(`SELECT cards.id, COALESCE(cards.description, '') AS description,
+				COALESCE(cards.lead_name, '') AS lead_name, COALESCE(cards.contact_email, '') AS contact_email,
+				COALESCE(cards.contact_phone, '') AS contact_phone, COALESCE(cards.company, '') AS company,
+				cards.created_by_id, boards.workspace_id
+			FROM cards
+			JOIN columns ON columns.id = cards.column_id
+			JOIN boards ON boards.id = columns.board_id
+			WHERE COALESCE(cards.lead_name, '') <> '' OR COALESCE(cards.contact_email, '') <> ''
+				OR COALESCE(cards.contact_phone, '') <> '' OR COALESCE(cards.company, '') <> ''`).Scan(&cards).Error; err != nil {
+			return err
+		}
+
+		for _, card := range cards {
+			name, phone, companyName := strings.TrimSpace(card.LeadName), strings.TrimSpace(card.ContactPhone), strings.TrimSpace(card.Company)
+			email, notes := utils.NormalizeEmail(card.ContactEmail), ""
+			if email != "" && !utils.IsValidEmail(email) {
+				email, notes = "", "Email: "+strings.TrimSpace(card.ContactEmail)
+			}
+
+			if card.WorkspaceID == nil {
+				var lead []string
+				for _, field := range []struct{ label, value string }{
+					{"Lead", name}, {"Email", strings.TrimSpace(card.ContactEmail)}, {"Phone", phone}, {"Company", companyName},
+				} {
+					if field.value != "" {
+						lead = append(lead, field.label+": "+field.value)
+					}
+				}
+				description := strings.TrimSpace(card.Description + "\n\n" + strings.Join(lead, "\n"))
+				if err := tx.Exec("UPDATE cards SET description = ? WHERE id = ?", description, card.ID).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			workspaceID := *card.WorkspaceID
+
+			var companyID *uuid.UUID
+			if domain := utils.CompanyDomain(email); companyName != "" || domain != "" {
+				var company models.Company
+				q := tx.Where("workspace_id = ?", workspaceID)
+				if domain != "" {
+					q = q.Where("domain = ?", domain)
+				} else {
+					q = q.Where("lower(name) = lower(?)", companyName)
+				}
+				if err := q.First(&company).Error; err == gorm.ErrRecordNotFound {
+					if companyName == "" {
+						companyName = domain
+					}
+					company = models.Company{ID: uuid.New(), WorkspaceID: workspaceID, Name: companyName, Domain: domain, CreatedByID: card.CreatedByID}
+					if err := tx.Create(&company).Error; err != nil {
+						return err
+					}
+				} else if err != nil {
+					return err
+				}
+				companyID = &company.ID
+			}
+
+			var contactID *uuid.UUID
+			if name != "" || email != "" || phone != "" || notes != "" {
+				var contact models.Contact
+				q := tx.Where("workspace_id = ?", workspaceID)
+				if email != "" {
+					q = q.Where("email = ?", email)
+				} else {
+					q = q.Where("email = '' AND lower(name) = lower(?) AND company_id IS NOT DISTINCT FROM ?", name, companyID)
+				}
+				if err := q.First(&contact).Error; err == gorm.ErrRecordNotFound {
+					for _, fallback := range []string{strings.TrimSpace(card.ContactEmail), phone, companyName} {
+						if name == "" {
+							name = fallback
+						}
+					}
+					contact = models.Contact{ID: uuid.New(), WorkspaceID: workspaceID, Name: name, Email: email, Phone: phone,
+						CompanyID: companyID, Notes: notes, CreatedByID: card.CreatedByID}
+					if err := tx.Create(&contact).Error; err != nil {
+						return err
+					}
+				} else if err != nil {
+					return err
+				}
+				contactID = &contact.ID
+			}
+
+			if err := tx.Exec("UPDATE cards SET contact_id = ?, company_id = ? WHERE id = ?", contactID, companyID, card.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, column := range []string{"lead_name", "contact_email", "contact_phone", "company"} {
+			if err := tx.Migrator().DropColumn("cards", column); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// migrateStatusHistory fills card_status_changes for existing cards: each
+// card enters its first known status when it was created, followed by the
+// status changes found in the activity log.
+func migrateStatusHistory(db *gorm.DB) error {
+	log.Println("Building card status history from activities...")
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`INSERT INTO card_status_changes (id, card_id, from_status, to_status, changed_by_id, changed_at)
+			SELECT gen_random_uuid(), cards.id, '',
+				COALESCE((SELECT a.changes->'status'->>'from' FROM activities a
+					WHERE a.card_id = cards.id AND a.changes->'status' IS NOT NULL
+					ORDER BY a.created_at LIMIT 1), cards.status),
+				cards.created_by_id, cards.created_at
+			FROM cards`).Error; err != nil {
+			return err
+		}
+		// Cross-board moves are logged on both boards; keep one entry each
+		return tx.Exec(`INSERT INTO card_status_changes (id, card_id, from_status, to_status, changed_by_id, changed_at)
+			SELECT DISTINCT ON (a.card_id, a.created_at) gen_random_uuid(), a.card_id,
+				COALESCE(a.changes->'status'->>'from', ''), a.changes->'status'->>'to', a.actor_id, a.created_at
+			FROM activities a
+			WHERE a.card_id IS NOT NULL AND a.changes->'status'->>'to' IS NOT NULL
+			ORDER BY a.card_id, a.created_at`).Error
+	})
+}
+
+// createIndexes adds indexes that cannot be expressed with struct tags.
+func createIndexes(db *gorm.DB) error {
+	statements := []string{
+		// Client ids used to be unique per sender across all chats; they
+		// are now scoped to the chat (idx_messages_chat_client_id)
+		"DROP INDEX IF EXISTS idx_sender_client_id",
+
+		// Keyset pagination of chat history on (created_at, id)
+		"CREATE INDEX IF NOT EXISTS idx_messages_chat_created_id ON messages (chat_id, created_at, id)",
+
+		// Ordering by rank; ranks compare bytewise
+		`CREATE INDEX IF NOT EXISTS idx_columns_board_rank ON columns (board_id, rank COLLATE "C")`,
+		`CREATE INDEX IF NOT EXISTS idx_cards_column_rank ON cards (column_id, rank COLLATE "C")`,
+		`CREATE INDEX IF NOT EXISTS idx_checklists_card_rank ON checklists (card_id, rank COLLATE "C")`,
+		`CREATE INDEX IF NOT EXISTS idx_checklist_items_checklist_rank ON checklist_items (checklist_id, rank COLLATE "C")`,
+		`CREATE INDEX IF NOT EXISTS idx_custom_fields_board_rank ON custom_fields (board_id, rank COLLATE "C")`,
+
+		// Label and custom field names are unique per board, ignoring case
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_labels_board_name ON labels (board_id, lower(name)) WHERE deleted_at IS NULL",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_custom_fields_board_name ON custom_fields (board_id, lower(name)) WHERE deleted_at IS NULL",
+
+		// Contacts are unique per workspace by email, companies by domain
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_contacts_workspace_email ON contacts (workspace_id, email) WHERE email <> '' AND deleted_at IS NULL",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_companies_workspace_domain ON companies (workspace_id, domain) WHERE domain <> '' AND deleted_at IS NULL",
+
+		// Search. The indexed expressions must match the ones used by the
+		// search handlers.
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		"CREATE INDEX IF NOT EXISTS idx_users_username_trgm ON users USING gin (lower(username) gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_users_display_name_trgm ON users USING gin (lower(display_name) gin_trgm_ops)",
+		`CREATE INDEX IF NOT EXISTS idx_users_search ON users USING gin
+			(to_tsvector('simple', coalesce(display_name, '') || ' ' || coalesce(bio, '')))`,
+		// Only plaintext messages are searchable; E2EE ones are opaque to the server
+		`CREATE INDEX IF NOT EXISTS idx_messages_search ON messages USING gin (to_tsvector('simple', content))
+			WHERE type = 'text' AND ciphertext = '' AND deleted_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_cards_search ON cards USING gin
+			(to_tsvector('simple', coalesce(title, '') || ' ' || coalesce(description, '')))`,
+		"CREATE INDEX IF NOT EXISTS idx_contacts_search ON contacts USING gin (to_tsvector('simple', name))",
+		"CREATE INDEX IF NOT EXISTS idx_companies_search ON companies USING gin (to_tsvector('simple', name))",
+		`CREATE INDEX IF NOT EXISTS idx_boards_search ON boards USING gin
+			(to_tsvector('simple', coalesce(name, '') || ' ' || coalesce(description, '')))`,
+	}
+	for _, stmt := range statements {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
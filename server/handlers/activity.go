@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"reflect"
+	"tether-server/database"
+	"tether-server/models"
+	"tether-server/policy"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Activity feed page sizes
+const (
+	defaultActivityPageSize = 50
+	maxActivityPageSize     = 100
+)
+
+// Bookkeeping fields that change with every write and are left out of diffs
+var activityIgnoredFields = map[string]bool{"version": true, "updated_at": true, "rank": true}
+
+// logActivity appends an entry to the board's audit trail. Call it inside
+// the transaction that makes the change so both commit together.
+func logActivity(tx *gorm.DB, entry models.Activity) error {
+	entry.ID = uuid.New()
+	entry.CreatedAt = time.Now()
+	if entry.Entity == "card" {
+		cardID := entry.EntityID
+		entry.CardID = &cardID
+	}
+	return tx.Create(&entry).Error
+}
+
+// fieldChanges returns the fields of updates (column name to new value, as
+// passed to updateVersioned) whose value differs from before. Column names
+// match the JSON field names of the board models.
+func fieldChanges(before interface{}, updates map[string]interface{}) models.FieldChanges {
+	old := map[string]interface{}{}
+	if b, err := json.Marshal(before); err == nil {
+		json.Unmarshal(b, &old)
+	}
+	changes := models.FieldChanges{}
+	for field, value := range updates {
+		if activityIgnoredFields[field] {
+			continue
+		}
+		if _, ok := value.(clause.Expr); ok {
+			continue
+		}
+		to := jsonValue(value)
+		if reflect.DeepEqual(old[field], to) {
+			continue
+		}
+		changes[field] = models.FieldChange{From: old[field], To: to}
+	}
+	return changes
+}
+
+// createdChange and deletedChange record the name of a created or deleted
+// entity so the feed can still show it.
+func createdChange(field string, value interface{}) models.FieldChanges {
+	return models.FieldChanges{field: {From: nil, To: value}}
+}
+
+func deletedChange(field string, value interface{}) models.FieldChanges {
+	return models.FieldChanges{field: {From: value, To: nil}}
+}
+
+// jsonValue converts v to what it looks like after a JSON round trip, so it
+// compares equal to the same value read back from an entity.
+func jsonValue(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var out interface{}
+	json.Unmarshal(b, &out)
+	return out
+}
+
+// GET /api/cards/:id/activity?before=&limit=
+func GetCardActivity(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	cardID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid card ID"})
+	}
+	if _, err := loadCard(cardID, userID, policy.View); err != nil {
+		return err
+	}
+	return activityPage(c, database.DB.Where("card_id = ?", cardID))
+}
+
+// GET /api/boards/:id/activity?before=&limit=
+func GetBoardActivity(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	boardID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid board ID"})
+	}
+	if _, err := loadBoard(boardID, userID, policy.View); err != nil {
+		return err
+	}
+	return activityPage(c, database.DB.Where("board_id = ?", boardID))
+}
+
+// activityPage answers with the newest entries of q, older than the entry
+// given by ?before= when set.
+func activityPage(c *fiber.Ctx, q *gorm.DB) error {
+	limit := c.QueryInt("limit", defaultActivityPageSize)
+	if limit <= 0 {
+		limit = defaultActivityPageSize
+	}
+	if limit > maxActivityPageSize {
+		limit = maxActivityPageSize
+	}
+
+	if before := c.Query("before"); before != "" {
+		id, err := uuid.Parse(before)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid cursor"})
+		}
+		var cursor models.Activity
+		if err := database.DB.First(&cursor, "id = ?", id).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Activity not found"})
+		}
+		q = q.Where("(created_at, id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+	}
+
+	entries := []models.Activity{}
+	if err := q.Preload("Actor").Order("created_at desc, id desc").Limit(limit + 1).Find(&entries).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to get activity"})
+	}
+	hasMore := len(entries) > limit
+	if hasMore {
+		entries = entries[:limit]
+	}
+	return c.JSON(fiber.Map{"success": true, "data": entries, "has_more": hasMore})
+}
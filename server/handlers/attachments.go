@@ -0,0 +1,566 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"tether-server/config"
+	"tether-server/database"
+	"tether-server/models"
+	"tether-server/storage"
+	"tether-server/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// How long signed download URLs stay valid
+	attachmentURLTTL = time.Hour
+	// Largest chunk accepted by resumable uploads
+	maxChunkSize = 5 << 20
+	// Attachments per message
+	maxMessageAttachments = 10
+)
+
+var errInvalidAttachment = errors.New("attachments must be completed uploads of yours in the same chat")
+
+// POST /api/chats/:chatId/attachments
+//
+// Single-request multipart upload. Form fields: file, and for E2EE
+// attachments encrypted=true plus the client's key_metadata.
+func UploadAttachment(c *fiber.Ctx) error {
+	userIDStr := c.Locals("user_id").(string)
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	chatID, err := uuid.Parse(c.Params("chatId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid chat ID"})
+	}
+	chat, err := findChatForUser(chatID, userID)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Access denied"})
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "No file uploaded"})
+	}
+	if header.Size > config.AppConfig.MaxUploadSize {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"success": false, "error": "File is too large"})
+	}
+	file, err := header.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "No file uploaded"})
+	}
+	defer file.Close()
+
+	att := newAttachment(chat.ID, userID, header.Filename, header.Size, c.FormValue("encrypted") == "true", c.FormValue("key_metadata"))
+	if err := storeAttachment(c.Context(), &att, file); err != nil {
+		log.Printf("Failed to store attachment: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to upload file"})
+	}
+	if err := database.DB.Create(&att).Error; err != nil {
+		removeObjects(att.StorageKey, att.ThumbnailKey)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to upload file"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "data": signedAttachment(att)})
+}
+
+// POST /api/chats/:chatId/attachments/uploads
+//
+// Starts a resumable upload. The file is then sent in order with
+// PUT /api/attachments/:id/chunks?offset=N and finished with
+// POST /api/attachments/:id/complete. After a dropped connection the client
+// reads uploaded_size from GET /api/attachments/:id and resumes from there.
+func StartAttachmentUpload(c *fiber.Ctx) error {
+	userIDStr := c.Locals("user_id").(string)
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	chatID, err := uuid.Parse(c.Params("chatId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid chat ID"})
+	}
+	var input struct {
+		FileName    string `json:"file_name"`
+		Size        int64  `json:"size"`
+		Encrypted   bool   `json:"encrypted"`
+		KeyMetadata string `json:"key_metadata"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.Size <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+	if input.Size > config.AppConfig.MaxUploadSize {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"success": false, "error": "File is too large"})
+	}
+	chat, err := findChatForUser(chatID, userID)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Access denied"})
+	}
+
+	att := newAttachment(chat.ID, userID, input.FileName, input.Size, input.Encrypted, input.KeyMetadata)
+	att.Status = "uploading"
+	if err := database.DB.Create(&att).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to start upload"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "data": att, "max_chunk_size": maxChunkSize})
+}
+
+// PUT /api/attachments/:id/chunks?offset=N
+//
+// The raw request body is the chunk. offset must equal the bytes received so
+// far; a mismatch returns 409 with the current uploaded_size.
+func UploadAttachmentChunk(c *fiber.Ctx) error {
+	att, err := loadUpload(c)
+	if err != nil {
+		return err
+	}
+	offset := int64(c.QueryInt("offset", -1))
+	chunk := c.Body()
+	if len(chunk) == 0 || len(chunk) > maxChunkSize {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": fmt.Sprintf("Chunks must be between 1 and %d bytes", maxChunkSize)})
+	}
+
+	// The row lock claims the next chunk slot, so a retry at the same offset
+	// waits and then sees the offset taken instead of overwriting the chunk.
+	staleOffset := false
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&att, "id = ?", att.ID).Error; err != nil {
+			return err
+		}
+		if att.Status != "uploading" {
+			return fiber.NewError(fiber.StatusConflict, "Upload is already complete")
+		}
+		if offset != att.UploadedSize {
+			staleOffset = true
+			return nil
+		}
+		if offset+int64(len(chunk)) > att.Size {
+			return fiber.NewError(fiber.StatusBadRequest, "Chunk exceeds the declared file size")
+		}
+		if err := storage.Store.Put(c.Context(), chunkKey(att.ID, att.ChunkCount), bytes.NewReader(chunk), int64(len(chunk)), "application/octet-stream"); err != nil {
+			log.Printf("Failed to store chunk: %v", err)
+			return err
+		}
+		att.UploadedSize = offset + int64(len(chunk))
+		att.ChunkCount++
+		return tx.Model(&att).Updates(map[string]interface{}{
+			"uploaded_size": att.UploadedSize,
+			"chunk_count":   att.ChunkCount,
+		}).Error
+	})
+	if err != nil {
+		return txError(err, "Failed to upload chunk")
+	}
+	if staleOffset {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"success": false, "error": "Unexpected offset", "uploaded_size": att.UploadedSize})
+	}
+	return c.JSON(fiber.Map{"success": true, "data": att})
+}
+
+// POST /api/attachments/:id/complete
+func CompleteAttachmentUpload(c *fiber.Ctx) error {
+	att, err := loadUpload(c)
+	if err != nil {
+		return err
+	}
+	if att.UploadedSize != att.Size {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Upload is incomplete", "uploaded_size": att.UploadedSize})
+	}
+
+	chunks := &chunkReader{ctx: c.Context(), id: att.ID, count: att.ChunkCount}
+	err = storeAttachment(c.Context(), &att, chunks)
+	chunks.Close()
+	if err != nil {
+		log.Printf("Failed to assemble attachment: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to complete upload"})
+	}
+	att.Status = "ready"
+	if err := database.DB.Save(&att).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to complete upload"})
+	}
+	for i := 0; i < att.ChunkCount; i++ {
+		removeObjects(chunkKey(att.ID, i))
+	}
+	return c.JSON(fiber.Map{"success": true, "data": signedAttachment(att)})
+}
+
+// GET /api/attachments/:id
+func GetAttachment(c *fiber.Ctx) error {
+	userIDStr := c.Locals("user_id").(string)
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid attachment ID"})
+	}
+	var att models.Attachment
+	if err := database.DB.First(&att, "id = ?", id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Attachment not found"})
+	}
+	// Unfinished uploads are private to the uploader; the rest to chat members
+	if att.Status != "ready" && att.UploaderID != userID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Attachment not found"})
+	}
+	if _, err := findChatForUser(att.ChatID, userID); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Attachment not found"})
+	}
+	return c.JSON(fiber.Map{"success": true, "data": signedAttachment(att)})
+}
+
+// GET /api/files/attachments/:id and /api/files/attachments/:id/thumbnail
+//
+// Serves attachment contents. These routes take no bearer token; access is
+// granted by the signed URL handed out to chat members.
+func DownloadAttachment(c *fiber.Ctx) error {
+	thumbnail := strings.HasSuffix(c.Path(), "/thumbnail")
+	if !utils.VerifySignedPath(c.Path(), c.Query("expires"), c.Query("sig")) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Invalid or expired link"})
+	}
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid attachment ID"})
+	}
+	var att models.Attachment
+	if err := database.DB.First(&att, "id = ? AND status = ?", id, "ready").Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Attachment not found"})
+	}
+
+	key, contentType, size := att.StorageKey, att.ContentType, att.Size
+	if thumbnail {
+		if att.ThumbnailKey == "" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Attachment has no thumbnail"})
+		}
+		key, contentType, size = att.ThumbnailKey, "image/jpeg", -1
+	}
+	body, err := storage.Store.Get(c.Context(), key)
+	if err == storage.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Attachment not found"})
+	}
+	if err != nil {
+		log.Printf("Failed to read attachment: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to read attachment"})
+	}
+
+	disposition := "attachment"
+	if thumbnail || inlineContentTypes[contentType] {
+		disposition = "inline"
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType(disposition, map[string]string{"filename": att.FileName}))
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderCacheControl, "private, max-age=3600")
+	return c.SendStream(body, int(size))
+}
+
+// Sniffed types that browsers may render in place; everything else is
+// served as a download.
+var inlineContentTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Sniffed types we can make thumbnails for
+var thumbnailContentTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+func newAttachment(chatID, uploaderID uuid.UUID, fileName string, size int64, encrypted bool, keyMetadata string) models.Attachment {
+	id := uuid.New()
+	fileName = strings.TrimSpace(filepath.Base(strings.ReplaceAll(fileName, "\\", "/")))
+	if fileName == "" || fileName == "." || fileName == "/" {
+		fileName = "file"
+	}
+	if runes := []rune(fileName); len(runes) > 255 {
+		fileName = string(runes[len(runes)-255:])
+	}
+	return models.Attachment{
+		ID:          id,
+		ChatID:      chatID,
+		UploaderID:  uploaderID,
+		FileName:    fileName,
+		Size:        size,
+		Encrypted:   encrypted,
+		KeyMetadata: keyMetadata,
+		Status:      "ready",
+		StorageKey:  fmt.Sprintf("attachments/%s/%s", chatID, id),
+		CreatedAt:   time.Now(),
+	}
+}
+
+// storeAttachment sniffs the content type from the first bytes of r, writes
+// att.Size bytes to storage and, for plain images, records the dimensions and
+// stores a thumbnail. Encrypted blobs are never inspected.
+func storeAttachment(ctx context.Context, att *models.Attachment, r io.Reader) error {
+	buffered := bufio.NewReaderSize(r, 512)
+	head, err := buffered.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return err
+	}
+	att.ContentType = "application/octet-stream"
+	if !att.Encrypted {
+		att.ContentType = http.DetectContentType(head)
+	}
+	if err := storage.Store.Put(ctx, att.StorageKey, buffered, att.Size, att.ContentType); err != nil {
+		return err
+	}
+	if !att.Encrypted && thumbnailContentTypes[att.ContentType] {
+		if err := storeThumbnail(ctx, att); err != nil {
+			// The attachment is still usable without a preview
+			log.Printf("Failed to create thumbnail for attachment %s: %v", att.ID, err)
+		}
+	}
+	return nil
+}
+
+func storeThumbnail(ctx context.Context, att *models.Attachment) error {
+	body, err := storage.Store.Get(ctx, att.StorageKey)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(io.LimitReader(body, att.Size))
+	body.Close()
+	if err != nil {
+		return err
+	}
+	if att.Width, att.Height, err = utils.ImageSize(data); err != nil {
+		return err
+	}
+	thumb, err := utils.MakeThumbnail(data)
+	if err != nil {
+		return err
+	}
+	key := att.StorageKey + "_thumb.jpg"
+	if err := storage.Store.Put(ctx, key, bytes.NewReader(thumb), int64(len(thumb)), "image/jpeg"); err != nil {
+		return err
+	}
+	att.ThumbnailKey = key
+	return nil
+}
+
+// loadUpload loads the unfinished upload named by the route for its
+// uploader. Errors are *fiber.Error values.
+func loadUpload(c *fiber.Ctx) (models.Attachment, error) {
+	var att models.Attachment
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return att, fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+	}
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return att, fiber.NewError(fiber.StatusBadRequest, "Invalid attachment ID")
+	}
+	if err := database.DB.First(&att, "id = ? AND uploader_id = ?", id, userID).Error; err != nil {
+		return att, fiber.NewError(fiber.StatusNotFound, "Upload not found")
+	}
+	if att.Status != "uploading" {
+		return att, fiber.NewError(fiber.StatusConflict, "Upload is already complete")
+	}
+	return att, nil
+}
+
+func chunkKey(attachmentID uuid.UUID, index int) string {
+	return fmt.Sprintf("chunks/%s/%06d", attachmentID, index)
+}
+
+// chunkReader reads the stored chunks of an upload back to back, opening
+// each one only when the previous one is exhausted.
+type chunkReader struct {
+	ctx     context.Context
+	id      uuid.UUID
+	count   int
+	next    int
+	current io.ReadCloser
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if r.next >= r.count {
+				return 0, io.EOF
+			}
+			body, err := storage.Store.Get(r.ctx, chunkKey(r.id, r.next))
+			if err != nil {
+				return 0, err
+			}
+			r.current = body
+			r.next++
+		}
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
+
+// signedAttachment returns att with download URLs filled in.
+func signedAttachment(att models.Attachment) models.Attachment {
+	atts := []models.Attachment{att}
+	fillAttachmentURLs(atts)
+	return atts[0]
+}
+
+// fillAttachmentURLs sets signed download URLs on ready attachments. Callers
+// must have checked that the viewer is a member of the attachments' chat.
+func fillAttachmentURLs(atts []models.Attachment) {
+	for i := range atts {
+		if atts[i].Status != "ready" {
+			continue
+		}
+		path := "/api/files/attachments/" + atts[i].ID.String()
+		atts[i].URL = utils.SignPath(path, attachmentURLTTL)
+		if atts[i].ThumbnailKey != "" {
+			atts[i].ThumbnailURL = utils.SignPath(path+"/thumbnail", attachmentURLTTL)
+		}
+	}
+}
+
+// fillAttachments loads each message's attachments with signed URLs.
+func fillAttachments(messages []*models.Message) {
+	if len(messages) == 0 {
+		return
+	}
+	ids := make([]uuid.UUID, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	var atts []models.Attachment
+	database.DB.Where("message_id IN ?", ids).Order("created_at asc").Find(&atts)
+	fillAttachmentURLs(atts)
+
+	byMessage := make(map[uuid.UUID][]models.Attachment)
+	for _, att := range atts {
+		byMessage[*att.MessageID] = append(byMessage[*att.MessageID], att)
+	}
+	for _, msg := range messages {
+		msg.Attachments = byMessage[msg.ID]
+	}
+}
+
+// attachToMessage links the sender's uploads to a new message inside tx.
+func attachToMessage(tx *gorm.DB, msg models.Message, attachmentIDs []uuid.UUID) error {
+	if len(attachmentIDs) == 0 {
+		return nil
+	}
+	result := tx.Model(&models.Attachment{}).
+		Where("id IN ? AND chat_id = ? AND uploader_id = ? AND status = ? AND message_id IS NULL",
+			attachmentIDs, msg.ChatID, msg.SenderID, "ready").
+		Update("message_id", msg.ID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != int64(len(attachmentIDs)) {
+		return errInvalidAttachment
+	}
+	return nil
+}
+
+// copyAttachments gives msg its own references to the plain attachments of a
+// forwarded message. The copies share the stored objects. Encrypted
+// attachments are bound to the source chat's keys and are not copied.
+func copyAttachments(tx *gorm.DB, msg models.Message, sourceID uuid.UUID) error {
+	var sources []models.Attachment
+	if err := tx.Where("message_id = ? AND encrypted = ?", sourceID, false).Order("created_at asc").Find(&sources).Error; err != nil {
+		return err
+	}
+	for _, att := range sources {
+		att.ID = uuid.New()
+		att.ChatID = msg.ChatID
+		att.UploaderID = msg.SenderID
+		att.MessageID = &msg.ID
+		att.CreatedAt = time.Now()
+		if err := tx.Create(&att).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteAttachments removes the attachment rows matching the query inside tx
+// and returns the storage keys they used. Pass the keys to
+// removeUnreferencedObjects once the transaction has committed.
+func deleteAttachments(tx *gorm.DB, query string, args ...interface{}) ([]string, error) {
+	var atts []models.Attachment
+	if err := tx.Where(query, args...).Find(&atts).Error; err != nil {
+		return nil, err
+	}
+	if len(atts) == 0 {
+		return nil, nil
+	}
+	if err := tx.Where(query, args...).Delete(&models.Attachment{}).Error; err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, att := range atts {
+		keys = append(keys, att.StorageKey)
+		if att.ThumbnailKey != "" {
+			keys = append(keys, att.ThumbnailKey)
+		}
+	}
+	return keys, nil
+}
+
+// removeUnreferencedObjects deletes stored objects that no attachment row
+// points to any more; forwarded copies keep the originals alive.
+func removeUnreferencedObjects(keys []string) {
+	for _, key := range keys {
+		var count int64
+		database.DB.Model(&models.Attachment{}).Where("storage_key = ? OR thumbnail_key = ?", key, key).Count(&count)
+		if count == 0 {
+			removeObjects(key)
+		}
+	}
+}
+
+func removeObjects(keys ...string) {
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := storage.Store.Delete(context.Background(), key); err != nil {
+			log.Printf("Failed to delete stored object %s: %v", key, err)
+		}
+	}
+}
+
+// hasPlainAttachments reports whether a message has attachments that
+// copyAttachments would carry over when it is forwarded.
+func hasPlainAttachments(messageID uuid.UUID) bool {
+	var count int64
+	database.DB.Model(&models.Attachment{}).Where("message_id = ? AND encrypted = ?", messageID, false).Count(&count)
+	return count > 0
+}
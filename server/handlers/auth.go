@@ -225,47 +225,6 @@ func Login(c *fiber.Ctx) error {
 	})
 }
 
-// Search users by username, display_name, bio (partial match, exclude self)
-func SearchUsers(c *fiber.Ctx) error {
-	userID := c.Locals("user_id").(string)
-	query := c.Query("query")
-	if len(query) < 1 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"success": false,
-			"error":   "Query parameter is required",
-		})
-	}
-
-	var users []models.User
-	q := "%" + query + "%"
-	if err := database.DB.Where(
-		"(username ILIKE ? OR display_name ILIKE ? OR bio ILIKE ?) AND id != ?",
-		q, q, q, userID,
-	).Find(&users).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"error":   "Failed to search users",
-		})
-	}
-
-	result := make([]fiber.Map, 0, len(users))
-	for _, u := range users {
-		result = append(result, fiber.Map{
-			"id":           u.ID,
-			"username":     u.Username,
-			"display_name": u.DisplayName,
-			"bio":          u.Bio,
-			"avatar_url":   u.AvatarURL,
-			"last_seen":    u.LastSeen,
-		})
-	}
-
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data":    result,
-	})
-}
-
 // Получить профиль текущего пользователя
 func GetProfile(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
@@ -435,6 +394,9 @@ func VerifyEmail(c *fiber.Ctx) error {
 	emailVerification.Used = true
 	database.DB.Save(&emailVerification)
 
+	// Join workspaces that invited this email, now that it is confirmed
+	acceptPendingInvitations(user)
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Email verified successfully",
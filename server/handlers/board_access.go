@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"tether-server/database"
+	"tether-server/models"
+	"tether-server/policy"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// authorizeBoard checks that userID holds at least required on the board and
+// fills in board.Permission. Errors are *fiber.Error values rendered by the
+// app's error handler.
+func authorizeBoard(board *models.Board, userID uuid.UUID, required policy.Permission) error {
+	perm, err := policy.ForBoard(database.DB, *board, userID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to check board access")
+	}
+	if !perm.Can(required) {
+		return fiber.NewError(fiber.StatusForbidden, "Access denied")
+	}
+	board.Permission = perm.String()
+	return nil
+}
+
+// loadBoard loads the board with boardID for a caller who needs required.
+func loadBoard(boardID, userID uuid.UUID, required policy.Permission) (models.Board, error) {
+	var board models.Board
+	if err := database.DB.First(&board, "id = ?", boardID).Error; err != nil {
+		return board, fiber.NewError(fiber.StatusNotFound, "Board not found")
+	}
+	return board, authorizeBoard(&board, userID, required)
+}
+
+// loadColumn loads a column with its board for a caller who needs required
+// on that board.
+func loadColumn(columnID, userID uuid.UUID, required policy.Permission) (models.Column, error) {
+	var column models.Column
+	if err := database.DB.Preload("Board").First(&column, "id = ?", columnID).Error; err != nil {
+		return column, fiber.NewError(fiber.StatusNotFound, "Column not found")
+	}
+	return column, authorizeBoard(&column.Board, userID, required)
+}
+
+// loadCard loads a card with its column and board for a caller who needs
+// required on that board.
+func loadCard(cardID, userID uuid.UUID, required policy.Permission) (models.Card, error) {
+	var card models.Card
+	if err := database.DB.Preload("Column.Board").First(&card, "id = ?", cardID).Error; err != nil {
+		return card, fiber.NewError(fiber.StatusNotFound, "Card not found")
+	}
+	return card, authorizeBoard(&card.Column.Board, userID, required)
+}
+
+// isBoardMember reports whether userID belongs to the board — its owner, a
+// member of its workspace or a user it was shared with — and can still see
+// it. Access that only comes from the board being public doesn't count, so
+// members can be assigned and mentioned but strangers can't.
+func isBoardMember(board models.Board, userID uuid.UUID) (bool, error) {
+	if board.OwnerID == userID {
+		return true, nil
+	}
+	var count int64
+	err := database.DB.Model(&models.User{}).Where(`id = @user AND (
+		EXISTS (SELECT 1 FROM board_members WHERE board_id = @board AND user_id = @user)
+		OR EXISTS (SELECT 1 FROM workspace_members WHERE workspace_id = @workspace AND user_id = @user AND deleted_at IS NULL))`,
+		map[string]interface{}{"user": userID, "board": board.ID, "workspace": board.WorkspaceID}).Count(&count).Error
+	if err != nil || count == 0 {
+		return false, err
+	}
+	perm, err := policy.ForBoard(database.DB, board, userID)
+	if err != nil {
+		return false, err
+	}
+	return perm.Can(policy.View), nil
+}
+
+// checkAssignees verifies that every user in ids can be assigned work on the
+// board: members of its workspace who can see it or, on personal boards, the
+// owner and users the board was shared with.
+func checkAssignees(board models.Board, ids []uuid.UUID) error {
+	for _, id := range ids {
+		ok := false
+		var err error
+		if board.WorkspaceID != nil {
+			var count int64
+			err = database.DB.Model(&models.WorkspaceMember{}).
+				Where("workspace_id = ? AND user_id = ?", *board.WorkspaceID, id).Count(&count).Error
+			if err == nil && count > 0 {
+				var perm policy.Permission
+				perm, err = policy.ForBoard(database.DB, board, id)
+				ok = perm.Can(policy.View)
+			}
+		} else {
+			ok, err = isBoardMember(board, id)
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to check assignees")
+		}
+		if !ok {
+			return fiber.NewError(fiber.StatusBadRequest, "Assignees must be members of the board's workspace")
+		}
+	}
+	return nil
+}
+
+// assignableIDs keeps the users in ids who may be assigned on board. Cards
+// moving to another board keep only these assignees.
+func assignableIDs(board models.Board, ids []uuid.UUID) ([]uuid.UUID, error) {
+	kept := []uuid.UUID{}
+	for _, id := range ids {
+		err := checkAssignees(board, []uuid.UUID{id})
+		if fe, ok := err.(*fiber.Error); ok && fe.Code == fiber.StatusInternalServerError {
+			return nil, err
+		}
+		if err == nil {
+			kept = append(kept, id)
+		}
+	}
+	return kept, nil
+}
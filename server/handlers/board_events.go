@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"sort"
+	"tether-server/database"
+	"tether-server/models"
+	"tether-server/policy"
+	"tether-server/ws"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// lockBoards locks the rows of the boards a transaction changes, in a fixed
+// order. Transactions that change a board's columns, cards or their contents
+// call it before writing or locking any of those rows, so that concurrent
+// changes to one board queue up on the board row rather than deadlock on
+// each other's column and card locks.
+func lockBoards(tx *gorm.DB, boardIDs ...uuid.UUID) error {
+	ids := uniqueIDs(boardIDs, uuid.Nil)
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+	for _, id := range ids {
+		if err := columnList(id).lock(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bumpBoardRevision advances the board's revision inside tx, so the change
+// and its revision commit together, and returns the new revision.
+func bumpBoardRevision(tx *gorm.DB, boardID uuid.UUID) (int64, error) {
+	var rev int64
+	err := tx.Raw("UPDATE boards SET revision = revision + 1 WHERE id = ? RETURNING revision", boardID).Scan(&rev).Error
+	return rev, err
+}
+
+// bumpBoardRevisions bumps several boards touched by one change, such as a
+// card moving between boards, in a fixed order so that concurrent moves in
+// opposite directions don't deadlock.
+func bumpBoardRevisions(tx *gorm.DB, boardIDs ...uuid.UUID) (map[uuid.UUID]int64, error) {
+	ids := uniqueIDs(boardIDs, uuid.Nil)
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+	revs := make(map[uuid.UUID]int64, len(ids))
+	for _, id := range ids {
+		rev, err := bumpBoardRevision(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		revs[id] = rev
+	}
+	return revs, nil
+}
+
+// publishBoardEvent tells the board's subscribers about a committed change.
+func publishBoardEvent(boardID uuid.UUID, rev int64, eventType string, payload interface{}) {
+	ws.PublishBoard(boardID, rev, eventType, payload)
+}
+
+// resetBoardSubscriptions drops every subscription to the given boards after
+// a change to who may see them. Subscribers get board.access_changed and
+// resubscribe, which checks their access again.
+func resetBoardSubscriptions(boardIDs ...uuid.UUID) {
+	for _, boardID := range boardIDs {
+		ws.CloseBoard(boardID, ws.TypeBoardAccessChanged, nil)
+	}
+}
+
+// resetWorkspaceBoardSubscriptions does resetBoardSubscriptions for every
+// board of a workspace whose membership changed.
+func resetWorkspaceBoardSubscriptions(workspaceID uuid.UUID) {
+	var boardIDs []uuid.UUID
+	database.DB.Model(&models.Board{}).Where("workspace_id = ?", workspaceID).Pluck("id", &boardIDs)
+	resetBoardSubscriptions(boardIDs...)
+}
+
+// board.subscribe — start receiving the board's events. The ack carries the
+// current revision and the caller's permission.
+func socketBoardSubscribe(c *ws.Client, env *ws.Envelope) error {
+	var board models.Board
+	if err := database.DB.First(&board, "id = ?", *env.BoardID).Error; err != nil {
+		return errAccessDenied
+	}
+	if err := authorizeBoard(&board, c.UserID, policy.View); err != nil {
+		return errAccessDenied
+	}
+	if err := c.Subscribe(board.ID); err != nil {
+		return err
+	}
+	// Read the revision after subscribing so no event falls in between
+	database.DB.Model(&models.Board{}).Select("revision").Where("id = ?", board.ID).Scan(&board.Revision)
+
+	ack, err := ws.NewBoardEnvelope(ws.TypeBoardSubscribed, env.ID, board.ID, board.Revision, map[string]interface{}{
+		"permission": board.Permission,
+	})
+	if err != nil {
+		return err
+	}
+	c.Reply(ack)
+	return nil
+}
+
+// board.unsubscribe — stop receiving the board's events.
+func socketBoardUnsubscribe(c *ws.Client, env *ws.Envelope) error {
+	c.Unsubscribe(*env.BoardID)
+	return nil
+}
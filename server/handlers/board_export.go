@@ -0,0 +1,414 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"tether-server/database"
+	"tether-server/models"
+	"tether-server/policy"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Identifies board exports; bumped when the format changes incompatibly
+const (
+	boardExportFormat  = "tether.board"
+	boardExportVersion = 1
+)
+
+// boardExport is the portable form of a board: what GET /boards/:id/export
+// writes as JSON and what the importers read. Users are referred to by
+// username and labels, custom fields and options by name, so an export can
+// be imported into another workspace.
+type boardExport struct {
+	Format       string         `json:"format"`
+	Version      int            `json:"version"`
+	ExportedAt   *time.Time     `json:"exported_at,omitempty"`
+	Board        exportBoard    `json:"board"`
+	Labels       []exportLabel  `json:"labels"`
+	CustomFields []exportField  `json:"custom_fields"`
+	Columns      []exportColumn `json:"columns"`
+}
+
+type exportBoard struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Type        string `json:"type"`
+	Color       string `json:"color"`
+}
+
+type exportLabel struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+type exportField struct {
+	Name    string         `json:"name"`
+	Type    string         `json:"type"`
+	Options []exportOption `json:"options,omitempty"`
+}
+
+type exportOption struct {
+	Name  string `json:"name"`
+	Color string `json:"color,omitempty"`
+}
+
+type exportColumn struct {
+	Name  string       `json:"name"`
+	Color string       `json:"color"`
+	Cards []exportCard `json:"cards"`
+}
+
+type exportCard struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Color       string         `json:"color"`
+	DueDate     *time.Time     `json:"due_date"`
+	Value       float64        `json:"value"`
+	Priority    string         `json:"priority"`
+	Status      string         `json:"status"`
+	Contact     *exportContact `json:"contact,omitempty"`
+	Company     *exportCompany `json:"company,omitempty"`
+	Assignees   []string       `json:"assignees"` // usernames
+	Labels      []string       `json:"labels"`
+	// Values by field name: strings, numbers, dates as YYYY-MM-DD, option
+	// names and usernames
+	CustomFields map[string]interface{} `json:"custom_fields,omitempty"`
+	Checklists   []exportChecklist      `json:"checklists,omitempty"`
+
+	row int // where the card came from, for import errors
+}
+
+type exportContact struct {
+	Name     string `json:"name"`
+	Email    string `json:"email,omitempty"`
+	Phone    string `json:"phone,omitempty"`
+	Position string `json:"position,omitempty"`
+}
+
+type exportCompany struct {
+	Name   string `json:"name"`
+	Domain string `json:"domain,omitempty"`
+}
+
+type exportChecklist struct {
+	Title string                `json:"title"`
+	Items []exportChecklistItem `json:"items"`
+}
+
+type exportChecklistItem struct {
+	Title string `json:"title"`
+	Done  bool   `json:"done"`
+}
+
+// CSV columns of card fields, in export order. They are also the field
+// names CSV imports map their columns onto.
+var csvCardColumns = []string{
+	"column", "title", "description", "color", "due_date", "status", "priority", "value",
+	"contact_name", "contact_email", "contact_phone", "contact_position", "company", "company_domain",
+	"assignees", "labels",
+}
+
+// Separator of list values (assignees, labels, multi_select options) in CSV
+const csvListSeparator = "; "
+
+// csvFieldHeader names the CSV column of a custom field, e.g. "Budget [number]".
+func csvFieldHeader(field exportField) string {
+	return field.Name + " [" + field.Type + "]"
+}
+
+// buildBoardExport collects a board with its columns, cards, labels and
+// custom fields.
+func buildBoardExport(board models.Board) (boardExport, error) {
+	now := time.Now()
+	export := boardExport{
+		Format:     boardExportFormat,
+		Version:    boardExportVersion,
+		ExportedAt: &now,
+		Board:      exportBoard{Name: board.Name, Description: board.Description, Type: board.Type, Color: board.Color},
+		Labels:     []exportLabel{},
+		Columns:    []exportColumn{},
+	}
+
+	var labels []models.Label
+	if err := orderByName(database.DB.Where("board_id = ?", board.ID)).Find(&labels).Error; err != nil {
+		return export, err
+	}
+	for _, l := range labels {
+		export.Labels = append(export.Labels, exportLabel{Name: l.Name, Color: l.Color})
+	}
+
+	var fields []models.CustomField
+	if err := orderByRank(database.DB.Where("board_id = ?", board.ID)).Find(&fields).Error; err != nil {
+		return export, err
+	}
+	fieldsByID := map[uuid.UUID]models.CustomField{}
+	export.CustomFields = make([]exportField, len(fields))
+	for i, f := range fields {
+		fieldsByID[f.ID] = f
+		export.CustomFields[i] = exportField{Name: f.Name, Type: f.Type}
+		for _, o := range f.Options {
+			export.CustomFields[i].Options = append(export.CustomFields[i].Options, exportOption{Name: o.Name, Color: o.Color})
+		}
+	}
+
+	var columns []models.Column
+	if err := orderByRank(database.DB.Where("board_id = ?", board.ID)).
+		Preload("Cards", orderByRank).Preload("Cards.Assignees").Preload("Cards.Labels", orderByName).
+		Preload("Cards.Contact").Preload("Cards.Company").Preload("Cards.FieldValues").
+		Preload("Cards.Checklists", orderByRank).Preload("Cards.Checklists.Items", orderByRank).
+		Find(&columns).Error; err != nil {
+		return export, err
+	}
+
+	// Usernames of users picked in user fields
+	var userIDs []uuid.UUID
+	for _, column := range columns {
+		for _, card := range column.Cards {
+			for _, v := range card.FieldValues {
+				if v.UserID != nil {
+					userIDs = append(userIDs, *v.UserID)
+				}
+			}
+		}
+	}
+	usernames := map[uuid.UUID]string{}
+	if len(userIDs) > 0 {
+		var users []models.User
+		if err := database.DB.Select("id, username").Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+			return export, err
+		}
+		for _, u := range users {
+			usernames[u.ID] = u.Username
+		}
+	}
+
+	for _, column := range columns {
+		ec := exportColumn{Name: column.Name, Color: column.Color, Cards: []exportCard{}}
+		for _, card := range column.Cards {
+			ec.Cards = append(ec.Cards, exportCardOf(card, fieldsByID, usernames))
+		}
+		export.Columns = append(export.Columns, ec)
+	}
+	return export, nil
+}
+
+func exportCardOf(card models.Card, fields map[uuid.UUID]models.CustomField, usernames map[uuid.UUID]string) exportCard {
+	ec := exportCard{
+		Title:       card.Title,
+		Description: card.Description,
+		Color:       card.Color,
+		DueDate:     card.DueDate,
+		Value:       card.Value,
+		Priority:    card.Priority,
+		Status:      card.Status,
+		Assignees:   []string{},
+		Labels:      []string{},
+	}
+	if card.Contact != nil {
+		ec.Contact = &exportContact{Name: card.Contact.Name, Email: card.Contact.Email, Phone: card.Contact.Phone, Position: card.Contact.Position}
+	}
+	if card.Company != nil {
+		ec.Company = &exportCompany{Name: card.Company.Name, Domain: card.Company.Domain}
+	}
+	for _, u := range card.Assignees {
+		ec.Assignees = append(ec.Assignees, u.Username)
+	}
+	for _, l := range card.Labels {
+		ec.Labels = append(ec.Labels, l.Name)
+	}
+	for _, v := range card.FieldValues {
+		field, ok := fields[v.FieldID]
+		if !ok {
+			continue
+		}
+		if ec.CustomFields == nil {
+			ec.CustomFields = map[string]interface{}{}
+		}
+		ec.CustomFields[field.Name] = exportFieldValue(field, v, usernames)
+	}
+	for _, checklist := range card.Checklists {
+		ecl := exportChecklist{Title: checklist.Title, Items: []exportChecklistItem{}}
+		for _, item := range checklist.Items {
+			ecl.Items = append(ecl.Items, exportChecklistItem{Title: item.Title, Done: item.Done})
+		}
+		ec.Checklists = append(ec.Checklists, ecl)
+	}
+	return ec
+}
+
+// exportFieldValue turns option IDs into option names and user IDs into
+// usernames.
+func exportFieldValue(field models.CustomField, v models.CardFieldValue, usernames map[uuid.UUID]string) interface{} {
+	optionName := func(id string) string {
+		for _, o := range field.Options {
+			if o.ID == id {
+				return o.Name
+			}
+		}
+		return ""
+	}
+	switch field.Type {
+	case models.FieldSelect:
+		if v.Text != nil {
+			return optionName(*v.Text)
+		}
+	case models.FieldMultiSelect:
+		names := []string{}
+		for _, id := range v.OptionIDs {
+			names = append(names, optionName(id))
+		}
+		return names
+	case models.FieldUser:
+		if v.UserID != nil {
+			return usernames[*v.UserID]
+		}
+	}
+	return v.JSONValue()
+}
+
+// writeBoardCSV writes one row per card, with the card's column first and
+// a column per custom field after the built-in fields.
+func writeBoardCSV(export boardExport) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	header := append([]string{}, csvCardColumns...)
+	for _, f := range export.CustomFields {
+		header = append(header, csvFieldHeader(f))
+	}
+	for i := range header {
+		header[i] = csvEscapeFormula(header[i])
+	}
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+	for _, column := range export.Columns {
+		for _, card := range column.Cards {
+			var contact exportContact
+			if card.Contact != nil {
+				contact = *card.Contact
+			}
+			var company exportCompany
+			if card.Company != nil {
+				company = *card.Company
+			}
+			dueDate := ""
+			if card.DueDate != nil {
+				dueDate = card.DueDate.Format(time.RFC3339)
+			}
+			record := []string{
+				column.Name, card.Title, card.Description, card.Color, dueDate, card.Status, card.Priority,
+				strconv.FormatFloat(card.Value, 'f', -1, 64),
+				contact.Name, contact.Email, contact.Phone, contact.Position, company.Name, company.Domain,
+				strings.Join(card.Assignees, csvListSeparator), strings.Join(card.Labels, csvListSeparator),
+			}
+			for _, f := range export.CustomFields {
+				record = append(record, csvValue(card.CustomFields[f.Name]))
+			}
+			for i := range record {
+				record[i] = csvEscapeFormula(record[i])
+			}
+			if err := w.Write(record); err != nil {
+				return nil, err
+			}
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// Leading characters that make spreadsheets read a cell as a formula
+const csvFormulaStart = "=+-@\t\r"
+
+// csvEscapeFormula keeps spreadsheets from evaluating user text as a
+// formula by prefixing cells that start like one with "'". Numbers are left
+// alone, and cells already starting with "'" get another one so that
+// csvUnescapeFormula restores every cell exactly.
+func csvEscapeFormula(s string) string {
+	if s == "" {
+		return s
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return s
+	}
+	if strings.ContainsRune(csvFormulaStart+"'", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// csvUnescapeFormula undoes csvEscapeFormula.
+func csvUnescapeFormula(s string) string {
+	if len(s) > 1 && s[0] == '\'' && strings.ContainsRune(csvFormulaStart+"'", rune(s[1])) {
+		return s[1:]
+	}
+	return s
+}
+
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []string:
+		return strings.Join(v, csvListSeparator)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// exportFilename makes a download name out of a board name.
+func exportFilename(name, ext string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteRune('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "board." + ext
+	}
+	return b.String() + "." + ext
+}
+
+// GET /api/boards/:id/export?format=json|csv
+//
+// Downloads the board's columns and cards. The JSON form can be imported
+// again with POST /boards/import.
+func ExportBoard(c *fiber.Ctx) error {
+	board, _, err := loadRouteBoard(c, policy.View)
+	if err != nil {
+		return err
+	}
+	format := c.Query("format", "json")
+	if format != "json" && format != "csv" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "format must be 'json' or 'csv'"})
+	}
+
+	export, err := buildBoardExport(board)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to export board"})
+	}
+
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+exportFilename(board.Name, format)+`"`)
+	if format == "csv" {
+		data, err := writeBoardCSV(export)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to export board"})
+		}
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+		return c.Send(data)
+	}
+	return c.JSON(export)
+}
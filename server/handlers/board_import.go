@@ -0,0 +1,865 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"tether-server/database"
+	"tether-server/models"
+	"tether-server/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Import limits
+const (
+	maxImportSize  = 10 << 20
+	maxImportCards = 5000
+)
+
+// Column that CSV cards go to when the file has no column mapped to it
+const defaultImportColumn = "To Do"
+
+// importError is a problem with one card of an import.
+type importError struct {
+	Row   int    `json:"row,omitempty"` // CSV line, or position of the card in the file; absent for the board as a whole
+	Field string `json:"field,omitempty"`
+	Error string `json:"error"`
+}
+
+// importReport describes what an import creates and what is wrong with it.
+type importReport struct {
+	Valid          bool          `json:"valid"`
+	Board          string        `json:"board"`
+	Columns        int           `json:"columns"`
+	Cards          int           `json:"cards"`
+	Labels         int           `json:"labels"`
+	CustomFields   int           `json:"custom_fields"`
+	Errors         []importError `json:"errors"`
+	IgnoredColumns []string      `json:"ignored_columns,omitempty"` // CSV columns not mapped to a field
+
+	// Trello imports only
+	Skipped         *trelloSkipped   `json:"skipped,omitempty"`
+	UnmappedMembers []unmappedMember `json:"unmapped_members,omitempty"`
+}
+
+// errorText is the message of a validation error.
+func errorText(err error) string {
+	if fe, ok := err.(*fiber.Error); ok {
+		return fe.Message
+	}
+	return err.Error()
+}
+
+// parseBoardJSON reads a board written by GET /boards/:id/export.
+func parseBoardJSON(data []byte) (boardExport, error) {
+	var export boardExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return export, fmt.Errorf("Invalid JSON: %v", err)
+	}
+	if export.Format != boardExportFormat {
+		return export, fmt.Errorf("Not a board export")
+	}
+	if export.Version != boardExportVersion {
+		return export, fmt.Errorf("Unsupported export version %d", export.Version)
+	}
+	row := 0
+	for i := range export.Columns {
+		for j := range export.Columns[i].Cards {
+			row++
+			export.Columns[i].Cards[j].row = row
+		}
+	}
+	return export, nil
+}
+
+// csvFieldHeaderPattern matches the custom field columns written by
+// csvFieldHeader.
+var csvFieldHeaderPattern = regexp.MustCompile(`^(.+?)\s*\[([a-z_]+)\]$`)
+
+// parseBoardCSV reads one card per row. mapping maps CSV column headers to
+// the fields in csvCardColumns, to "field:<type>" for a custom field named
+// after the column, or to "" to skip the column. Columns not in mapping
+// are matched by name, which makes exported CSV files import unchanged.
+func parseBoardCSV(data []byte, mapping map[string]string) (boardExport, []importError, []string, error) {
+	export := boardExport{Format: boardExportFormat, Version: boardExportVersion}
+	var errs []importError
+	var ignored []string
+
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err == io.EOF {
+		return export, nil, nil, fmt.Errorf("The file is empty")
+	}
+	if err != nil {
+		return export, nil, nil, fmt.Errorf("Invalid CSV: %v", err)
+	}
+
+	cardColumns := map[string]bool{}
+	for _, name := range csvCardColumns {
+		cardColumns[name] = true
+	}
+	// What each CSV column holds: a card field or a custom field (index
+	// into export.CustomFields)
+	targets := make([]string, len(header))
+	customFields := make([]int, len(header))
+	for i, h := range header {
+		name := strings.TrimSpace(csvUnescapeFormula(h))
+		target, mapped := mapping[name]
+		if !mapped {
+			target = strings.ToLower(name)
+		}
+		customFields[i] = -1
+		switch {
+		case target == "":
+			ignored = append(ignored, name)
+		case cardColumns[target]:
+			targets[i] = target
+		case strings.HasPrefix(target, "field:"):
+			customFields[i] = len(export.CustomFields)
+			export.CustomFields = append(export.CustomFields, exportField{Name: name, Type: strings.TrimPrefix(target, "field:")})
+		case !mapped && csvFieldHeaderPattern.MatchString(name):
+			m := csvFieldHeaderPattern.FindStringSubmatch(name)
+			customFields[i] = len(export.CustomFields)
+			export.CustomFields = append(export.CustomFields, exportField{Name: m[1], Type: m[2]})
+		case mapped:
+			errs = append(errs, importError{Field: name, Error: fmt.Sprintf("Unknown field %q", target)})
+		default:
+			ignored = append(ignored, name)
+		}
+	}
+
+	columns := map[string]int{}
+	options := make([]map[string]bool, len(export.CustomFields))
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return export, nil, nil, fmt.Errorf("Invalid CSV: %v", err)
+		}
+		line, _ := r.FieldPos(0)
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		card := exportCard{row: line}
+		columnName := defaultImportColumn
+		var contact exportContact
+		var company exportCompany
+		for i, value := range record {
+			if i >= len(header) {
+				break
+			}
+			value = csvUnescapeFormula(value)
+			if f := customFields[i]; f >= 0 {
+				field := export.CustomFields[f]
+				if strings.TrimSpace(value) == "" {
+					continue
+				}
+				if card.CustomFields == nil {
+					card.CustomFields = map[string]interface{}{}
+				}
+				if isSelectField(field.Type) {
+					if options[f] == nil {
+						options[f] = map[string]bool{}
+					}
+					names := splitCSVList(value)
+					if field.Type == models.FieldSelect {
+						names = []string{strings.TrimSpace(value)}
+					}
+					for _, name := range names {
+						if !options[f][strings.ToLower(name)] {
+							options[f][strings.ToLower(name)] = true
+							export.CustomFields[f].Options = append(export.CustomFields[f].Options, exportOption{Name: name})
+						}
+					}
+				}
+				card.CustomFields[field.Name] = value
+				continue
+			}
+			trimmed := strings.TrimSpace(value)
+			switch targets[i] {
+			case "column":
+				if trimmed != "" {
+					columnName = trimmed
+				}
+			case "title":
+				card.Title = trimmed
+			case "description":
+				card.Description = value
+			case "color":
+				card.Color = trimmed
+			case "due_date":
+				if trimmed != "" {
+					if card.DueDate, err = parseDateParam(trimmed, false); err != nil {
+						errs = append(errs, importError{Row: line, Field: header[i], Error: "Invalid date"})
+					}
+				}
+			case "status":
+				card.Status = trimmed
+			case "priority":
+				card.Priority = trimmed
+			case "value":
+				if trimmed != "" {
+					if card.Value, err = strconv.ParseFloat(strings.ReplaceAll(trimmed, " ", ""), 64); err != nil {
+						errs = append(errs, importError{Row: line, Field: header[i], Error: "Invalid number"})
+					}
+				}
+			case "contact_name":
+				contact.Name = trimmed
+			case "contact_email":
+				contact.Email = trimmed
+			case "contact_phone":
+				contact.Phone = trimmed
+			case "contact_position":
+				contact.Position = trimmed
+			case "company":
+				company.Name = trimmed
+			case "company_domain":
+				company.Domain = trimmed
+			case "assignees":
+				card.Assignees = splitCSVList(value)
+			case "labels":
+				card.Labels = splitCSVList(value)
+			}
+		}
+		if contact != (exportContact{}) {
+			card.Contact = &contact
+		}
+		if company != (exportCompany{}) {
+			card.Company = &company
+		}
+
+		i, ok := columns[strings.ToLower(columnName)]
+		if !ok {
+			i = len(export.Columns)
+			columns[strings.ToLower(columnName)] = i
+			export.Columns = append(export.Columns, exportColumn{Name: columnName})
+		}
+		export.Columns[i].Cards = append(export.Columns[i].Cards, card)
+	}
+	return export, errs, ignored, nil
+}
+
+func splitCSVList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// importPlan is a validated import, ready to be written.
+type importPlan struct {
+	board   models.Board
+	labels  []models.Label
+	fields  []models.CustomField
+	columns []plannedColumn
+}
+
+type plannedColumn struct {
+	column models.Column
+	cards  []plannedCard
+}
+
+type plannedCard struct {
+	card       models.Card
+	assignees  []uuid.UUID
+	labels     []uuid.UUID
+	fields     fieldValues
+	contact    *exportContact
+	company    *exportCompany
+	checklists []exportChecklist
+}
+
+// planImport checks an import into board, which is not created yet, and
+// resolves usernames, labels and custom fields. Every problem found is
+// returned, so a dry run can report them all at once.
+func planImport(data boardExport, board models.Board) (importPlan, []importError) {
+	plan := importPlan{board: board}
+	var errs []importError
+	fail := func(row int, field string, err error) {
+		errs = append(errs, importError{Row: row, Field: field, Error: errorText(err)})
+	}
+
+	cardCount := 0
+	for _, column := range data.Columns {
+		cardCount += len(column.Cards)
+	}
+	if cardCount > maxImportCards {
+		fail(0, "", fmt.Errorf("Too many cards, at most %d can be imported at once", maxImportCards))
+		return plan, errs
+	}
+
+	// Labels: those defined, then those cards refer to
+	labels := map[string]uuid.UUID{}
+	addLabel := func(name, color string) {
+		name, err := labelName(name)
+		if err != nil {
+			fail(0, "labels", err)
+			return
+		}
+		if _, ok := labels[strings.ToLower(name)]; ok {
+			return
+		}
+		if color == "" {
+			color = "#6B7280"
+		}
+		label := models.Label{ID: uuid.New(), BoardID: board.ID, Name: name, Color: color}
+		labels[strings.ToLower(name)] = label.ID
+		plan.labels = append(plan.labels, label)
+	}
+	for _, l := range data.Labels {
+		addLabel(l.Name, l.Color)
+	}
+	for _, column := range data.Columns {
+		for _, card := range column.Cards {
+			for _, name := range card.Labels {
+				addLabel(name, "")
+			}
+		}
+	}
+
+	fields := map[string]models.CustomField{}
+	for _, f := range data.CustomFields {
+		name, err := fieldName(f.Name)
+		if err != nil {
+			fail(0, "custom_fields", err)
+			continue
+		}
+		if err := checkEnum(f.Type, customFieldTypes, "type of custom field "+name); err != nil {
+			fail(0, "custom_fields", err)
+			continue
+		}
+		if _, ok := fields[strings.ToLower(name)]; ok {
+			fail(0, "custom_fields", fmt.Errorf("Duplicate custom field %q", name))
+			continue
+		}
+		field := models.CustomField{ID: uuid.New(), BoardID: board.ID, Name: name, Type: f.Type}
+		if isSelectField(f.Type) {
+			input := make([]models.FieldOption, len(f.Options))
+			for i, o := range f.Options {
+				input[i] = models.FieldOption{Name: o.Name, Color: o.Color}
+			}
+			if field.Options, _, err = fieldOptions(input, nil); err != nil {
+				fail(0, "custom_fields", fmt.Errorf("%s: %s", name, errorText(err)))
+				continue
+			}
+		}
+		fields[strings.ToLower(name)] = field
+		plan.fields = append(plan.fields, field)
+	}
+
+	users, err := importUsers(data, fields, board)
+	if err != nil {
+		fail(0, "", err)
+		return plan, errs
+	}
+
+	for _, column := range data.Columns {
+		name := strings.TrimSpace(column.Name)
+		if name == "" {
+			fail(0, "columns", fmt.Errorf("Column name is required"))
+		}
+		if column.Color == "" {
+			column.Color = "#6B7280"
+		}
+		pc := plannedColumn{column: models.Column{ID: uuid.New(), Name: name, Color: column.Color, BoardID: board.ID, Version: 1}}
+
+		for _, card := range column.Cards {
+			p, cardErrs := planCard(card, board, labels, fields, users)
+			for _, e := range cardErrs {
+				errs = append(errs, importError{Row: card.row, Field: e.Field, Error: e.Error})
+			}
+			p.card.ColumnID = pc.column.ID
+			pc.cards = append(pc.cards, p)
+		}
+		plan.columns = append(plan.columns, pc)
+	}
+	return plan, errs
+}
+
+// importUser is a user an import refers to by username; allowed tells
+// whether they may be assigned on the new board.
+type importUser struct {
+	id      uuid.UUID
+	allowed bool
+}
+
+// importUsers looks up the usernames used as assignees and in user fields.
+func importUsers(data boardExport, fields map[string]models.CustomField, board models.Board) (map[string]importUser, error) {
+	var names []string
+	for _, column := range data.Columns {
+		for _, card := range column.Cards {
+			names = append(names, card.Assignees...)
+			for name, value := range card.CustomFields {
+				if fields[strings.ToLower(name)].Type == models.FieldUser {
+					if s, ok := value.(string); ok {
+						names = append(names, strings.TrimSpace(s))
+					}
+				}
+			}
+		}
+	}
+	users := map[string]importUser{}
+	if len(names) == 0 {
+		return users, nil
+	}
+	var found []models.User
+	if err := database.DB.Select("id, username").Where("username IN ?", names).Find(&found).Error; err != nil {
+		return nil, fmt.Errorf("Failed to look up users")
+	}
+	for _, u := range found {
+		users[u.Username] = importUser{id: u.ID, allowed: checkAssignees(board, []uuid.UUID{u.ID}) == nil}
+	}
+	return users, nil
+}
+
+func planCard(card exportCard, board models.Board, labels map[string]uuid.UUID, fields map[string]models.CustomField, users map[string]importUser) (plannedCard, []importError) {
+	var errs []importError
+	fail := func(field string, err error) {
+		errs = append(errs, importError{Field: field, Error: errorText(err)})
+	}
+
+	p := plannedCard{
+		card: models.Card{
+			ID:          uuid.New(),
+			Title:       strings.TrimSpace(card.Title),
+			Description: card.Description,
+			Color:       card.Color,
+			CreatedByID: board.OwnerID,
+			DueDate:     card.DueDate,
+			Version:     1,
+			Value:       card.Value,
+			Priority:    card.Priority,
+			Status:      card.Status,
+		},
+		contact:    card.Contact,
+		company:    card.Company,
+		checklists: card.Checklists,
+	}
+	if p.card.Title == "" {
+		fail("title", fmt.Errorf("Title is required"))
+	}
+	if p.card.Color == "" {
+		p.card.Color = "#FFFFFF"
+	}
+	if p.card.Priority == "" {
+		p.card.Priority = "medium"
+	}
+	if p.card.Status == "" {
+		p.card.Status = "new"
+	}
+	if err := checkEnum(p.card.Priority, cardPriorities, "priority"); err != nil {
+		fail("priority", err)
+	}
+	if err := checkEnum(p.card.Status, cardStatuses, "status"); err != nil {
+		fail("status", err)
+	}
+
+	for _, name := range card.Assignees {
+		user, ok := users[name]
+		switch {
+		case !ok:
+			fail("assignees", fmt.Errorf("Unknown user %q", name))
+		case !user.allowed:
+			fail("assignees", fmt.Errorf("%s cannot be assigned on this board", name))
+		default:
+			p.assignees = append(p.assignees, user.id)
+		}
+	}
+	p.assignees = uniqueIDs(p.assignees, uuid.Nil)
+	for _, name := range card.Labels {
+		if id, ok := labels[strings.ToLower(strings.TrimSpace(name))]; ok {
+			p.labels = append(p.labels, id)
+		}
+	}
+	p.labels = uniqueIDs(p.labels, uuid.Nil)
+
+	if card.Contact != nil || card.Company != nil {
+		if board.WorkspaceID == nil {
+			fail("contact", fmt.Errorf("Contacts and companies can only be linked on workspace boards"))
+		}
+		if card.Contact != nil {
+			if _, err := contactEmail(card.Contact.Email); err != nil {
+				fail("contact_email", err)
+			}
+		}
+	}
+
+	for name, value := range card.CustomFields {
+		field, ok := fields[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			fail(name, fmt.Errorf("Unknown custom field %q", name))
+			continue
+		}
+		raw, err := importFieldValue(field, value, users)
+		if err != nil {
+			fail(field.Name, err)
+			continue
+		}
+		v, err := parseFieldValue(board, field, raw)
+		if err != nil {
+			fail(field.Name, err)
+			continue
+		}
+		if v != nil {
+			p.fields.set = append(p.fields.set, *v)
+		}
+	}
+
+	for _, checklist := range card.Checklists {
+		if _, err := checklistTitle(checklist.Title); err != nil {
+			fail("checklists", err)
+		}
+		for _, item := range checklist.Items {
+			if _, err := checklistTitle(item.Title); err != nil {
+				fail("checklists", err)
+			}
+		}
+	}
+	return p, errs
+}
+
+// importFieldValue converts an imported custom field value, which refers
+// to options by name and users by username and may come from CSV as
+// text, into the JSON parseFieldValue reads.
+func importFieldValue(field models.CustomField, value interface{}, users map[string]importUser) (json.RawMessage, error) {
+	optionID := func(name string) (string, error) {
+		name = strings.TrimSpace(name)
+		for _, o := range field.Options {
+			if strings.EqualFold(o.Name, name) {
+				return o.ID, nil
+			}
+		}
+		return "", fmt.Errorf("Unknown option %q", name)
+	}
+
+	var out interface{} = value
+	switch field.Type {
+	case models.FieldSelect:
+		if s, ok := value.(string); ok && strings.TrimSpace(s) != "" {
+			id, err := optionID(s)
+			if err != nil {
+				return nil, err
+			}
+			out = id
+		}
+	case models.FieldMultiSelect:
+		var names []string
+		switch v := value.(type) {
+		case string:
+			names = splitCSVList(v)
+		case []interface{}:
+			for _, n := range v {
+				if s, ok := n.(string); ok {
+					names = append(names, s)
+				}
+			}
+		}
+		ids := []string{}
+		for _, name := range names {
+			id, err := optionID(name)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+		out = ids
+	case models.FieldUser:
+		if s, ok := value.(string); ok && strings.TrimSpace(s) != "" {
+			user, ok := users[strings.TrimSpace(s)]
+			if !ok {
+				return nil, fmt.Errorf("Unknown user %q", s)
+			}
+			out = user.id
+		}
+	case models.FieldNumber:
+		if s, ok := value.(string); ok {
+			if s = strings.ReplaceAll(strings.TrimSpace(s), " ", ""); s == "" {
+				out = nil
+			} else if n, err := strconv.ParseFloat(s, 64); err == nil {
+				out = n
+			}
+		}
+	}
+	return json.Marshal(out)
+}
+
+// commitImport writes a planned import inside tx.
+func commitImport(tx *gorm.DB, plan importPlan, userID uuid.UUID) error {
+	board := plan.board
+	if err := tx.Create(&board).Error; err != nil {
+		return err
+	}
+	if err := logActivity(tx, models.Activity{
+		BoardID:  board.ID,
+		ActorID:  userID,
+		Entity:   "board",
+		EntityID: board.ID,
+		Action:   "created",
+		Changes:  createdChange("name", board.Name),
+	}); err != nil {
+		return err
+	}
+	if len(plan.labels) > 0 {
+		if err := tx.Create(&plan.labels).Error; err != nil {
+			return err
+		}
+	}
+	fieldRanks := utils.RankSequence(len(plan.fields))
+	for i := range plan.fields {
+		plan.fields[i].Rank = fieldRanks[i]
+		if err := tx.Create(&plan.fields[i]).Error; err != nil {
+			return err
+		}
+	}
+
+	columnRanks := utils.RankSequence(len(plan.columns))
+	for i, pc := range plan.columns {
+		column := pc.column
+		column.Rank = columnRanks[i]
+		if err := tx.Create(&column).Error; err != nil {
+			return err
+		}
+		cardRanks := utils.RankSequence(len(pc.cards))
+		for j, p := range pc.cards {
+			card := p.card
+			card.Rank = cardRanks[j]
+			if board.WorkspaceID != nil {
+				var err error
+				if p.company != nil || (p.contact != nil && utils.CompanyDomain(p.contact.Email) != "") {
+					var company exportCompany
+					if p.company != nil {
+						company = *p.company
+					}
+					if company.Domain == "" && p.contact != nil {
+						company.Domain = utils.CompanyDomain(p.contact.Email)
+					}
+					if card.CompanyID, err = findOrCreateCompany(tx, *board.WorkspaceID, userID, company.Name, company.Domain); err != nil {
+						return err
+					}
+				}
+				if p.contact != nil {
+					if card.ContactID, err = findOrCreateContact(tx, *board.WorkspaceID, userID, *p.contact, card.CompanyID); err != nil {
+						return err
+					}
+				}
+			}
+			if err := tx.Create(&card).Error; err != nil {
+				return err
+			}
+			if err := setCardAssignees(tx, card.ID, p.assignees); err != nil {
+				return err
+			}
+			if err := setCardLabels(tx, card.ID, p.labels); err != nil {
+				return err
+			}
+			if err := setFieldValues(tx, card.ID, p.fields); err != nil {
+				return err
+			}
+			if err := recordStatusChange(tx, card.ID, userID, "", card.Status); err != nil {
+				return err
+			}
+			if err := createImportedChecklists(tx, card.ID, p.checklists); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func createImportedChecklists(tx *gorm.DB, cardID uuid.UUID, checklists []exportChecklist) error {
+	ranks := utils.RankSequence(len(checklists))
+	for i, c := range checklists {
+		checklist := models.Checklist{ID: uuid.New(), CardID: cardID, Title: strings.TrimSpace(c.Title), Rank: ranks[i]}
+		if err := tx.Create(&checklist).Error; err != nil {
+			return err
+		}
+		itemRanks := utils.RankSequence(len(c.Items))
+		for j, it := range c.Items {
+			item := models.ChecklistItem{ID: uuid.New(), ChecklistID: checklist.ID, Title: strings.TrimSpace(it.Title), Rank: itemRanks[j], Done: it.Done}
+			if it.Done {
+				now := time.Now()
+				item.DoneAt = &now
+			}
+			if err := tx.Create(&item).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// POST /api/boards/import?dry_run=true
+//
+// Creates a board from an uploaded file (multipart field "file"). Form
+// fields: format ("json" for board exports, "csv" or "trello"; detected
+// from the file by default), name, type and workspace_id of the new board,
+// for CSV a "mapping" JSON object from column headers to card fields, and
+// for Trello a "members" JSON object from Trello member IDs or usernames
+// to usernames or emails. With
+// dry_run nothing is written and the report lists every problem by row;
+// otherwise the board is created in one transaction, or not at all when
+// there are problems.
+func ImportBoard(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "No file uploaded"})
+	}
+	if header.Size > maxImportSize {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"success": false, "error": "File is too large"})
+	}
+	file, err := header.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Failed to read file"})
+	}
+	defer file.Close()
+	content, err := io.ReadAll(io.LimitReader(file, maxImportSize))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Failed to read file"})
+	}
+
+	format := c.FormValue("format")
+	if format == "" {
+		format = "json"
+		if strings.EqualFold(filepath.Ext(header.Filename), ".csv") {
+			format = "csv"
+		} else if isTrelloExport(content) {
+			format = "trello"
+		}
+	}
+
+	var workspaceID *uuid.UUID
+	if s := c.FormValue("workspace_id"); s != "" {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid workspace ID"})
+		}
+		if _, err := workspaceMembership(id, userID); err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Access denied to workspace"})
+		}
+		workspaceID = &id
+	}
+
+	var data boardExport
+	var errs []importError
+	var ignored []string
+	var members []trelloMember
+	var skipped trelloSkipped
+	switch format {
+	case "json":
+		data, err = parseBoardJSON(content)
+	case "csv":
+		mapping := map[string]string{}
+		if s := c.FormValue("mapping"); s != "" {
+			if err := json.Unmarshal([]byte(s), &mapping); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid mapping"})
+			}
+		}
+		data, errs, ignored, err = parseBoardCSV(content, mapping)
+		data.Board.Name = strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))
+	case "trello":
+		data, members, skipped, err = parseTrelloBoard(content)
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "format must be 'json', 'csv' or 'trello'"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": err.Error()})
+	}
+
+	board := models.Board{
+		ID:               uuid.New(),
+		Name:             strings.TrimSpace(c.FormValue("name", data.Board.Name)),
+		Description:      data.Board.Description,
+		Type:             c.FormValue("type", data.Board.Type),
+		OwnerID:          userID,
+		WorkspaceID:      workspaceID,
+		PublicPermission: "view",
+		Color:            data.Board.Color,
+		Version:          1,
+	}
+	if board.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Board name is required"})
+	}
+	if board.Type == "" {
+		board.Type = "personal"
+	}
+	if board.Type != "personal" && board.Type != "team" && board.Type != "crm" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid board type"})
+	}
+	if board.Color == "" {
+		board.Color = "#3B82F6"
+	}
+
+	var unmapped []unmappedMember
+	if format == "trello" {
+		overrides := map[string]string{}
+		if s := c.FormValue("members"); s != "" {
+			if err := json.Unmarshal([]byte(s), &overrides); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid members"})
+			}
+		}
+		matched, reasons, err := matchTrelloMembers(members, overrides, boardUsers{board})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to match members"})
+		}
+		unmapped = assignTrelloMembers(&data, members, matched, reasons)
+	}
+
+	plan, planErrs := planImport(data, board)
+	report := importReport{
+		Board:           board.Name,
+		Columns:         len(plan.columns),
+		Labels:          len(plan.labels),
+		CustomFields:    len(plan.fields),
+		Errors:          append(errs, planErrs...),
+		IgnoredColumns:  ignored,
+		UnmappedMembers: unmapped,
+	}
+	if format == "trello" {
+		report.Skipped = &skipped
+	}
+	for _, pc := range plan.columns {
+		report.Cards += len(pc.cards)
+	}
+	if report.Errors == nil {
+		report.Errors = []importError{}
+	}
+	report.Valid = len(report.Errors) == 0
+
+	if c.Query("dry_run") == "true" {
+		return c.JSON(fiber.Map{"success": true, "data": report})
+	}
+	if !report.Valid {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"success": false, "error": "The import has errors", "data": report})
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		return commitImport(tx, plan, userID)
+	})
+	if err != nil {
+		return txError(err, "Failed to import board")
+	}
+
+	database.DB.Preload("Owner").Preload("Workspace").Preload("Columns", orderByRank).First(&board, board.ID)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "data": board, "report": report})
+}
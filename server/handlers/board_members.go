@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"tether-server/database"
+	"tether-server/models"
+	"tether-server/policy"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+)
+
+// loadRouteBoard resolves the board from the route for a caller who
+// needs required on it.
+func loadRouteBoard(c *fiber.Ctx, required policy.Permission) (models.Board, uuid.UUID, error) {
+	userUUID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return models.Board{}, userUUID, fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+	}
+	boardUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return models.Board{}, userUUID, fiber.NewError(fiber.StatusBadRequest, "Invalid board ID")
+	}
+	board, err := loadBoard(boardUUID, userUUID, required)
+	return board, userUUID, err
+}
+
+// GET /api/boards/:id/members
+//
+// Lists the per-board permission overrides. Users outside the board's
+// workspace are marked as guests.
+func GetBoardMembers(c *fiber.Ctx) error {
+	board, _, err := loadRouteBoard(c, policy.View)
+	if err != nil {
+		return err
+	}
+	var members []models.BoardMember
+	if err := database.DB.Where("board_id = ?", board.ID).Preload("User").Order("created_at asc").Find(&members).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to get board members"})
+	}
+
+	inWorkspace := map[uuid.UUID]bool{}
+	if board.WorkspaceID != nil {
+		var ids []uuid.UUID
+		database.DB.Model(&models.WorkspaceMember{}).Where("workspace_id = ?", *board.WorkspaceID).Pluck("user_id", &ids)
+		for _, id := range ids {
+			inWorkspace[id] = true
+		}
+	}
+	for i := range members {
+		members[i].Guest = !inWorkspace[members[i].UserID]
+	}
+	return c.JSON(fiber.Map{"success": true, "data": members})
+}
+
+// PUT /api/boards/:id/members/:userId
+//
+// Sets a user's permission on the board. Workspace members get their default
+// access raised or lowered; anyone else is added as a guest.
+func SetBoardMember(c *fiber.Ctx) error {
+	board, userUUID, err := loadRouteBoard(c, policy.Admin)
+	if err != nil {
+		return err
+	}
+	targetID, err := uuid.Parse(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+
+	var input struct {
+		Permission string `json:"permission"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+	if _, ok := policy.Parse(input.Permission); !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "permission must be 'none', 'view', 'comment', 'edit' or 'admin'"})
+	}
+
+	if targetID == board.OwnerID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "The board owner always has admin access"})
+	}
+	var target models.User
+	if err := database.DB.First(&target, "id = ?", targetID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "User not found"})
+	}
+	guest := true
+	if board.WorkspaceID != nil {
+		var wm models.WorkspaceMember
+		if database.DB.Where("workspace_id = ? AND user_id = ?", *board.WorkspaceID, targetID).First(&wm).Error == nil {
+			if wm.Role == "owner" || wm.Role == "admin" {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Workspace owners and admins always have admin access"})
+			}
+			guest = false
+		}
+	}
+
+	member := models.BoardMember{
+		ID:         uuid.New(),
+		BoardID:    board.ID,
+		UserID:     targetID,
+		Permission: input.Permission,
+		AddedByID:  userUUID,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	if err := database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "board_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"permission", "added_by_id", "updated_at"}),
+	}).Create(&member).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to update board member"})
+	}
+
+	database.DB.Preload("User").Where("board_id = ? AND user_id = ?", board.ID, targetID).First(&member)
+	member.Guest = guest
+	resetBoardSubscriptions(board.ID)
+	return c.JSON(fiber.Map{"success": true, "data": member})
+}
+
+// DELETE /api/boards/:id/members/:userId
+//
+// Removes the override; workspace members fall back to their default access
+// and guests lose access.
+func RemoveBoardMember(c *fiber.Ctx) error {
+	board, _, err := loadRouteBoard(c, policy.Admin)
+	if err != nil {
+		return err
+	}
+	targetID, err := uuid.Parse(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	result := database.DB.Where("board_id = ? AND user_id = ?", board.ID, targetID).Delete(&models.BoardMember{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to remove board member"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Member not found"})
+	}
+	resetBoardSubscriptions(board.ID)
+	return c.JSON(fiber.Map{"success": true, "message": "Board member removed successfully"})
+}
@@ -3,10 +3,14 @@ package handlers
 import (
 	"tether-server/database"
 	"tether-server/models"
+	"tether-server/policy"
+	"tether-server/utils"
+	"tether-server/ws"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // CreateBoard - создать новую доску
@@ -21,12 +25,13 @@ func CreateBoard(c *fiber.Ctx) error {
 	}
 
 	var input struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		Type        string `json:"type"`
-		WorkspaceID string `json:"workspace_id"`
-		IsPublic    bool   `json:"is_public"`
-		Color       string `json:"color"`
+		Name             string `json:"name"`
+		Description      string `json:"description"`
+		Type             string `json:"type"`
+		WorkspaceID      string `json:"workspace_id"`
+		IsPublic         bool   `json:"is_public"`
+		PublicPermission string `json:"public_permission"`
+		Color            string `json:"color"`
 	}
 
 	if err := c.BodyParser(&input); err != nil {
@@ -54,6 +59,16 @@ func CreateBoard(c *fiber.Ctx) error {
 		})
 	}
 
+	if input.PublicPermission == "" {
+		input.PublicPermission = "view"
+	}
+	if !validPublicPermission(input.PublicPermission) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "public_permission must be 'view', 'comment' or 'edit'",
+		})
+	}
+
 	// Validate workspace access if provided
 	var workspaceID *uuid.UUID
 	if input.WorkspaceID != "" {
@@ -83,40 +98,60 @@ func CreateBoard(c *fiber.Ctx) error {
 	}
 
 	board := models.Board{
-		ID:          uuid.New(),
-		Name:        input.Name,
-		Description: input.Description,
-		Type:        input.Type,
-		OwnerID:     userUUID,
-		WorkspaceID: workspaceID,
-		IsPublic:    input.IsPublic,
-		Color:       input.Color,
-		CreatedAt:   time.Now(),
-	}
-
-	if err := database.DB.Create(&board).Error; err != nil {
+		ID:               uuid.New(),
+		Name:             input.Name,
+		Description:      input.Description,
+		Type:             input.Type,
+		OwnerID:          userUUID,
+		WorkspaceID:      workspaceID,
+		IsPublic:         input.IsPublic,
+		Color:            input.Color,
+		PublicPermission: input.PublicPermission,
+		Version:          1,
+		CreatedAt:        time.Now(),
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&board).Error; err != nil {
+			return err
+		}
+
+		// Create default columns for the board
+		defaultColumns := []string{"To Do", "In Progress", "Done"}
+		ranks := utils.RankSequence(len(defaultColumns))
+		for i, columnName := range defaultColumns {
+			column := models.Column{
+				ID:        uuid.New(),
+				Name:      columnName,
+				Rank:      ranks[i],
+				Color:     "#6B7280",
+				BoardID:   board.ID,
+				Version:   1,
+				CreatedAt: time.Now(),
+			}
+			if err := tx.Create(&column).Error; err != nil {
+				return err
+			}
+		}
+
+		return logActivity(tx, models.Activity{
+			BoardID:  board.ID,
+			ActorID:  userUUID,
+			Entity:   "board",
+			EntityID: board.ID,
+			Action:   "created",
+			Changes:  createdChange("name", board.Name),
+		})
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"error":   "Failed to create board",
 		})
 	}
 
-	// Create default columns for the board
-	defaultColumns := []string{"To Do", "In Progress", "Done"}
-	for i, columnName := range defaultColumns {
-		column := models.Column{
-			ID:        uuid.New(),
-			Name:      columnName,
-			Position:  i,
-			Color:     "#6B7280",
-			BoardID:   board.ID,
-			CreatedAt: time.Now(),
-		}
-		database.DB.Create(&column)
-	}
-
 	// Load relations
-	database.DB.Preload("Owner").Preload("Workspace").Preload("Columns").First(&board, board.ID)
+	database.DB.Preload("Owner").Preload("Workspace").Preload("Columns", orderByRank).First(&board, board.ID)
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"success": true,
@@ -135,21 +170,27 @@ func GetBoards(c *fiber.Ctx) error {
 		})
 	}
 
-	// Get personal boards
-	var personalBoards []models.Board
-	database.DB.Where("owner_id = ? AND workspace_id IS NULL", userUUID).
-		Preload("Owner").Preload("Columns").
-		Find(&personalBoards)
-
-	// Get workspace boards where user is a member
-	var workspaceBoards []models.Board
-	database.DB.Joins("JOIN workspace_members ON boards.workspace_id = workspace_members.workspace_id").
-		Where("workspace_members.user_id = ?", userUUID).
-		Preload("Owner").Preload("Workspace").Preload("Columns").
-		Find(&workspaceBoards)
-
-	// Combine boards
-	allBoards := append(personalBoards, workspaceBoards...)
+	// Own boards, boards shared with the user and boards of their workspaces
+	var allBoards []models.Board
+	if err := policy.ListedBoards(database.DB, userUUID).
+		Preload("Owner").Preload("Workspace").Preload("Columns", orderByRank).
+		Order("boards.created_at asc").
+		Find(&allBoards).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get boards",
+		})
+	}
+	perms, err := policy.ForBoards(database.DB, allBoards, userUUID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get boards",
+		})
+	}
+	for i := range allBoards {
+		allBoards[i].Permission = perms[i].String()
+	}
 
 	return c.JSON(fiber.Map{
 		"success": true,
@@ -177,8 +218,17 @@ func GetBoard(c *fiber.Ctx) error {
 		})
 	}
 
+	// ?labels= and ?assignees= narrow down the cards
+	filter, err := parseCardFilter(c, userUUID)
+	if err != nil {
+		return err
+	}
+	cards := func(db *gorm.DB) *gorm.DB {
+		return filter.scope(orderByRank(db))
+	}
+
 	var board models.Board
-	if err := database.DB.Preload("Owner").Preload("Workspace").Preload("Columns.Cards.Assignee").Preload("Columns.Cards.CreatedBy").First(&board, boardUUID).Error; err != nil {
+	if err := database.DB.Preload("Owner").Preload("Workspace").Preload("CustomFields", orderByRank).Preload("Columns", orderByRank).Preload("Columns.Cards", cards).Preload("Columns.Cards.Assignees").Preload("Columns.Cards.Labels", orderByName).Preload("Columns.Cards.Contact").Preload("Columns.Cards.Company").Preload("Columns.Cards.FieldValues").Preload("Columns.Cards.CreatedBy").First(&board, boardUUID).Error; err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"success": false,
 			"error":   "Board not found",
@@ -186,23 +236,11 @@ func GetBoard(c *fiber.Ctx) error {
 	}
 
 	// Check access
-	if board.OwnerID != userUUID && !board.IsPublic {
-		// Check if user is member of workspace
-		if board.WorkspaceID != nil {
-			var member models.WorkspaceMember
-			if err := database.DB.Where("workspace_id = ? AND user_id = ?", board.WorkspaceID, userUUID).First(&member).Error; err != nil {
-				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-					"success": false,
-					"error":   "Access denied",
-				})
-			}
-		} else {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"success": false,
-				"error":   "Access denied",
-			})
-		}
+	if err := authorizeBoard(&board, userUUID, policy.View); err != nil {
+		return err
 	}
+	fillCardSummaries(&board)
+	setETag(c, board.Version)
 
 	return c.JSON(fiber.Map{
 		"success": true,
@@ -238,19 +276,25 @@ func UpdateBoard(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check ownership
-	if board.OwnerID != userUUID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"success": false,
-			"error":   "Only board owner can update",
-		})
+	// Board settings need admin permission
+	if err := authorizeBoard(&board, userUUID, policy.Admin); err != nil {
+		return err
+	}
+
+	ifMatch, err := ifMatchVersion(c)
+	if err != nil {
+		return err
+	}
+	if ifMatch != nil && *ifMatch != board.Version {
+		return versionConflict(c, board, board.Version)
 	}
 
 	var input struct {
-		Name        *string `json:"name"`
-		Description *string `json:"description"`
-		IsPublic    *bool   `json:"is_public"`
-		Color       *string `json:"color"`
+		Name             *string `json:"name"`
+		Description      *string `json:"description"`
+		IsPublic         *bool   `json:"is_public"`
+		PublicPermission *string `json:"public_permission"`
+		Color            *string `json:"color"`
 	}
 
 	if err := c.BodyParser(&input); err != nil {
@@ -260,29 +304,80 @@ func UpdateBoard(c *fiber.Ctx) error {
 		})
 	}
 
-	// Update fields
+	// Collect only the fields the client sent
+	updates := map[string]interface{}{}
 	if input.Name != nil {
-		board.Name = *input.Name
+		updates["name"] = *input.Name
 	}
 	if input.Description != nil {
-		board.Description = *input.Description
+		updates["description"] = *input.Description
 	}
+	accessChanged := false
 	if input.IsPublic != nil {
-		board.IsPublic = *input.IsPublic
+		accessChanged = accessChanged || board.IsPublic != *input.IsPublic
+		updates["is_public"] = *input.IsPublic
+	}
+	if input.PublicPermission != nil {
+		if !validPublicPermission(*input.PublicPermission) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "public_permission must be 'view', 'comment' or 'edit'",
+			})
+		}
+		accessChanged = accessChanged || board.PublicPermission != *input.PublicPermission
+		updates["public_permission"] = *input.PublicPermission
 	}
 	if input.Color != nil {
-		board.Color = *input.Color
+		updates["color"] = *input.Color
 	}
 
-	board.UpdatedAt = time.Now()
+	if len(updates) == 0 {
+		setETag(c, board.Version)
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    board,
+		})
+	}
 
-	if err := database.DB.Save(&board).Error; err != nil {
+	var rev int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		changes := fieldChanges(board, updates)
+		if err := updateVersioned(tx, &models.Board{}, board.ID, ifMatch, updates); err != nil {
+			return err
+		}
+		if len(changes) > 0 {
+			if err := logActivity(tx, models.Activity{
+				BoardID:  board.ID,
+				ActorID:  userUUID,
+				Entity:   "board",
+				EntityID: board.ID,
+				Action:   "updated",
+				Changes:  changes,
+			}); err != nil {
+				return err
+			}
+		}
+		rev, err = bumpBoardRevision(tx, board.ID)
+		return err
+	})
+	if err == errVersionConflict {
+		database.DB.First(&board, board.ID)
+		return versionConflict(c, board, board.Version)
+	}
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"error":   "Failed to update board",
 		})
 	}
 
+	database.DB.First(&board, board.ID)
+	publishBoardEvent(board.ID, rev, ws.TypeBoardUpdated, board)
+	if accessChanged {
+		resetBoardSubscriptions(board.ID)
+	}
+
+	setETag(c, board.Version)
 	return c.JSON(fiber.Map{
 		"success": true,
 		"data":    board,
@@ -317,23 +412,41 @@ func DeleteBoard(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check ownership
-	if board.OwnerID != userUUID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"success": false,
-			"error":   "Only board owner can delete",
-		})
+	// Deleting a board needs admin permission
+	if err := authorizeBoard(&board, userUUID, policy.Admin); err != nil {
+		return err
 	}
 
-	if err := database.DB.Delete(&board).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&board).Error; err != nil {
+			return err
+		}
+		return logActivity(tx, models.Activity{
+			BoardID:  board.ID,
+			ActorID:  userUUID,
+			Entity:   "board",
+			EntityID: board.ID,
+			Action:   "deleted",
+			Changes:  deletedChange("name", board.Name),
+		})
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"error":   "Failed to delete board",
 		})
 	}
 
+	ws.CloseBoard(board.ID, ws.TypeBoardDeleted, fiber.Map{"board_id": board.ID})
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Board deleted successfully",
 	})
 }
+
+// validPublicPermission reports whether p may be granted to everyone on a
+// public board. Admin rights are never public.
+func validPublicPermission(p string) bool {
+	return p == "view" || p == "comment" || p == "edit"
+}
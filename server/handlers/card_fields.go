@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"strings"
+	"tether-server/database"
+	"tether-server/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Values of the built-in enum fields of cards
+var cardPriorities = []string{"low", "medium", "high", "urgent"}
+
+// cardStatuses are the deal stages, in pipeline order.
+var cardStatuses = func() []string {
+	statuses := make([]string, len(pipelineStages))
+	for i, s := range pipelineStages {
+		statuses[i] = s.status
+	}
+	return statuses
+}()
+
+// Longest text and URL values of custom fields, in bytes
+const (
+	maxFieldTextLength = 10000
+	maxFieldURLLength  = 2048
+)
+
+// checkEnum verifies that value is one of allowed.
+func checkEnum(value string, allowed []string, name string) error {
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return fiber.NewError(fiber.StatusBadRequest, "Invalid "+name+", expected one of: "+strings.Join(allowed, ", "))
+}
+
+// fieldValues is the result of parsing custom field values sent for a card:
+// values to write and fields whose value is cleared.
+type fieldValues struct {
+	set   []models.CardFieldValue
+	clear []uuid.UUID
+}
+
+// parseFieldValues validates custom field values sent for a card on board,
+// keyed by field ID. null, "" and [] clear a value.
+func parseFieldValues(board models.Board, input map[string]json.RawMessage) (fieldValues, error) {
+	var result fieldValues
+	if len(input) == 0 {
+		return result, nil
+	}
+	ids := make([]uuid.UUID, 0, len(input))
+	for key := range input {
+		id, err := uuid.Parse(key)
+		if err != nil {
+			return result, fiber.NewError(fiber.StatusBadRequest, "Invalid custom field ID")
+		}
+		ids = append(ids, id)
+	}
+	var fields []models.CustomField
+	if err := database.DB.Where("board_id = ? AND id IN ?", board.ID, ids).Find(&fields).Error; err != nil {
+		return result, fiber.NewError(fiber.StatusInternalServerError, "Failed to check custom fields")
+	}
+	if len(fields) != len(ids) {
+		return result, fiber.NewError(fiber.StatusBadRequest, "Custom fields must belong to the card's board")
+	}
+
+	for _, field := range fields {
+		value, err := parseFieldValue(board, field, input[field.ID.String()])
+		if err != nil {
+			return result, err
+		}
+		if value == nil {
+			result.clear = append(result.clear, field.ID)
+		} else {
+			result.set = append(result.set, *value)
+		}
+	}
+	return result, nil
+}
+
+// parseFieldValue parses one value for field, returning nil when it clears
+// the field.
+func parseFieldValue(board models.Board, field models.CustomField, raw json.RawMessage) (*models.CardFieldValue, error) {
+	invalid := fiber.NewError(fiber.StatusBadRequest, "Invalid value for custom field "+field.Name)
+	if string(raw) == "null" {
+		return nil, nil
+	}
+	value := models.CardFieldValue{FieldID: field.ID, UpdatedAt: time.Now()}
+
+	if field.Type == models.FieldNumber {
+		var n float64
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return nil, invalid
+		}
+		value.Number = &n
+		return &value, nil
+	}
+	if field.Type == models.FieldMultiSelect {
+		var ids []string
+		if err := json.Unmarshal(raw, &ids); err != nil {
+			return nil, invalid
+		}
+		seen := map[string]bool{}
+		for _, id := range ids {
+			if !hasOption(field, id) {
+				return nil, invalid
+			}
+			if !seen[id] {
+				seen[id] = true
+				value.OptionIDs = append(value.OptionIDs, id)
+			}
+		}
+		if len(value.OptionIDs) == 0 {
+			return nil, nil
+		}
+		return &value, nil
+	}
+
+	// The other types take a string
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, invalid
+	}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	switch field.Type {
+	case models.FieldText:
+		if len(s) > maxFieldTextLength {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Value for custom field "+field.Name+" is too long")
+		}
+		value.Text = &s
+	case models.FieldURL:
+		u, err := url.Parse(s)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(s) > maxFieldURLLength {
+			return nil, invalid
+		}
+		value.Text = &s
+	case models.FieldSelect:
+		if !hasOption(field, s) {
+			return nil, invalid
+		}
+		value.Text = &s
+	case models.FieldDate:
+		t, err := parseDateParam(s, false)
+		if err != nil {
+			return nil, invalid
+		}
+		date := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		value.Date = &date
+	case models.FieldUser:
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return nil, invalid
+		}
+		// Users follow the same rules as card assignees
+		if err := checkAssignees(board, []uuid.UUID{id}); err != nil {
+			return nil, err
+		}
+		value.UserID = &id
+	default:
+		return nil, invalid
+	}
+	return &value, nil
+}
+
+func hasOption(field models.CustomField, id string) bool {
+	for _, o := range field.Options {
+		if o.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// setFieldValues writes a card's custom field values inside tx.
+func setFieldValues(tx *gorm.DB, cardID uuid.UUID, values fieldValues) error {
+	if len(values.clear) > 0 {
+		if err := tx.Where("card_id = ? AND field_id IN ?", cardID, values.clear).Delete(&models.CardFieldValue{}).Error; err != nil {
+			return err
+		}
+	}
+	if len(values.set) == 0 {
+		return nil
+	}
+	rows := make([]models.CardFieldValue, len(values.set))
+	for i, v := range values.set {
+		v.CardID = cardID
+		rows[i] = v
+	}
+	return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&rows).Error
+}
+
+// fieldValueChanges returns the values that values changes on a card whose
+// current values are current, keyed by field ID, for activity diffs.
+func fieldValueChanges(current []models.CardFieldValue, values fieldValues) (from, to map[string]interface{}) {
+	old := map[uuid.UUID]interface{}{}
+	for _, v := range current {
+		old[v.FieldID] = jsonValue(v.JSONValue())
+	}
+	from, to = map[string]interface{}{}, map[string]interface{}{}
+	for _, v := range values.set {
+		if value := jsonValue(v.JSONValue()); !reflect.DeepEqual(old[v.FieldID], value) {
+			from[v.FieldID.String()], to[v.FieldID.String()] = old[v.FieldID], value
+		}
+	}
+	for _, id := range values.clear {
+		if old[id] != nil {
+			from[id.String()], to[id.String()] = old[id], nil
+		}
+	}
+	return from, to
+}
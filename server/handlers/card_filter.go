@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// cardFilter narrows the cards of a board, column or search to those with
+// any of the given labels and any of the given assignees.
+type cardFilter struct {
+	labels     []uuid.UUID
+	assignees  []uuid.UUID
+	unassigned bool // also match cards nobody is assigned to
+}
+
+// parseCardFilter reads ?labels= and ?assignees= as comma-separated ids.
+// Assignees may include "me" for the caller and "none" for unassigned
+// cards.
+func parseCardFilter(c *fiber.Ctx, userID uuid.UUID) (cardFilter, error) {
+	var f cardFilter
+	for _, s := range splitList(c.Query("labels")) {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return f, fiber.NewError(fiber.StatusBadRequest, "Invalid label ID")
+		}
+		f.labels = append(f.labels, id)
+	}
+	for _, s := range splitList(c.Query("assignees")) {
+		switch s {
+		case "me":
+			f.assignees = append(f.assignees, userID)
+		case "none":
+			f.unassigned = true
+		default:
+			id, err := uuid.Parse(s)
+			if err != nil {
+				return f, fiber.NewError(fiber.StatusBadRequest, "Invalid assignee ID")
+			}
+			f.assignees = append(f.assignees, id)
+		}
+	}
+	return f, nil
+}
+
+func splitList(s string) []string {
+	var parts []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+// sql returns the filter as a condition on the cards table with named
+// arguments, or "" when the filter is empty.
+func (f cardFilter) sql() (string, map[string]interface{}) {
+	var conds []string
+	args := map[string]interface{}{}
+	if len(f.labels) > 0 {
+		conds = append(conds, "EXISTS (SELECT 1 FROM card_labels WHERE card_labels.card_id = cards.id AND card_labels.label_id IN @filter_labels)")
+		args["filter_labels"] = f.labels
+	}
+	var assignee []string
+	if len(f.assignees) > 0 {
+		assignee = append(assignee, "EXISTS (SELECT 1 FROM card_assignees WHERE card_assignees.card_id = cards.id AND card_assignees.user_id IN @filter_assignees)")
+		args["filter_assignees"] = f.assignees
+	}
+	if f.unassigned {
+		assignee = append(assignee, "NOT EXISTS (SELECT 1 FROM card_assignees WHERE card_assignees.card_id = cards.id)")
+	}
+	if len(assignee) > 0 {
+		conds = append(conds, "("+strings.Join(assignee, " OR ")+")")
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// scope applies the filter to a query on cards.
+func (f cardFilter) scope(db *gorm.DB) *gorm.DB {
+	cond, args := f.sql()
+	if cond == "" {
+		return db
+	}
+	return db.Where(cond, args)
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"tether-server/database"
+	"tether-server/models"
+
+	"github.com/google/uuid"
+)
+
+// fillCardSummaries fills in the per-card counts shown on board views, with
+// one grouped query per kind for the whole board.
+func fillCardSummaries(board *models.Board) {
+	var cardIDs []uuid.UUID
+	for i := range board.Columns {
+		for j := range board.Columns[i].Cards {
+			cardIDs = append(cardIDs, board.Columns[i].Cards[j].ID)
+		}
+	}
+	if len(cardIDs) == 0 {
+		return
+	}
+
+	var comments []struct {
+		CardID uuid.UUID
+		Count  int64
+	}
+	database.DB.Model(&models.CardComment{}).Select("card_id, count(*) AS count").
+		Where("card_id IN ?", cardIDs).Group("card_id").Scan(&comments)
+	commentCounts := make(map[uuid.UUID]int64, len(comments))
+	for _, row := range comments {
+		commentCounts[row.CardID] = row.Count
+	}
+
+	var checklists []struct {
+		CardID uuid.UUID
+		Done   int64
+		Total  int64
+	}
+	database.DB.Table("checklist_items").
+		Select("checklists.card_id, count(*) FILTER (WHERE checklist_items.done) AS done, count(*) AS total").
+		Joins("JOIN checklists ON checklists.id = checklist_items.checklist_id AND checklists.deleted_at IS NULL").
+		Where("checklists.card_id IN ? AND checklist_items.deleted_at IS NULL", cardIDs).
+		Group("checklists.card_id").Scan(&checklists)
+	progress := make(map[uuid.UUID][2]int64, len(checklists))
+	for _, row := range checklists {
+		progress[row.CardID] = [2]int64{row.Done, row.Total}
+	}
+
+	for i := range board.Columns {
+		for j := range board.Columns[i].Cards {
+			card := &board.Columns[i].Cards[j]
+			card.CommentCount = commentCounts[card.ID]
+			card.ChecklistDone, card.ChecklistTotal = progress[card.ID][0], progress[card.ID][1]
+		}
+	}
+}
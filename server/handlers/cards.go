@@ -1,12 +1,16 @@
 package handlers
 
 import (
+	"encoding/json"
 	"tether-server/database"
 	"tether-server/models"
+	"tether-server/policy"
+	"tether-server/ws"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // CreateCard - создать новую карточку
@@ -21,21 +25,21 @@ func CreateCard(c *fiber.Ctx) error {
 	}
 
 	var input struct {
-		Title       string `json:"title"`
-		Description string `json:"description"`
-		Position    int    `json:"position"`
-		Color       string `json:"color"`
-		ColumnID    string `json:"column_id"`
-		AssigneeID  string `json:"assignee_id"`
-		DueDate     string `json:"due_date"`
+		Title       string   `json:"title"`
+		Description string   `json:"description"`
+		Color       string   `json:"color"`
+		ColumnID    string   `json:"column_id"`
+		AssigneeIDs []string `json:"assignee_ids"`
+		LabelIDs    []string `json:"label_ids"`
+		DueDate     string   `json:"due_date"`
 		// CRM Fields
-		LeadName     string  `json:"lead_name"`
-		ContactEmail string  `json:"contact_email"`
-		ContactPhone string  `json:"contact_phone"`
-		Company      string  `json:"company"`
-		Value        float64 `json:"value"`
-		Priority     string  `json:"priority"`
-		Status       string  `json:"status"`
+		ContactID string  `json:"contact_id"`
+		CompanyID string  `json:"company_id"`
+		Value     float64 `json:"value"`
+		Priority  string  `json:"priority"`
+		Status    string  `json:"status"`
+		// Custom field values by field ID
+		CustomFields map[string]json.RawMessage `json:"custom_fields"`
 	}
 
 	if err := c.BodyParser(&input); err != nil {
@@ -61,43 +65,35 @@ func CreateCard(c *fiber.Ctx) error {
 	}
 
 	// Check column and board access
-	var column models.Column
-	if err := database.DB.Preload("Board").First(&column, columnUUID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"success": false,
-			"error":   "Column not found",
-		})
+	column, err := loadColumn(columnUUID, userUUID, policy.Edit)
+	if err != nil {
+		return err
 	}
 
-	board := column.Board
-	if board.OwnerID != userUUID && !board.IsPublic {
-		if board.WorkspaceID != nil {
-			var member models.WorkspaceMember
-			if err := database.DB.Where("workspace_id = ? AND user_id = ?", board.WorkspaceID, userUUID).First(&member).Error; err != nil {
-				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-					"success": false,
-					"error":   "Access denied",
-				})
-			}
-		} else {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"success": false,
-				"error":   "Access denied",
-			})
-		}
+	// Assignees must be members of the board's workspace, labels must be the
+	// board's own
+	assigneeIDs, err := parseIDList(input.AssigneeIDs, "assignee ID")
+	if err != nil {
+		return err
 	}
-
-	// Parse assignee ID if provided
-	var assigneeID *uuid.UUID
-	if input.AssigneeID != "" {
-		assigneeUUID, err := uuid.Parse(input.AssigneeID)
-		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"success": false,
-				"error":   "Invalid assignee ID",
-			})
-		}
-		assigneeID = &assigneeUUID
+	if err := checkAssignees(column.Board, assigneeIDs); err != nil {
+		return err
+	}
+	labelIDs, err := parseIDList(input.LabelIDs, "label ID")
+	if err != nil {
+		return err
+	}
+	if err := checkLabels(column.BoardID, labelIDs); err != nil {
+		return err
+	}
+	// Contact and company come from the board's workspace
+	contactID, companyID, _, err := cardContactLinks(column.Board, &input.ContactID, &input.CompanyID, nil)
+	if err != nil {
+		return err
+	}
+	fields, err := parseFieldValues(column.Board, input.CustomFields)
+	if err != nil {
+		return err
 	}
 
 	// Parse due date if provided
@@ -123,36 +119,78 @@ func CreateCard(c *fiber.Ctx) error {
 	if input.Status == "" {
 		input.Status = "new"
 	}
+	if err := checkEnum(input.Priority, cardPriorities, "priority"); err != nil {
+		return err
+	}
+	if err := checkEnum(input.Status, cardStatuses, "status"); err != nil {
+		return err
+	}
 
 	card := models.Card{
-		ID:           uuid.New(),
-		Title:        input.Title,
-		Description:  input.Description,
-		Position:     input.Position,
-		Color:        input.Color,
-		ColumnID:     columnUUID,
-		AssigneeID:   assigneeID,
-		CreatedByID:  userUUID,
-		DueDate:      dueDate,
-		LeadName:     input.LeadName,
-		ContactEmail: input.ContactEmail,
-		ContactPhone: input.ContactPhone,
-		Company:      input.Company,
-		Value:        input.Value,
-		Priority:     input.Priority,
-		Status:       input.Status,
-		CreatedAt:    time.Now(),
-	}
-
-	if err := database.DB.Create(&card).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"error":   "Failed to create card",
-		})
+		ID:          uuid.New(),
+		Title:       input.Title,
+		Description: input.Description,
+		Color:       input.Color,
+		ColumnID:    columnUUID,
+		CreatedByID: userUUID,
+		DueDate:     dueDate,
+		Version:     1,
+		ContactID:   contactID,
+		CompanyID:   companyID,
+		Value:       input.Value,
+		Priority:    input.Priority,
+		Status:      input.Status,
+		CreatedAt:   time.Now(),
+	}
+
+	// New cards go to the end of the column
+	var rev int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockBoards(tx, column.BoardID); err != nil {
+			return err
+		}
+		list := cardList(columnUUID)
+		if err := list.lock(tx); err != nil {
+			return err
+		}
+		if card.Rank, err = list.place(tx, card.ID, nil, nil); err != nil {
+			return err
+		}
+		if err := tx.Create(&card).Error; err != nil {
+			return err
+		}
+		if err := setCardAssignees(tx, card.ID, assigneeIDs); err != nil {
+			return err
+		}
+		if err := setCardLabels(tx, card.ID, labelIDs); err != nil {
+			return err
+		}
+		if err := setFieldValues(tx, card.ID, fields); err != nil {
+			return err
+		}
+		if err := recordStatusChange(tx, card.ID, userUUID, "", card.Status); err != nil {
+			return err
+		}
+		if err := logActivity(tx, models.Activity{
+			BoardID:  column.BoardID,
+			ActorID:  userUUID,
+			Entity:   "card",
+			EntityID: card.ID,
+			Action:   "created",
+			Changes:  createdChange("title", card.Title),
+		}); err != nil {
+			return err
+		}
+		rev, err = bumpBoardRevision(tx, column.BoardID)
+		return err
+	})
+	if err != nil {
+		return txError(err, "Failed to create card")
 	}
 
 	// Load relations
-	database.DB.Preload("Assignee").Preload("CreatedBy").First(&card, card.ID)
+	withCardRelations(database.DB).First(&card, card.ID)
+	publishBoardEvent(column.BoardID, rev, ws.TypeCardCreated, card)
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"success": true,
@@ -160,6 +198,40 @@ func CreateCard(c *fiber.Ctx) error {
 	})
 }
 
+// GetCard - получить карточку
+func GetCard(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid user ID",
+		})
+	}
+
+	cardUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid card ID",
+		})
+	}
+
+	card, err := loadCard(cardUUID, userUUID, policy.View)
+	if err != nil {
+		return err
+	}
+	withCardRelations(database.DB).
+		Preload("Checklists", orderByRank).Preload("Checklists.Items", orderByRank).Preload("Checklists.Items.Assignee").
+		First(&card, card.ID)
+
+	setETag(c, card.Version)
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    card,
+	})
+}
+
 // UpdateCard - обновить карточку
 func UpdateCard(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
@@ -180,49 +252,39 @@ func UpdateCard(c *fiber.Ctx) error {
 		})
 	}
 
-	var card models.Card
-	if err := database.DB.Preload("Column.Board").First(&card, cardUUID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"success": false,
-			"error":   "Card not found",
-		})
+	// Check board access
+	card, err := loadCard(cardUUID, userUUID, policy.Edit)
+	if err != nil {
+		return err
 	}
+	database.DB.Model(&card).Association("Assignees").Find(&card.Assignees)
+	database.DB.Model(&card).Association("Labels").Find(&card.Labels)
+	database.DB.Where("card_id = ?", card.ID).Find(&card.FieldValues)
 
-	// Check board access
-	board := card.Column.Board
-	if board.OwnerID != userUUID && !board.IsPublic {
-		if board.WorkspaceID != nil {
-			var member models.WorkspaceMember
-			if err := database.DB.Where("workspace_id = ? AND user_id = ?", board.WorkspaceID, userUUID).First(&member).Error; err != nil {
-				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-					"success": false,
-					"error":   "Access denied",
-				})
-			}
-		} else {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"success": false,
-				"error":   "Access denied",
-			})
-		}
+	ifMatch, err := ifMatchVersion(c)
+	if err != nil {
+		return err
+	}
+	if ifMatch != nil && *ifMatch != card.Version {
+		return versionConflict(c, card, card.Version)
 	}
 
 	var input struct {
-		Title       *string `json:"title"`
-		Description *string `json:"description"`
-		Position    *int    `json:"position"`
-		Color       *string `json:"color"`
-		ColumnID    *string `json:"column_id"`
-		AssigneeID  *string `json:"assignee_id"`
-		DueDate     *string `json:"due_date"`
+		Title       *string   `json:"title"`
+		Description *string   `json:"description"`
+		Color       *string   `json:"color"`
+		ColumnID    *string   `json:"column_id"`
+		AssigneeIDs *[]string `json:"assignee_ids"`
+		LabelIDs    *[]string `json:"label_ids"`
+		DueDate     *string   `json:"due_date"`
 		// CRM Fields
-		LeadName     *string  `json:"lead_name"`
-		ContactEmail *string  `json:"contact_email"`
-		ContactPhone *string  `json:"contact_phone"`
-		Company      *string  `json:"company"`
-		Value        *float64 `json:"value"`
-		Priority     *string  `json:"priority"`
-		Status       *string  `json:"status"`
+		ContactID *string  `json:"contact_id"`
+		CompanyID *string  `json:"company_id"`
+		Value     *float64 `json:"value"`
+		Priority  *string  `json:"priority"`
+		Status    *string  `json:"status"`
+		// Custom field values by field ID; fields left out keep their value
+		CustomFields map[string]json.RawMessage `json:"custom_fields"`
 	}
 
 	if err := c.BodyParser(&input); err != nil {
@@ -232,19 +294,22 @@ func UpdateCard(c *fiber.Ctx) error {
 		})
 	}
 
-	// Update fields
+	// Collect only the fields the client sent
+	updates := map[string]interface{}{}
 	if input.Title != nil {
-		card.Title = *input.Title
+		updates["title"] = *input.Title
 	}
 	if input.Description != nil {
-		card.Description = *input.Description
-	}
-	if input.Position != nil {
-		card.Position = *input.Position
+		updates["description"] = *input.Description
 	}
 	if input.Color != nil {
-		card.Color = *input.Color
+		updates["color"] = *input.Color
 	}
+	// Changing the column moves the card to the end of the new one; use
+	// MoveCard to place it between other cards
+	fromColumnID, fromBoardID, toBoardID := card.ColumnID, card.Column.BoardID, card.Column.BoardID
+	toBoard := card.Column.Board
+	moved := false
 	if input.ColumnID != nil {
 		columnUUID, err := uuid.Parse(*input.ColumnID)
 		if err != nil {
@@ -253,25 +318,55 @@ func UpdateCard(c *fiber.Ctx) error {
 				"error":   "Invalid column ID",
 			})
 		}
-		card.ColumnID = columnUUID
-	}
-	if input.AssigneeID != nil {
-		if *input.AssigneeID == "" {
-			card.AssigneeID = nil
-		} else {
-			assigneeUUID, err := uuid.Parse(*input.AssigneeID)
+		if columnUUID != card.ColumnID {
+			target, err := loadColumn(columnUUID, userUUID, policy.Edit)
 			if err != nil {
-				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-					"success": false,
-					"error":   "Invalid assignee ID",
-				})
+				return err
 			}
-			card.AssigneeID = &assigneeUUID
+			updates["column_id"] = columnUUID
+			toBoardID, toBoard = target.BoardID, target.Board
+			moved = true
+		}
+	}
+	// Assignees and labels are replaced as a whole when sent
+	var assigneeIDs, labelIDs []uuid.UUID
+	setAssignees, setLabels := false, false
+	if input.AssigneeIDs != nil {
+		if assigneeIDs, err = parseIDList(*input.AssigneeIDs, "assignee ID"); err != nil {
+			return err
+		}
+		if !sameIDs(assigneeIDs, cardAssigneeIDs(card)) {
+			if err := checkAssignees(toBoard, assigneeIDs); err != nil {
+				return err
+			}
+			setAssignees = true
+		}
+	}
+	// Assignees who can't see the board the card moves to are dropped
+	if fromBoardID != toBoardID && !setAssignees {
+		current := cardAssigneeIDs(card)
+		kept, err := assignableIDs(toBoard, current)
+		if err != nil {
+			return err
+		}
+		if len(kept) != len(current) {
+			assigneeIDs, setAssignees = kept, true
+		}
+	}
+	if input.LabelIDs != nil {
+		if labelIDs, err = parseIDList(*input.LabelIDs, "label ID"); err != nil {
+			return err
+		}
+		if !sameIDs(labelIDs, cardLabelIDs(card)) {
+			if err := checkLabels(toBoardID, labelIDs); err != nil {
+				return err
+			}
+			setLabels = true
 		}
 	}
 	if input.DueDate != nil {
 		if *input.DueDate == "" {
-			card.DueDate = nil
+			updates["due_date"] = nil
 		} else {
 			parsedDate, err := time.Parse("2006-01-02T15:04:05Z07:00", *input.DueDate)
 			if err != nil {
@@ -280,42 +375,130 @@ func UpdateCard(c *fiber.Ctx) error {
 					"error":   "Invalid due date format",
 				})
 			}
-			card.DueDate = &parsedDate
+			updates["due_date"] = parsedDate
 		}
 	}
-	if input.LeadName != nil {
-		card.LeadName = *input.LeadName
-	}
-	if input.ContactEmail != nil {
-		card.ContactEmail = *input.ContactEmail
-	}
-	if input.ContactPhone != nil {
-		card.ContactPhone = *input.ContactPhone
-	}
-	if input.Company != nil {
-		card.Company = *input.Company
+	if input.ContactID != nil || input.CompanyID != nil {
+		contactID, companyID, setCompany, err := cardContactLinks(toBoard, input.ContactID, input.CompanyID, card.CompanyID)
+		if err != nil {
+			return err
+		}
+		if input.ContactID != nil {
+			updates["contact_id"] = contactID
+		}
+		if setCompany {
+			updates["company_id"] = companyID
+		}
 	}
 	if input.Value != nil {
-		card.Value = *input.Value
+		updates["value"] = *input.Value
 	}
 	if input.Priority != nil {
-		card.Priority = *input.Priority
+		if err := checkEnum(*input.Priority, cardPriorities, "priority"); err != nil {
+			return err
+		}
+		updates["priority"] = *input.Priority
 	}
 	if input.Status != nil {
-		card.Status = *input.Status
+		if err := checkEnum(*input.Status, cardStatuses, "status"); err != nil {
+			return err
+		}
+		updates["status"] = *input.Status
 	}
+	// Custom fields of the board the card ends up on
+	fields, err := parseFieldValues(toBoard, input.CustomFields)
+	if err != nil {
+		return err
+	}
+	fieldsFrom, fieldsTo := fieldValueChanges(card.FieldValues, fields)
+	setFields := len(fieldsTo) > 0
 
-	card.UpdatedAt = time.Now()
-
-	if err := database.DB.Save(&card).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"error":   "Failed to update card",
+	if len(updates) == 0 && !setAssignees && !setLabels && !setFields {
+		setETag(c, card.Version)
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    card,
 		})
 	}
 
+	var revs map[uuid.UUID]int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockBoards(tx, fromBoardID, toBoardID); err != nil {
+			return err
+		}
+		if moved {
+			list := cardList(updates["column_id"].(uuid.UUID))
+			if err := list.lock(tx); err != nil {
+				return err
+			}
+			rank, err := list.place(tx, card.ID, nil, nil)
+			if err != nil {
+				return err
+			}
+			updates["rank"] = rank
+		}
+		changes := fieldChanges(card, updates)
+		if err := updateVersioned(tx, &models.Card{}, card.ID, ifMatch, updates); err != nil {
+			return err
+		}
+		if status, ok := updates["status"].(string); ok && status != card.Status {
+			if err := recordStatusChange(tx, card.ID, userUUID, card.Status, status); err != nil {
+				return err
+			}
+		}
+		if setAssignees {
+			if err := setCardAssignees(tx, card.ID, assigneeIDs); err != nil {
+				return err
+			}
+			changes["assignee_ids"] = models.FieldChange{From: jsonValue(cardAssigneeIDs(card)), To: jsonValue(assigneeIDs)}
+		}
+		if setLabels {
+			if err := setCardLabels(tx, card.ID, labelIDs); err != nil {
+				return err
+			}
+			changes["label_ids"] = models.FieldChange{From: jsonValue(cardLabelIDs(card)), To: jsonValue(labelIDs)}
+		}
+		if setFields {
+			if err := setFieldValues(tx, card.ID, fields); err != nil {
+				return err
+			}
+			changes["custom_fields"] = models.FieldChange{From: fieldsFrom, To: fieldsTo}
+		}
+		if fromBoardID != toBoardID {
+			// Labels are per board, contacts and companies per workspace
+			if err := dropForeignLinks(tx, card.ID, toBoardID); err != nil {
+				return err
+			}
+		}
+		if len(changes) > 0 {
+			action := "updated"
+			if moved {
+				action = "moved"
+			}
+			if err := logCardActivity(tx, card.ID, userUUID, action, changes, fromBoardID, toBoardID); err != nil {
+				return err
+			}
+		}
+		revs, err = bumpBoardRevisions(tx, fromBoardID, toBoardID)
+		return err
+	})
+	if err == errVersionConflict {
+		withCardRelations(database.DB).First(&card, card.ID)
+		return versionConflict(c, card, card.Version)
+	}
+	if err != nil {
+		return txError(err, "Failed to update card")
+	}
+
 	// Load relations
-	database.DB.Preload("Assignee").Preload("CreatedBy").First(&card, card.ID)
+	withCardRelations(database.DB).First(&card, card.ID)
+	if moved {
+		publishCardMoved(card, fromColumnID, fromBoardID, toBoardID, revs)
+	} else {
+		publishBoardEvent(toBoardID, revs[toBoardID], ws.TypeCardUpdated, card)
+	}
+
+	setETag(c, card.Version)
 
 	return c.JSON(fiber.Map{
 		"success": true,
@@ -343,42 +526,232 @@ func DeleteCard(c *fiber.Ctx) error {
 		})
 	}
 
-	var card models.Card
-	if err := database.DB.Preload("Column.Board").First(&card, cardUUID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"success": false,
-			"error":   "Card not found",
-		})
+	// Check access - editors can delete their own cards, board admins any card
+	card, err := loadCard(cardUUID, userUUID, policy.Edit)
+	if err != nil {
+		return err
 	}
-
-	// Check access - user can delete if they created it or are board owner
-	board := card.Column.Board
-	if card.CreatedByID != userUUID && board.OwnerID != userUUID {
-		if board.WorkspaceID != nil {
-			var member models.WorkspaceMember
-			if err := database.DB.Where("workspace_id = ? AND user_id = ? AND role IN ?", board.WorkspaceID, userUUID, []string{"owner", "admin"}).First(&member).Error; err != nil {
-				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-					"success": false,
-					"error":   "Access denied",
-				})
-			}
-		} else {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"success": false,
-				"error":   "Access denied",
-			})
+	if card.CreatedByID != userUUID {
+		if err := authorizeBoard(&card.Column.Board, userUUID, policy.Admin); err != nil {
+			return err
 		}
 	}
 
-	if err := database.DB.Delete(&card).Error; err != nil {
+	var rev int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockBoards(tx, card.Column.BoardID); err != nil {
+			return err
+		}
+		if err := tx.Delete(&card).Error; err != nil {
+			return err
+		}
+		if err := logActivity(tx, models.Activity{
+			BoardID:  card.Column.BoardID,
+			ActorID:  userUUID,
+			Entity:   "card",
+			EntityID: card.ID,
+			Action:   "deleted",
+			Changes:  deletedChange("title", card.Title),
+		}); err != nil {
+			return err
+		}
+		rev, err = bumpBoardRevision(tx, card.Column.BoardID)
+		return err
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"error":   "Failed to delete card",
 		})
 	}
 
+	publishBoardEvent(card.Column.BoardID, rev, ws.TypeCardDeleted, fiber.Map{
+		"card_id":   card.ID,
+		"column_id": card.ColumnID,
+	})
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Card deleted successfully",
 	})
 }
+
+// MoveCard - переместить карточку
+//
+// POST /api/cards/:id/move
+//
+// Places the card in column_id (default: its current column) right after
+// after_id and/or before before_id. With neither the card goes to the end of
+// the column. The target column may be on another board the user can edit.
+func MoveCard(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid user ID",
+		})
+	}
+
+	cardUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid card ID",
+		})
+	}
+
+	var input struct {
+		ColumnID string  `json:"column_id"`
+		AfterID  *string `json:"after_id"`
+		BeforeID *string `json:"before_id"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+	}
+	afterID, err := parseNeighbour(input.AfterID, "after_id")
+	if err != nil {
+		return err
+	}
+	beforeID, err := parseNeighbour(input.BeforeID, "before_id")
+	if err != nil {
+		return err
+	}
+
+	card, err := loadCard(cardUUID, userUUID, policy.Edit)
+	if err != nil {
+		return err
+	}
+
+	// Moving to another column needs edit access to its board as well
+	targetColumnID, targetBoardID := card.ColumnID, card.Column.BoardID
+	targetBoard := card.Column.Board
+	if input.ColumnID != "" {
+		if targetColumnID, err = uuid.Parse(input.ColumnID); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid column ID",
+			})
+		}
+		if targetColumnID != card.ColumnID {
+			target, err := loadColumn(targetColumnID, userUUID, policy.Edit)
+			if err != nil {
+				return err
+			}
+			targetBoardID, targetBoard = target.BoardID, target.Board
+		}
+	}
+
+	// Assignees who can't see the target board are dropped
+	var assigneeIDs, keptAssignees []uuid.UUID
+	dropAssignees := false
+	if targetBoardID != card.Column.BoardID {
+		database.DB.Model(&models.CardAssignee{}).Where("card_id = ?", card.ID).Pluck("user_id", &assigneeIDs)
+		if keptAssignees, err = assignableIDs(targetBoard, assigneeIDs); err != nil {
+			return err
+		}
+		dropAssignees = len(keptAssignees) != len(assigneeIDs)
+	}
+
+	var revs map[uuid.UUID]int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockBoards(tx, card.Column.BoardID, targetBoardID); err != nil {
+			return err
+		}
+		list := cardList(targetColumnID)
+		if err := list.lock(tx); err != nil {
+			return err
+		}
+		rank, err := list.place(tx, card.ID, afterID, beforeID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Card{}).Where("id = ?", card.ID).Updates(map[string]interface{}{
+			"column_id":  targetColumnID,
+			"rank":       rank,
+			"version":    gorm.Expr("version + 1"),
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		if targetBoardID != card.Column.BoardID {
+			// Labels are per board, contacts and companies per workspace
+			if err := dropForeignLinks(tx, card.ID, targetBoardID); err != nil {
+				return err
+			}
+		}
+		var changes models.FieldChanges
+		if targetColumnID != card.ColumnID {
+			changes = models.FieldChanges{"column_id": {From: card.ColumnID, To: targetColumnID}}
+		}
+		if dropAssignees {
+			if err := setCardAssignees(tx, card.ID, keptAssignees); err != nil {
+				return err
+			}
+			changes["assignee_ids"] = models.FieldChange{From: jsonValue(assigneeIDs), To: jsonValue(keptAssignees)}
+		}
+		if err := logCardActivity(tx, card.ID, userUUID, "moved", changes, card.Column.BoardID, targetBoardID); err != nil {
+			return err
+		}
+		revs, err = bumpBoardRevisions(tx, card.Column.BoardID, targetBoardID)
+		return err
+	})
+	if err != nil {
+		return txError(err, "Failed to move card")
+	}
+
+	var moved models.Card
+	withCardRelations(database.DB).First(&moved, "id = ?", card.ID)
+	publishCardMoved(moved, card.ColumnID, card.Column.BoardID, targetBoardID, revs)
+
+	setETag(c, moved.Version)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    moved,
+	})
+}
+
+// publishCardMoved announces a card that changed column to its board and,
+// when it came from another board, tells that board only which card left:
+// its viewers may not have access to the card any more.
+func publishCardMoved(card models.Card, fromColumnID, fromBoardID, toBoardID uuid.UUID, revs map[uuid.UUID]int64) {
+	publishBoardEvent(toBoardID, revs[toBoardID], ws.TypeCardMoved, fiber.Map{"card": card, "from_column_id": fromColumnID})
+	if fromBoardID != toBoardID {
+		publishBoardEvent(fromBoardID, revs[fromBoardID], ws.TypeCardMoved, fiber.Map{"card_id": card.ID, "from_column_id": fromColumnID})
+	}
+}
+
+// logCardActivity records a card change on its board and, for a card that
+// moved between boards, on the board it left as well.
+func logCardActivity(tx *gorm.DB, cardID, actorID uuid.UUID, action string, changes models.FieldChanges, fromBoardID, toBoardID uuid.UUID) error {
+	for _, boardID := range uniqueIDs([]uuid.UUID{toBoardID, fromBoardID}, uuid.Nil) {
+		if err := logActivity(tx, models.Activity{
+			BoardID:  boardID,
+			ActorID:  actorID,
+			Entity:   "card",
+			EntityID: cardID,
+			Action:   action,
+			Changes:  changes,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordStatusChange adds to the card's status history, which the pipeline
+// analytics use for time in stage.
+func recordStatusChange(tx *gorm.DB, cardID, actorID uuid.UUID, from, to string) error {
+	return tx.Create(&models.CardStatusChange{
+		ID:          uuid.New(),
+		CardID:      cardID,
+		FromStatus:  from,
+		ToStatus:    to,
+		ChangedByID: actorID,
+		ChangedAt:   time.Now(),
+	}).Error
+}
@@ -1,12 +1,15 @@
 package handlers
 
 import (
+	"errors"
 	"tether-server/database"
 	"tether-server/models"
+	"tether-server/ws"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // GET /api/chats
@@ -17,7 +20,13 @@ func GetChats(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
 	}
 	var chats []models.Chat
-	if err := database.DB.Where("user1_id = ? OR user2_id = ?", userID, userID).Find(&chats).Error; err != nil {
+	if err := database.DB.Joins("JOIN chat_members ON chat_members.chat_id = chats.id").
+		Where("chat_members.user_id = ?", userID).
+		Preload("Members.User").
+		Find(&chats).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to get chats"})
+	}
+	if err := fillUnreadCounts(userID, chats); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to get chats"})
 	}
 	return c.JSON(fiber.Map{"success": true, "data": chats})
@@ -31,32 +40,91 @@ func CreateChat(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
 	}
 	var input struct {
+		Type string `json:"type"` // 'direct' (default) or 'group'
+		// Direct chats
 		OtherUserID uuid.UUID `json:"other_user_id"`
+		// Group chats
+		Title     string      `json:"title"`
+		AvatarURL string      `json:"avatar_url"`
+		MemberIDs []uuid.UUID `json:"member_ids"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
 	}
-	if err := c.BodyParser(&input); err != nil || input.OtherUserID == uuid.Nil {
+	switch input.Type {
+	case "", "direct":
+		return createDirectChat(c, userID, input.OtherUserID)
+	case "group":
+		return createGroupChat(c, userID, input.Title, input.AvatarURL, input.MemberIDs)
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid chat type"})
+	}
+}
+
+func createDirectChat(c *fiber.Ctx, userID, otherUserID uuid.UUID) error {
+	if otherUserID == uuid.Nil || otherUserID == userID {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
 	}
+	if !usersExist([]uuid.UUID{otherUserID}) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "User not found"})
+	}
 	// Проверка на существование чата
 	var chat models.Chat
-	if err := database.DB.Where(
-		"(user1_id = ? AND user2_id = ?) OR (user1_id = ? AND user2_id = ?)",
-		userID, input.OtherUserID, input.OtherUserID, userID,
-	).First(&chat).Error; err == nil {
+	if err := database.DB.Joins("JOIN chat_members m1 ON m1.chat_id = chats.id AND m1.user_id = ?", userID).
+		Joins("JOIN chat_members m2 ON m2.chat_id = chats.id AND m2.user_id = ?", otherUserID).
+		Where("chats.type = ?", "direct").
+		Preload("Members.User").
+		First(&chat).Error; err == nil {
 		return c.JSON(fiber.Map{"success": true, "data": chat})
 	}
 	// Создать новый чат
+	now := time.Now()
 	newChat := models.Chat{
-		ID:        uuid.New(),
-		User1ID:   userID,
-		User2ID:   input.OtherUserID,
-		CreatedAt: time.Now(),
+		ID:          uuid.New(),
+		Type:        "direct",
+		CreatedByID: userID,
+		CreatedAt:   now,
+		Members: []models.ChatMember{
+			{ID: uuid.New(), UserID: userID, Role: "member", JoinedAt: now},
+			{ID: uuid.New(), UserID: otherUserID, Role: "member", JoinedAt: now},
+		},
 	}
 	if err := database.DB.Create(&newChat).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to create chat"})
 	}
+	database.DB.Preload("Members.User").First(&newChat, "id = ?", newChat.ID)
 	return c.JSON(fiber.Map{"success": true, "data": newChat})
 }
 
+func createGroupChat(c *fiber.Ctx, userID uuid.UUID, title, avatarURL string, memberIDs []uuid.UUID) error {
+	if title == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Title is required for group chats"})
+	}
+	memberIDs = uniqueIDs(memberIDs, userID)
+	if !usersExist(memberIDs) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "User not found"})
+	}
+	now := time.Now()
+	chat := models.Chat{
+		ID:          uuid.New(),
+		Type:        "group",
+		Title:       title,
+		AvatarURL:   avatarURL,
+		CreatedByID: userID,
+		CreatedAt:   now,
+		Members:     []models.ChatMember{{ID: uuid.New(), UserID: userID, Role: "owner", JoinedAt: now}},
+	}
+	for _, id := range memberIDs {
+		chat.Members = append(chat.Members, models.ChatMember{ID: uuid.New(), UserID: id, Role: "member", JoinedAt: now})
+	}
+	if err := database.DB.Create(&chat).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to create chat"})
+	}
+	postSystemMessage(chat.ID, userID, "chat.created", nil)
+	database.DB.Preload("Members.User").First(&chat, "id = ?", chat.ID)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "data": chat})
+}
+
 // GET /api/chats/:chatId
 func GetChat(c *fiber.Ctx) error {
 	userIDStr := c.Locals("user_id").(string)
@@ -68,15 +136,29 @@ func GetChat(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid chat ID"})
 	}
-	// Check access and get chat with users
-	var chat models.Chat
-	if err := database.DB.Preload("User1").Preload("User2").Where("id = ? AND (user1_id = ? OR user2_id = ?)", chatID, userID, userID).First(&chat).Error; err != nil {
+	// Check access and get chat with members
+	chat, err := findChatForUser(chatID, userID)
+	if err != nil {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Access denied"})
 	}
-	return c.JSON(fiber.Map{"success": true, "data": chat})
+	database.DB.Preload("Members.User").First(&chat, "id = ?", chat.ID)
+	chats := []models.Chat{chat}
+	fillUnreadCounts(userID, chats)
+	return c.JSON(fiber.Map{"success": true, "data": chats[0]})
 }
 
+// Message history page sizes
+const (
+	defaultMessagePageSize = 50
+	maxMessagePageSize     = 100
+)
+
 // GET /api/chats/:chatId/messages
+//
+// Keyset pagination on (created_at, id). Without a cursor the latest page is
+// returned. before=<messageId> / after=<messageId> page older / newer
+// messages, around=<messageId> returns a window centred on that message.
+// Messages are always returned oldest first.
 func GetMessages(c *fiber.Ctx) error {
 	userIDStr := c.Locals("user_id").(string)
 	userID, err := uuid.Parse(userIDStr)
@@ -88,15 +170,140 @@ func GetMessages(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid chat ID"})
 	}
 	// Проверка доступа
-	var chat models.Chat
-	if err := database.DB.Where("id = ? AND (user1_id = ? OR user2_id = ?)", chatID, userID, userID).First(&chat).Error; err != nil {
+	if _, err := findChatForUser(chatID, userID); err != nil {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Access denied"})
 	}
+
+	limit := c.QueryInt("limit", defaultMessagePageSize)
+	if limit <= 0 {
+		limit = defaultMessagePageSize
+	}
+	if limit > maxMessagePageSize {
+		limit = maxMessagePageSize
+	}
+
+	mode, cursorID := "", ""
+	for _, key := range []string{"before", "after", "around"} {
+		if value := c.Query(key); value != "" {
+			if mode != "" {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Only one of before, after or around may be set"})
+			}
+			mode, cursorID = key, value
+		}
+	}
+
+	var cursor *models.Message
+	if mode != "" {
+		id, err := uuid.Parse(cursorID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid cursor"})
+		}
+		// Messages the caller deleted for themselves can't be paged from
+		cursor = &models.Message{}
+		if err := visibleMessages(chatID, userID).Where("id = ?", id).First(cursor).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Message not found"})
+		}
+	}
+
 	var messages []models.Message
-	if err := database.DB.Where("chat_id = ?", chatID).Order("created_at asc").Find(&messages).Error; err != nil {
+	var hasMoreBefore, hasMoreAfter bool
+	switch mode {
+	case "", "before":
+		messages, hasMoreBefore, err = messagesBefore(chatID, userID, cursor, limit)
+	case "after":
+		messages, hasMoreAfter, err = messagesAfter(chatID, userID, cursor, limit)
+	case "around":
+		var older, newer []models.Message
+		older, hasMoreBefore, err = messagesBefore(chatID, userID, cursor, limit/2)
+		if err == nil {
+			newer, hasMoreAfter, err = messagesAfter(chatID, userID, cursor, limit-limit/2-1)
+		}
+		messages = append(append(older, *cursor), newer...)
+	}
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to get messages"})
 	}
-	return c.JSON(fiber.Map{"success": true, "data": messages})
+	page := make([]*models.Message, len(messages))
+	for i := range messages {
+		page[i] = &messages[i]
+	}
+	fillMessagePreviews(page)
+	fillReactions(page, userID)
+	fillAttachments(page)
+
+	response := fiber.Map{"success": true, "data": messages}
+	switch mode {
+	case "", "before":
+		response["has_more"] = hasMoreBefore
+	case "after":
+		response["has_more"] = hasMoreAfter
+	case "around":
+		response["has_more"] = hasMoreBefore || hasMoreAfter
+		response["has_more_before"] = hasMoreBefore
+		response["has_more_after"] = hasMoreAfter
+	}
+	return c.JSON(response)
+}
+
+// visibleMessages scopes a query to the chat's messages that userID has not
+// deleted for themselves. Messages deleted for everyone stay as tombstones so
+// the history keeps its order.
+func visibleMessages(chatID, userID uuid.UUID) *gorm.DB {
+	return database.DB.Model(&models.Message{}).
+		Where("chat_id = ?", chatID).
+		Where("NOT EXISTS (SELECT 1 FROM message_hides h WHERE h.message_id = messages.id AND h.user_id = ?)", userID)
+}
+
+// messagesBefore returns up to limit messages older than cursor (or the
+// latest messages when cursor is nil), oldest first, and whether older
+// messages remain.
+func messagesBefore(chatID, userID uuid.UUID, cursor *models.Message, limit int) ([]models.Message, bool, error) {
+	messages := []models.Message{}
+	if limit <= 0 {
+		return messages, cursor != nil && messageExists(chatID, userID, "(created_at, id) < (?, ?)", cursor), nil
+	}
+	q := visibleMessages(chatID, userID)
+	if cursor != nil {
+		q = q.Where("(created_at, id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+	}
+	if err := q.Order("created_at desc, id desc").Limit(limit + 1).Find(&messages).Error; err != nil {
+		return nil, false, err
+	}
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, hasMore, nil
+}
+
+// messagesAfter returns up to limit messages newer than cursor, oldest first,
+// and whether newer messages remain.
+func messagesAfter(chatID, userID uuid.UUID, cursor *models.Message, limit int) ([]models.Message, bool, error) {
+	messages := []models.Message{}
+	if limit <= 0 {
+		return messages, messageExists(chatID, userID, "(created_at, id) > (?, ?)", cursor), nil
+	}
+	if err := visibleMessages(chatID, userID).
+		Where("(created_at, id) > (?, ?)", cursor.CreatedAt, cursor.ID).
+		Order("created_at asc, id asc").Limit(limit + 1).Find(&messages).Error; err != nil {
+		return nil, false, err
+	}
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	return messages, hasMore, nil
+}
+
+// messageExists reports whether any visible message in the chat matches the
+// keyset condition relative to cursor.
+func messageExists(chatID, userID uuid.UUID, condition string, cursor *models.Message) bool {
+	var count int64
+	visibleMessages(chatID, userID).Where(condition, cursor.CreatedAt, cursor.ID).Limit(1).Count(&count)
+	return count > 0
 }
 
 // POST /api/messages
@@ -108,39 +315,228 @@ func SendMessage(c *fiber.Ctx) error {
 	}
 	var input struct {
 		ChatID uuid.UUID `json:"chat_id"`
-		// One of the following must be provided:
-		Content      string `json:"content"`
-		Ciphertext   string `json:"ciphertext"`
-		Nonce        string `json:"nonce"`
-		Alg          string `json:"alg"`
-		EphemeralPub string `json:"ephemeral_pub"`
+		messageInput
 	}
 	if err := c.BodyParser(&input); err != nil || input.ChatID == uuid.Nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
 	}
 	// Проверка доступа
-	var chat models.Chat
-	if err := database.DB.Where("id = ? AND (user1_id = ? OR user2_id = ?)", input.ChatID, userID, userID).First(&chat).Error; err != nil {
+	chat, err := findChatForUser(input.ChatID, userID)
+	if err != nil {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Access denied"})
 	}
-	if input.Ciphertext == "" && input.Content == "" {
+
+	msg, created, err := createMessage(chat, userID, input.messageInput)
+	if err == errEmptyMessage {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Empty message"})
 	}
+	if err == errInvalidReply {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Reply target must be a message in the same chat"})
+	}
+	if err == errInvalidAttachment {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Attachments must be completed uploads of yours in the same chat"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to send message"})
+	}
+	// Доставляем сообщение собеседнику по WebSocket
+	if created {
+		ws.Publish(otherParticipants(chat.ID, userID), ws.TypeMessageNew, chat.ID, msg)
+	}
+	return c.JSON(fiber.Map{"success": true, "data": msg})
+}
 
-	msg := models.Message{
+var (
+	errEmptyMessage = errors.New("empty message")
+	errInvalidReply = errors.New("reply target must be a message in the same chat")
+)
+
+// Length of the content excerpt in message previews, in characters
+const messagePreviewLength = 200
+
+// messageInput is the client-supplied part of a new message, shared by
+// SendMessage and the WebSocket message.new event.
+type messageInput struct {
+	// Optional client-generated id that makes re-sends idempotent.
+	ClientID string `json:"client_id"`
+	// One of the following must be provided:
+	Content      string `json:"content"`
+	Ciphertext   string `json:"ciphertext"`
+	Nonce        string `json:"nonce"`
+	Alg          string `json:"alg"`
+	EphemeralPub string `json:"ephemeral_pub"`
+	// Optional message in the same chat this one replies to
+	ReplyToMessageID *uuid.UUID `json:"reply_to_message_id"`
+	// Completed uploads to send with the message; with attachments the
+	// text may be empty
+	AttachmentIDs []uuid.UUID `json:"attachment_ids"`
+
+	// Set by ForwardMessage, never by clients
+	forwardedFrom *models.Message
+}
+
+// createMessage stores a message from userID in chat. If the sender has
+// already stored a message with the same client id in this chat, that
+// message is returned and created is false.
+func createMessage(chat models.Chat, userID uuid.UUID, input messageInput) (msg models.Message, created bool, err error) {
+	attachmentIDs := uniqueIDs(input.AttachmentIDs, uuid.Nil)
+	if input.Ciphertext == "" && input.Content == "" && len(attachmentIDs) == 0 &&
+		(input.forwardedFrom == nil || !hasPlainAttachments(input.forwardedFrom.ID)) {
+		return msg, false, errEmptyMessage
+	}
+	if len(attachmentIDs) > maxMessageAttachments {
+		return msg, false, errInvalidAttachment
+	}
+
+	var clientID *string
+	if input.ClientID != "" {
+		clientID = &input.ClientID
+		if err := database.DB.Where("chat_id = ? AND sender_id = ? AND client_id = ?", chat.ID, userID, input.ClientID).First(&msg).Error; err == nil {
+			fillMessagePreviews([]*models.Message{&msg})
+			fillAttachments([]*models.Message{&msg})
+			return msg, false, nil
+		}
+	}
+	if input.ReplyToMessageID != nil {
+		var count int64
+		database.DB.Model(&models.Message{}).Where("id = ? AND chat_id = ?", *input.ReplyToMessageID, chat.ID).Count(&count)
+		if count == 0 {
+			return msg, false, errInvalidReply
+		}
+	}
+
+	msg = models.Message{
 		ID:           uuid.New(),
-		ChatID:       input.ChatID,
+		ChatID:       chat.ID,
 		SenderID:     userID,
+		ClientID:     clientID,
+		Type:         "text",
 		Content:      input.Content,
 		Ciphertext:   input.Ciphertext,
 		Nonce:        input.Nonce,
 		Alg:          input.Alg,
 		EphemeralPub: input.EphemeralPub,
 		CreatedAt:    time.Now(),
-		IsRead:       false,
+
+		ReplyToMessageID: input.ReplyToMessageID,
 	}
-	if err := database.DB.Create(&msg).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to send message"})
+	if input.forwardedFrom != nil {
+		msg.ForwardedFromMessageID = &input.forwardedFrom.ID
+		msg.ForwardedFromSenderID = &input.forwardedFrom.SenderID
+		// Forwarding a forward keeps pointing at the original author
+		if input.forwardedFrom.ForwardedFromSenderID != nil {
+			msg.ForwardedFromSenderID = input.forwardedFrom.ForwardedFromSenderID
+		}
 	}
-	return c.JSON(fiber.Map{"success": true, "data": msg})
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&msg).Error; err != nil {
+			return err
+		}
+		if input.forwardedFrom != nil {
+			if err := copyAttachments(tx, msg, input.forwardedFrom.ID); err != nil {
+				return err
+			}
+		}
+		return attachToMessage(tx, msg, attachmentIDs)
+	})
+	if err == errInvalidAttachment {
+		return msg, false, err
+	}
+	if err != nil {
+		// A concurrent re-send with the same client id may have won the race.
+		if clientID != nil && database.DB.Where("chat_id = ? AND sender_id = ? AND client_id = ?", chat.ID, userID, input.ClientID).First(&msg).Error == nil {
+			fillMessagePreviews([]*models.Message{&msg})
+			fillAttachments([]*models.Message{&msg})
+			return msg, false, nil
+		}
+		return msg, false, err
+	}
+	fillMessagePreviews([]*models.Message{&msg})
+	fillAttachments([]*models.Message{&msg})
+	return msg, true, nil
+}
+
+// fillMessagePreviews attaches a preview of the replied-to message to each
+// reply. Reply targets always live in the same chat, so no further access
+// check is needed.
+func fillMessagePreviews(messages []*models.Message) {
+	var ids []uuid.UUID
+	for _, msg := range messages {
+		if msg.ReplyToMessageID != nil {
+			ids = append(ids, *msg.ReplyToMessageID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	var targets []models.Message
+	database.DB.Where("id IN ?", ids).Find(&targets)
+	previews := make(map[uuid.UUID]*models.MessagePreview, len(targets))
+	for _, t := range targets {
+		preview := &models.MessagePreview{
+			ID:        t.ID,
+			SenderID:  t.SenderID,
+			Encrypted: t.Ciphertext != "",
+			Deleted:   t.DeletedAt != nil,
+			CreatedAt: t.CreatedAt,
+		}
+		if content := []rune(t.Content); len(content) > messagePreviewLength {
+			preview.Content = string(content[:messagePreviewLength]) + "…"
+		} else {
+			preview.Content = t.Content
+		}
+		previews[t.ID] = preview
+	}
+	for _, msg := range messages {
+		if msg.ReplyToMessageID != nil {
+			msg.ReplyTo = previews[*msg.ReplyToMessageID]
+		}
+	}
+}
+
+// findChatForUser loads a chat the user is a member of. It is the single
+// access check for every chat and message handler.
+func findChatForUser(chatID, userID uuid.UUID) (models.Chat, error) {
+	var chat models.Chat
+	err := database.DB.Joins("JOIN chat_members ON chat_members.chat_id = chats.id AND chat_members.user_id = ?", userID).
+		Where("chats.id = ?", chatID).
+		First(&chat).Error
+	return chat, err
+}
+
+// chatMemberIDs returns the ids of every member of the chat.
+func chatMemberIDs(chatID uuid.UUID) []uuid.UUID {
+	var ids []uuid.UUID
+	database.DB.Model(&models.ChatMember{}).Where("chat_id = ?", chatID).Pluck("user_id", &ids)
+	return ids
+}
+
+// otherParticipants returns the chat members except userID.
+func otherParticipants(chatID, userID uuid.UUID) []uuid.UUID {
+	var ids []uuid.UUID
+	database.DB.Model(&models.ChatMember{}).Where("chat_id = ? AND user_id <> ?", chatID, userID).Pluck("user_id", &ids)
+	return ids
+}
+
+// uniqueIDs drops duplicates, nil ids and exclude from ids.
+func uniqueIDs(ids []uuid.UUID, exclude uuid.UUID) []uuid.UUID {
+	seen := map[uuid.UUID]bool{uuid.Nil: true, exclude: true}
+	result := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// usersExist reports whether every id belongs to an existing user.
+func usersExist(ids []uuid.UUID) bool {
+	if len(ids) == 0 {
+		return true
+	}
+	var count int64
+	database.DB.Model(&models.User{}).Where("id IN ?", ids).Count(&count)
+	return count == int64(len(ids))
 }
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"log"
+	"tether-server/database"
+	"tether-server/models"
+	"tether-server/ws"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// chatRoleRank orders chat roles so that a member may only manage members
+// ranked strictly below them.
+var chatRoleRank = map[string]int{"member": 1, "admin": 2, "owner": 3}
+
+// loadGroupMembership resolves the chat id from the route, checks that it is
+// a group chat and returns the caller's membership in it. Errors are
+// *fiber.Error values rendered by the app's error handler.
+func loadGroupMembership(c *fiber.Ctx) (models.Chat, models.ChatMember, error) {
+	var chat models.Chat
+	var member models.ChatMember
+
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return chat, member, fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+	}
+	chatID, err := uuid.Parse(c.Params("chatId"))
+	if err != nil {
+		return chat, member, fiber.NewError(fiber.StatusBadRequest, "Invalid chat ID")
+	}
+	if chat, err = findChatForUser(chatID, userID); err != nil {
+		return chat, member, fiber.NewError(fiber.StatusForbidden, "Access denied")
+	}
+	if chat.Type != "group" {
+		return chat, member, fiber.NewError(fiber.StatusBadRequest, "Not a group chat")
+	}
+	if err := database.DB.Where("chat_id = ? AND user_id = ?", chatID, userID).First(&member).Error; err != nil {
+		return chat, member, fiber.NewError(fiber.StatusForbidden, "Access denied")
+	}
+	return chat, member, nil
+}
+
+// PUT /api/chats/:chatId
+func UpdateChat(c *fiber.Ctx) error {
+	chat, me, err := loadGroupMembership(c)
+	if err != nil {
+		return err
+	}
+	if chatRoleRank[me.Role] < chatRoleRank["admin"] {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Only chat admins can update the chat"})
+	}
+	var input struct {
+		Title     *string `json:"title"`
+		AvatarURL *string `json:"avatar_url"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+	updates := map[string]interface{}{"updated_at": time.Now()}
+	if input.Title != nil {
+		if *input.Title == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Title is required for group chats"})
+		}
+		updates["title"] = *input.Title
+	}
+	if input.AvatarURL != nil {
+		updates["avatar_url"] = *input.AvatarURL
+	}
+	if err := database.DB.Model(&chat).Updates(updates).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to update chat"})
+	}
+	postSystemMessage(chat.ID, me.UserID, "chat.updated", nil)
+	database.DB.Preload("Members.User").First(&chat, "id = ?", chat.ID)
+	return c.JSON(fiber.Map{"success": true, "data": chat})
+}
+
+// POST /api/chats/:chatId/members
+func AddChatMembers(c *fiber.Ctx) error {
+	chat, me, err := loadGroupMembership(c)
+	if err != nil {
+		return err
+	}
+	if chatRoleRank[me.Role] < chatRoleRank["admin"] {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Only chat admins can add members"})
+	}
+	var input struct {
+		UserIDs []uuid.UUID `json:"user_ids"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+	userIDs := uniqueIDs(input.UserIDs, me.UserID)
+	if len(userIDs) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "user_ids are required"})
+	}
+	if !usersExist(userIDs) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "User not found"})
+	}
+
+	var existing []uuid.UUID
+	database.DB.Model(&models.ChatMember{}).Where("chat_id = ? AND user_id IN ?", chat.ID, userIDs).Pluck("user_id", &existing)
+	isMember := make(map[uuid.UUID]bool, len(existing))
+	for _, id := range existing {
+		isMember[id] = true
+	}
+
+	now := time.Now()
+	var added []uuid.UUID
+	for _, id := range userIDs {
+		if isMember[id] {
+			continue
+		}
+		member := models.ChatMember{ID: uuid.New(), ChatID: chat.ID, UserID: id, Role: "member", JoinedAt: now}
+		if err := database.DB.Create(&member).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to add member"})
+		}
+		added = append(added, id)
+	}
+	for i := range added {
+		postSystemMessage(chat.ID, me.UserID, "member.added", &added[i])
+	}
+
+	database.DB.Preload("Members.User").First(&chat, "id = ?", chat.ID)
+	return c.JSON(fiber.Map{"success": true, "data": chat})
+}
+
+// DELETE /api/chats/:chatId/members/:userId
+func RemoveChatMember(c *fiber.Ctx) error {
+	chat, me, err := loadGroupMembership(c)
+	if err != nil {
+		return err
+	}
+	targetID, err := uuid.Parse(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	if targetID == me.UserID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Use leave to remove yourself"})
+	}
+	var target models.ChatMember
+	if err := database.DB.Where("chat_id = ? AND user_id = ?", chat.ID, targetID).First(&target).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Member not found"})
+	}
+	if chatRoleRank[me.Role] < chatRoleRank["admin"] || chatRoleRank[me.Role] <= chatRoleRank[target.Role] {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Access denied"})
+	}
+	if err := database.DB.Delete(&target).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to remove member"})
+	}
+	postSystemMessage(chat.ID, me.UserID, "member.removed", &targetID)
+	return c.JSON(fiber.Map{"success": true, "message": "Member removed successfully"})
+}
+
+// PUT /api/chats/:chatId/members/:userId/role
+func UpdateChatMemberRole(c *fiber.Ctx) error {
+	chat, me, err := loadGroupMembership(c)
+	if err != nil {
+		return err
+	}
+	if me.Role != "owner" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Only the chat owner can change roles"})
+	}
+	targetID, err := uuid.Parse(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := c.BodyParser(&input); err != nil || (input.Role != "admin" && input.Role != "member") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Role must be 'admin' or 'member'"})
+	}
+	var target models.ChatMember
+	if err := database.DB.Where("chat_id = ? AND user_id = ?", chat.ID, targetID).First(&target).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Member not found"})
+	}
+	if target.Role == "owner" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Cannot change the owner's role"})
+	}
+	if target.Role == input.Role {
+		return c.JSON(fiber.Map{"success": true, "data": target})
+	}
+	if err := database.DB.Model(&target).Update("role", input.Role).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to update role"})
+	}
+	event := "member.promoted"
+	if input.Role == "member" {
+		event = "member.demoted"
+	}
+	postSystemMessage(chat.ID, me.UserID, event, &targetID)
+	return c.JSON(fiber.Map{"success": true, "data": target})
+}
+
+// POST /api/chats/:chatId/leave
+func LeaveChat(c *fiber.Ctx) error {
+	chat, me, err := loadGroupMembership(c)
+	if err != nil {
+		return err
+	}
+
+	chatDeleted := false
+	var objectKeys []string
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&me).Error; err != nil {
+			return err
+		}
+		if me.Role != "owner" {
+			return nil
+		}
+		// Hand ownership to the longest-serving admin, or failing that the longest-serving member
+		var successor models.ChatMember
+		err := tx.Where("chat_id = ?", chat.ID).
+			Order("CASE role WHEN 'admin' THEN 0 ELSE 1 END").Order("joined_at asc").
+			First(&successor).Error
+		if err == gorm.ErrRecordNotFound {
+			chatDeleted = true
+			if objectKeys, err = deleteAttachments(tx, "chat_id = ?", chat.ID); err != nil {
+				return err
+			}
+			if err := tx.Where("chat_id = ?", chat.ID).Delete(&models.Message{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&chat).Error
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Model(&successor).Update("role", "owner").Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to leave chat"})
+	}
+	removeUnreferencedObjects(objectKeys)
+	if !chatDeleted {
+		postSystemMessage(chat.ID, me.UserID, "member.left", &me.UserID)
+	}
+	return c.JSON(fiber.Map{"success": true, "message": "Left chat successfully"})
+}
+
+// postSystemMessage records a membership event in the chat history and
+// pushes it to current members, plus the affected user if they were removed.
+func postSystemMessage(chatID, actorID uuid.UUID, event string, targetID *uuid.UUID) {
+	msg := models.Message{
+		ID:           uuid.New(),
+		ChatID:       chatID,
+		SenderID:     actorID,
+		Type:         "system",
+		TargetUserID: targetID,
+		Content:      event,
+		CreatedAt:    time.Now(),
+	}
+	if err := database.DB.Create(&msg).Error; err != nil {
+		log.Printf("Failed to create system message: %v", err)
+		return
+	}
+	recipients := chatMemberIDs(chatID)
+	if targetID != nil && (event == "member.removed" || event == "member.left") {
+		recipients = append(recipients, *targetID)
+	}
+	ws.Publish(recipients, ws.TypeMessageNew, chatID, msg)
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"tether-server/database"
+	"tether-server/models"
+	"tether-server/ws"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var errMessageNotFound = errors.New("message not found")
+
+// POST /api/chats/:chatId/read
+//
+// Moves the caller's read cursor to message_id, or to the latest message when
+// message_id is omitted. The cursor never moves backwards.
+func MarkChatRead(c *fiber.Ctx) error {
+	userIDStr := c.Locals("user_id").(string)
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	chatID, err := uuid.Parse(c.Params("chatId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid chat ID"})
+	}
+	var input struct {
+		MessageID uuid.UUID `json:"message_id"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+		}
+	}
+	chat, err := findChatForUser(chatID, userID)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Access denied"})
+	}
+
+	member, err := markChatRead(chat, userID, input.MessageID)
+	if err == errMessageNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Message not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to mark chat as read"})
+	}
+	return c.JSON(fiber.Map{"success": true, "data": member})
+}
+
+// markChatRead advances the user's read cursor in chat to messageID (or the
+// latest message when messageID is uuid.Nil) and notifies the other members
+// with a read event. Older messages leave the cursor unchanged.
+func markChatRead(chat models.Chat, userID, messageID uuid.UUID) (models.ChatMember, error) {
+	var member models.ChatMember
+	if err := database.DB.Where("chat_id = ? AND user_id = ?", chat.ID, userID).First(&member).Error; err != nil {
+		return member, err
+	}
+
+	var target models.Message
+	q := database.DB.Where("chat_id = ?", chat.ID)
+	if messageID != uuid.Nil {
+		q = q.Where("id = ?", messageID)
+	}
+	if err := q.Order("created_at desc, id desc").First(&target).Error; err != nil {
+		if err == gorm.ErrRecordNotFound && messageID == uuid.Nil {
+			// Empty chat: nothing to read
+			return member, nil
+		}
+		return member, errMessageNotFound
+	}
+
+	if member.LastReadMessageID != nil {
+		var current models.Message
+		if err := database.DB.First(&current, "id = ?", *member.LastReadMessageID).Error; err == nil {
+			if !messageIsAfter(target, current) {
+				return member, nil
+			}
+		}
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(&member).Updates(map[string]interface{}{
+		"last_read_message_id": target.ID,
+		"last_read_at":         now,
+	}).Error; err != nil {
+		return member, err
+	}
+	member.LastReadMessageID = &target.ID
+	member.LastReadAt = &now
+
+	ws.Publish(otherParticipants(chat.ID, userID), ws.TypeRead, chat.ID, fiber.Map{
+		"user_id":    userID,
+		"message_id": target.ID,
+		"read_at":    now,
+	})
+	return member, nil
+}
+
+// messageIsAfter reports whether a sorts after b in (created_at, id) order.
+func messageIsAfter(a, b models.Message) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	return a.ID.String() > b.ID.String()
+}
+
+// fillUnreadCounts sets UnreadCount on each chat: messages from other members
+// newer than the user's read cursor that the user has not hidden.
+func fillUnreadCounts(userID uuid.UUID, chats []models.Chat) error {
+	if len(chats) == 0 {
+		return nil
+	}
+	chatIDs := make([]uuid.UUID, len(chats))
+	for i, chat := range chats {
+		chatIDs[i] = chat.ID
+	}
+
+	var rows []struct {
+		ChatID uuid.UUID
+		Count  int64
+	}
+	if err := database.DB.Table("messages AS m").
+		Select("m.chat_id, COUNT(*) AS count").
+		Joins("JOIN chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id = ?", userID).
+		Joins("LEFT JOIN messages lr ON lr.id = cm.last_read_message_id").
+		Where("m.chat_id IN ? AND m.sender_id <> ? AND m.type = ? AND m.deleted_at IS NULL", chatIDs, userID, "text").
+		Where("lr.id IS NULL OR (m.created_at, m.id) > (lr.created_at, lr.id)").
+		Where("NOT EXISTS (SELECT 1 FROM message_hides h WHERE h.message_id = m.id AND h.user_id = ?)", userID).
+		Group("m.chat_id").
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	counts := make(map[uuid.UUID]int64, len(rows))
+	for _, row := range rows {
+		counts[row.ChatID] = row.Count
+	}
+	for i := range chats {
+		chats[i].UnreadCount = counts[chats[i].ID]
+	}
+	return nil
+}
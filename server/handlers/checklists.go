@@ -0,0 +1,599 @@
+package handlers
+
+import (
+	"strings"
+	"tether-server/database"
+	"tether-server/models"
+	"tether-server/policy"
+	"tether-server/ws"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Longest checklist or item title, in bytes
+const maxChecklistTitleLength = 500
+
+// loadChecklist loads a checklist with its card, column and board for a
+// caller who needs required on that board.
+func loadChecklist(checklistID, userID uuid.UUID, required policy.Permission) (models.Checklist, error) {
+	var checklist models.Checklist
+	if err := database.DB.Preload("Card.Column.Board").First(&checklist, "id = ?", checklistID).Error; err != nil {
+		return checklist, fiber.NewError(fiber.StatusNotFound, "Checklist not found")
+	}
+	// Checklists of deleted cards are gone with them
+	if checklist.Card.ID == uuid.Nil {
+		return checklist, fiber.NewError(fiber.StatusNotFound, "Checklist not found")
+	}
+	return checklist, authorizeBoard(&checklist.Card.Column.Board, userID, required)
+}
+
+// loadChecklistItem loads an item with its checklist, card, column and board
+// for a caller who needs required on that board.
+func loadChecklistItem(itemID, userID uuid.UUID, required policy.Permission) (models.ChecklistItem, error) {
+	var item models.ChecklistItem
+	if err := database.DB.Preload("Checklist.Card.Column.Board").First(&item, "id = ?", itemID).Error; err != nil {
+		return item, fiber.NewError(fiber.StatusNotFound, "Checklist item not found")
+	}
+	if item.Checklist.ID == uuid.Nil || item.Checklist.Card.ID == uuid.Nil {
+		return item, fiber.NewError(fiber.StatusNotFound, "Checklist item not found")
+	}
+	return item, authorizeBoard(&item.Checklist.Card.Column.Board, userID, required)
+}
+
+// loadChecklistForResponse reloads a checklist with its items in order.
+func loadChecklistForResponse(id uuid.UUID) models.Checklist {
+	var checklist models.Checklist
+	database.DB.Preload("Items", orderByRank).Preload("Items.Assignee").First(&checklist, "id = ?", id)
+	return checklist
+}
+
+func loadChecklistItemForResponse(id uuid.UUID) models.ChecklistItem {
+	var item models.ChecklistItem
+	database.DB.Preload("Assignee").First(&item, "id = ?", id)
+	return item
+}
+
+// checklistTitle trims and validates a checklist or item title.
+func checklistTitle(title string) (string, error) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Title is required")
+	}
+	if len(title) > maxChecklistTitleLength {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Title is too long")
+	}
+	return title, nil
+}
+
+// itemAssignee parses an optional assignee_id; "" clears it. Assignees
+// follow the same rules as card assignees.
+func itemAssignee(board models.Board, s string) (*uuid.UUID, error) {
+	if s == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid assignee ID")
+	}
+	if err := checkAssignees(board, []uuid.UUID{id}); err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// itemDueDate parses an optional due_date; "" clears it.
+func itemDueDate(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse("2006-01-02T15:04:05Z07:00", s)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid due date format")
+	}
+	return &t, nil
+}
+
+// GET /api/cards/:id/checklists
+func GetCardChecklists(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	cardID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid card ID"})
+	}
+	if _, err := loadCard(cardID, userID, policy.View); err != nil {
+		return err
+	}
+
+	checklists := []models.Checklist{}
+	if err := database.DB.Where("card_id = ?", cardID).Order(rankOrder).
+		Preload("Items", orderByRank).Preload("Items.Assignee").Find(&checklists).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to get checklists"})
+	}
+	return c.JSON(fiber.Map{"success": true, "data": checklists})
+}
+
+// POST /api/cards/:id/checklists
+//
+// Adds a named checklist at the end of the card's checklists.
+func CreateChecklist(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	cardID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid card ID"})
+	}
+
+	var input struct {
+		Title string `json:"title"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+	title, err := checklistTitle(input.Title)
+	if err != nil {
+		return err
+	}
+
+	card, err := loadCard(cardID, userID, policy.Edit)
+	if err != nil {
+		return err
+	}
+	boardID := card.Column.BoardID
+
+	checklist := models.Checklist{ID: uuid.New(), CardID: card.ID, Title: title}
+	var rev int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockBoards(tx, boardID); err != nil {
+			return err
+		}
+		list := checklistList(card.ID)
+		if err := list.lock(tx); err != nil {
+			return err
+		}
+		if checklist.Rank, err = list.place(tx, checklist.ID, nil, nil); err != nil {
+			return err
+		}
+		if err := tx.Omit("Card", "Items").Create(&checklist).Error; err != nil {
+			return err
+		}
+		rev, err = bumpBoardRevision(tx, boardID)
+		return err
+	})
+	if err != nil {
+		return txError(err, "Failed to create checklist")
+	}
+
+	checklist = loadChecklistForResponse(checklist.ID)
+	publishBoardEvent(boardID, rev, ws.TypeChecklistCreated, checklist)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "data": checklist})
+}
+
+// PUT /api/checklists/:id
+//
+// Renames a checklist, or moves it among the card's checklists with
+// after_id / before_id.
+func UpdateChecklist(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	checklistID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid checklist ID"})
+	}
+
+	var input struct {
+		Title    *string `json:"title"`
+		AfterID  *string `json:"after_id"`
+		BeforeID *string `json:"before_id"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+	afterID, err := parseNeighbour(input.AfterID, "after_id")
+	if err != nil {
+		return err
+	}
+	beforeID, err := parseNeighbour(input.BeforeID, "before_id")
+	if err != nil {
+		return err
+	}
+
+	checklist, err := loadChecklist(checklistID, userID, policy.Edit)
+	if err != nil {
+		return err
+	}
+	boardID := checklist.Card.Column.BoardID
+
+	updates := map[string]interface{}{}
+	if input.Title != nil {
+		title, err := checklistTitle(*input.Title)
+		if err != nil {
+			return err
+		}
+		updates["title"] = title
+	}
+	moving := afterID != nil || beforeID != nil
+	if len(updates) == 0 && !moving {
+		return c.JSON(fiber.Map{"success": true, "data": loadChecklistForResponse(checklist.ID)})
+	}
+
+	var rev int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockBoards(tx, boardID); err != nil {
+			return err
+		}
+		if moving {
+			list := checklistList(checklist.CardID)
+			if err := list.lock(tx); err != nil {
+				return err
+			}
+			rank, err := list.place(tx, checklist.ID, afterID, beforeID)
+			if err != nil {
+				return err
+			}
+			updates["rank"] = rank
+		}
+		updates["updated_at"] = time.Now()
+		if err := tx.Model(&models.Checklist{}).Where("id = ?", checklist.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		rev, err = bumpBoardRevision(tx, boardID)
+		return err
+	})
+	if err != nil {
+		return txError(err, "Failed to update checklist")
+	}
+
+	checklist = loadChecklistForResponse(checklist.ID)
+	publishBoardEvent(boardID, rev, ws.TypeChecklistUpdated, checklist)
+
+	return c.JSON(fiber.Map{"success": true, "data": checklist})
+}
+
+// DELETE /api/checklists/:id
+func DeleteChecklist(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	checklistID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid checklist ID"})
+	}
+
+	checklist, err := loadChecklist(checklistID, userID, policy.Edit)
+	if err != nil {
+		return err
+	}
+	boardID := checklist.Card.Column.BoardID
+
+	var rev int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockBoards(tx, boardID); err != nil {
+			return err
+		}
+		if err := tx.Where("checklist_id = ?", checklist.ID).Delete(&models.ChecklistItem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.Checklist{}, "id = ?", checklist.ID).Error; err != nil {
+			return err
+		}
+		rev, err = bumpBoardRevision(tx, boardID)
+		return err
+	})
+	if err != nil {
+		return txError(err, "Failed to delete checklist")
+	}
+
+	publishBoardEvent(boardID, rev, ws.TypeChecklistDeleted, fiber.Map{
+		"checklist_id": checklist.ID,
+		"card_id":      checklist.CardID,
+	})
+
+	return c.JSON(fiber.Map{"success": true, "message": "Checklist deleted successfully"})
+}
+
+// POST /api/checklists/:id/items
+//
+// Adds an item at the end of the checklist. assignee_id and due_date are
+// optional.
+func CreateChecklistItem(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	checklistID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid checklist ID"})
+	}
+
+	var input struct {
+		Title      string `json:"title"`
+		AssigneeID string `json:"assignee_id"`
+		DueDate    string `json:"due_date"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+	title, err := checklistTitle(input.Title)
+	if err != nil {
+		return err
+	}
+	dueDate, err := itemDueDate(input.DueDate)
+	if err != nil {
+		return err
+	}
+
+	checklist, err := loadChecklist(checklistID, userID, policy.Edit)
+	if err != nil {
+		return err
+	}
+	board := checklist.Card.Column.Board
+	assigneeID, err := itemAssignee(board, input.AssigneeID)
+	if err != nil {
+		return err
+	}
+
+	item := models.ChecklistItem{
+		ID:          uuid.New(),
+		ChecklistID: checklist.ID,
+		Title:       title,
+		AssigneeID:  assigneeID,
+		DueDate:     dueDate,
+	}
+	var rev int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockBoards(tx, board.ID); err != nil {
+			return err
+		}
+		list := checklistItemList(checklist.ID)
+		if err := list.lock(tx); err != nil {
+			return err
+		}
+		if item.Rank, err = list.place(tx, item.ID, nil, nil); err != nil {
+			return err
+		}
+		if err := tx.Omit("Checklist", "Assignee").Create(&item).Error; err != nil {
+			return err
+		}
+		rev, err = bumpBoardRevision(tx, board.ID)
+		return err
+	})
+	if err != nil {
+		return txError(err, "Failed to create checklist item")
+	}
+
+	item = loadChecklistItemForResponse(item.ID)
+	publishBoardEvent(board.ID, rev, ws.TypeChecklistItemCreated, fiber.Map{"card_id": checklist.CardID, "item": item})
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "data": item})
+}
+
+// PUT /api/checklist-items/:id
+//
+// Partial update of title, done, assignee_id and due_date; "" clears the
+// assignee or due date.
+func UpdateChecklistItem(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	itemID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid checklist item ID"})
+	}
+
+	var input struct {
+		Title      *string `json:"title"`
+		Done       *bool   `json:"done"`
+		AssigneeID *string `json:"assignee_id"`
+		DueDate    *string `json:"due_date"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+
+	item, err := loadChecklistItem(itemID, userID, policy.Edit)
+	if err != nil {
+		return err
+	}
+	board := item.Checklist.Card.Column.Board
+	cardID := item.Checklist.CardID
+
+	updates := map[string]interface{}{}
+	if input.Title != nil {
+		title, err := checklistTitle(*input.Title)
+		if err != nil {
+			return err
+		}
+		updates["title"] = title
+	}
+	if input.Done != nil && *input.Done != item.Done {
+		updates["done"] = *input.Done
+		if *input.Done {
+			updates["done_at"] = time.Now()
+			updates["done_by_id"] = userID
+		} else {
+			updates["done_at"] = nil
+			updates["done_by_id"] = nil
+		}
+	}
+	if input.AssigneeID != nil {
+		assigneeID, err := itemAssignee(board, *input.AssigneeID)
+		if err != nil {
+			return err
+		}
+		updates["assignee_id"] = assigneeID
+	}
+	if input.DueDate != nil {
+		dueDate, err := itemDueDate(*input.DueDate)
+		if err != nil {
+			return err
+		}
+		updates["due_date"] = dueDate
+	}
+	if len(updates) == 0 {
+		return c.JSON(fiber.Map{"success": true, "data": loadChecklistItemForResponse(item.ID)})
+	}
+
+	var rev int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockBoards(tx, board.ID); err != nil {
+			return err
+		}
+		updates["updated_at"] = time.Now()
+		if err := tx.Model(&models.ChecklistItem{}).Where("id = ?", item.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		rev, err = bumpBoardRevision(tx, board.ID)
+		return err
+	})
+	if err != nil {
+		return txError(err, "Failed to update checklist item")
+	}
+
+	item = loadChecklistItemForResponse(item.ID)
+	publishBoardEvent(board.ID, rev, ws.TypeChecklistItemUpdated, fiber.Map{"card_id": cardID, "item": item})
+
+	return c.JSON(fiber.Map{"success": true, "data": item})
+}
+
+// POST /api/checklist-items/:id/move
+//
+// Places the item in checklist_id (default: its current checklist, which
+// must belong to the same card) right after after_id and/or before
+// before_id. With neither the item goes to the end.
+func MoveChecklistItem(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	itemID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid checklist item ID"})
+	}
+
+	var input struct {
+		ChecklistID string  `json:"checklist_id"`
+		AfterID     *string `json:"after_id"`
+		BeforeID    *string `json:"before_id"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+	afterID, err := parseNeighbour(input.AfterID, "after_id")
+	if err != nil {
+		return err
+	}
+	beforeID, err := parseNeighbour(input.BeforeID, "before_id")
+	if err != nil {
+		return err
+	}
+
+	item, err := loadChecklistItem(itemID, userID, policy.Edit)
+	if err != nil {
+		return err
+	}
+	boardID := item.Checklist.Card.Column.BoardID
+	cardID := item.Checklist.CardID
+
+	targetID := item.ChecklistID
+	if input.ChecklistID != "" {
+		if targetID, err = uuid.Parse(input.ChecklistID); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid checklist ID"})
+		}
+		if targetID != item.ChecklistID {
+			var target models.Checklist
+			if err := database.DB.First(&target, "id = ?", targetID).Error; err != nil || target.CardID != cardID {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Items can only move between checklists of the same card"})
+			}
+		}
+	}
+
+	var rev int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockBoards(tx, boardID); err != nil {
+			return err
+		}
+		list := checklistItemList(targetID)
+		if err := list.lock(tx); err != nil {
+			return err
+		}
+		rank, err := list.place(tx, item.ID, afterID, beforeID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ChecklistItem{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+			"checklist_id": targetID,
+			"rank":         rank,
+			"updated_at":   time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		rev, err = bumpBoardRevision(tx, boardID)
+		return err
+	})
+	if err != nil {
+		return txError(err, "Failed to move checklist item")
+	}
+
+	moved := loadChecklistItemForResponse(item.ID)
+	publishBoardEvent(boardID, rev, ws.TypeChecklistItemMoved, fiber.Map{
+		"card_id":           cardID,
+		"item":              moved,
+		"from_checklist_id": item.ChecklistID,
+	})
+
+	return c.JSON(fiber.Map{"success": true, "data": moved})
+}
+
+// DELETE /api/checklist-items/:id
+func DeleteChecklistItem(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	itemID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid checklist item ID"})
+	}
+
+	item, err := loadChecklistItem(itemID, userID, policy.Edit)
+	if err != nil {
+		return err
+	}
+	boardID := item.Checklist.Card.Column.BoardID
+
+	var rev int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockBoards(tx, boardID); err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.ChecklistItem{}, "id = ?", item.ID).Error; err != nil {
+			return err
+		}
+		rev, err = bumpBoardRevision(tx, boardID)
+		return err
+	})
+	if err != nil {
+		return txError(err, "Failed to delete checklist item")
+	}
+
+	publishBoardEvent(boardID, rev, ws.TypeChecklistItemDeleted, fiber.Map{
+		"item_id":      item.ID,
+		"checklist_id": item.ChecklistID,
+		"card_id":      item.Checklist.CardID,
+	})
+
+	return c.JSON(fiber.Map{"success": true, "message": "Checklist item deleted successfully"})
+}
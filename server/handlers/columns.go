@@ -3,10 +3,13 @@ package handlers
 import (
 	"tether-server/database"
 	"tether-server/models"
+	"tether-server/policy"
+	"tether-server/ws"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // CreateColumn - создать новую колонку
@@ -21,10 +24,9 @@ func CreateColumn(c *fiber.Ctx) error {
 	}
 
 	var input struct {
-		Name     string `json:"name"`
-		Position int    `json:"position"`
-		Color    string `json:"color"`
-		BoardID  string `json:"board_id"`
+		Name    string `json:"name"`
+		Color   string `json:"color"`
+		BoardID string `json:"board_id"`
 	}
 
 	if err := c.BodyParser(&input); err != nil {
@@ -50,30 +52,8 @@ func CreateColumn(c *fiber.Ctx) error {
 	}
 
 	// Check board access
-	var board models.Board
-	if err := database.DB.First(&board, boardUUID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"success": false,
-			"error":   "Board not found",
-		})
-	}
-
-	// Check if user has access to board
-	if board.OwnerID != userUUID && !board.IsPublic {
-		if board.WorkspaceID != nil {
-			var member models.WorkspaceMember
-			if err := database.DB.Where("workspace_id = ? AND user_id = ?", board.WorkspaceID, userUUID).First(&member).Error; err != nil {
-				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-					"success": false,
-					"error":   "Access denied",
-				})
-			}
-		} else {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"success": false,
-				"error":   "Access denied",
-			})
-		}
+	if _, err := loadBoard(boardUUID, userUUID, policy.Edit); err != nil {
+		return err
 	}
 
 	// Set default color
@@ -84,20 +64,81 @@ func CreateColumn(c *fiber.Ctx) error {
 	column := models.Column{
 		ID:        uuid.New(),
 		Name:      input.Name,
-		Position:  input.Position,
 		Color:     input.Color,
 		BoardID:   boardUUID,
+		Version:   1,
 		CreatedAt: time.Now(),
 	}
 
-	if err := database.DB.Create(&column).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+	// New columns go to the end of the board
+	var rev int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		list := columnList(boardUUID)
+		if err := list.lock(tx); err != nil {
+			return err
+		}
+		if column.Rank, err = list.place(tx, column.ID, nil, nil); err != nil {
+			return err
+		}
+		if err := tx.Create(&column).Error; err != nil {
+			return err
+		}
+		if err := logActivity(tx, models.Activity{
+			BoardID:  boardUUID,
+			ActorID:  userUUID,
+			Entity:   "column",
+			EntityID: column.ID,
+			Action:   "created",
+			Changes:  createdChange("name", column.Name),
+		}); err != nil {
+			return err
+		}
+		rev, err = bumpBoardRevision(tx, boardUUID)
+		return err
+	})
+	if err != nil {
+		return txError(err, "Failed to create column")
+	}
+
+	publishBoardEvent(boardUUID, rev, ws.TypeColumnCreated, column)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    column,
+	})
+}
+
+// GetColumn - получить колонку с карточками
+func GetColumn(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"success": false,
-			"error":   "Failed to create column",
+			"error":   "Invalid user ID",
 		})
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+	columnUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid column ID",
+		})
+	}
+
+	column, err := loadColumn(columnUUID, userUUID, policy.View)
+	if err != nil {
+		return err
+	}
+	filter, err := parseCardFilter(c, userUUID)
+	if err != nil {
+		return err
+	}
+	filter.scope(withCardRelations(database.DB)).Where("column_id = ?", column.ID).Order(rankOrder).Find(&column.Cards)
+
+	setETag(c, column.Version)
+	return c.JSON(fiber.Map{
 		"success": true,
 		"data":    column,
 	})
@@ -123,37 +164,23 @@ func UpdateColumn(c *fiber.Ctx) error {
 		})
 	}
 
-	var column models.Column
-	if err := database.DB.Preload("Board").First(&column, columnUUID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"success": false,
-			"error":   "Column not found",
-		})
+	// Check board access
+	column, err := loadColumn(columnUUID, userUUID, policy.Edit)
+	if err != nil {
+		return err
 	}
 
-	// Check board access
-	board := column.Board
-	if board.OwnerID != userUUID && !board.IsPublic {
-		if board.WorkspaceID != nil {
-			var member models.WorkspaceMember
-			if err := database.DB.Where("workspace_id = ? AND user_id = ?", board.WorkspaceID, userUUID).First(&member).Error; err != nil {
-				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-					"success": false,
-					"error":   "Access denied",
-				})
-			}
-		} else {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"success": false,
-				"error":   "Access denied",
-			})
-		}
+	ifMatch, err := ifMatchVersion(c)
+	if err != nil {
+		return err
+	}
+	if ifMatch != nil && *ifMatch != column.Version {
+		return versionConflict(c, column, column.Version)
 	}
 
 	var input struct {
-		Name     *string `json:"name"`
-		Position *int    `json:"position"`
-		Color    *string `json:"color"`
+		Name  *string `json:"name"`
+		Color *string `json:"color"`
 	}
 
 	if err := c.BodyParser(&input); err != nil {
@@ -163,26 +190,63 @@ func UpdateColumn(c *fiber.Ctx) error {
 		})
 	}
 
-	// Update fields
+	// Collect only the fields the client sent
+	updates := map[string]interface{}{}
 	if input.Name != nil {
-		column.Name = *input.Name
-	}
-	if input.Position != nil {
-		column.Position = *input.Position
+		updates["name"] = *input.Name
 	}
 	if input.Color != nil {
-		column.Color = *input.Color
+		updates["color"] = *input.Color
 	}
 
-	column.UpdatedAt = time.Now()
+	if len(updates) == 0 {
+		setETag(c, column.Version)
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    column,
+		})
+	}
 
-	if err := database.DB.Save(&column).Error; err != nil {
+	var rev int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockBoards(tx, column.BoardID); err != nil {
+			return err
+		}
+		changes := fieldChanges(column, updates)
+		if err := updateVersioned(tx, &models.Column{}, column.ID, ifMatch, updates); err != nil {
+			return err
+		}
+		if len(changes) > 0 {
+			if err := logActivity(tx, models.Activity{
+				BoardID:  column.BoardID,
+				ActorID:  userUUID,
+				Entity:   "column",
+				EntityID: column.ID,
+				Action:   "updated",
+				Changes:  changes,
+			}); err != nil {
+				return err
+			}
+		}
+		rev, err = bumpBoardRevision(tx, column.BoardID)
+		return err
+	})
+	if err == errVersionConflict {
+		database.DB.First(&column, "id = ?", column.ID)
+		return versionConflict(c, column, column.Version)
+	}
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"error":   "Failed to update column",
 		})
 	}
 
+	database.DB.First(&column, "id = ?", column.ID)
+	publishBoardEvent(column.BoardID, rev, ws.TypeColumnUpdated, column)
+
+	setETag(c, column.Version)
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"data":    column,
@@ -209,32 +273,137 @@ func DeleteColumn(c *fiber.Ctx) error {
 		})
 	}
 
-	var column models.Column
-	if err := database.DB.Preload("Board").First(&column, columnUUID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+	// Deleting a column takes its cards with it, so it needs board admin
+	column, err := loadColumn(columnUUID, userUUID, policy.Admin)
+	if err != nil {
+		return err
+	}
+
+	var rev int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockBoards(tx, column.BoardID); err != nil {
+			return err
+		}
+		if err := tx.Delete(&column).Error; err != nil {
+			return err
+		}
+		if err := logActivity(tx, models.Activity{
+			BoardID:  column.BoardID,
+			ActorID:  userUUID,
+			Entity:   "column",
+			EntityID: column.ID,
+			Action:   "deleted",
+			Changes:  deletedChange("name", column.Name),
+		}); err != nil {
+			return err
+		}
+		rev, err = bumpBoardRevision(tx, column.BoardID)
+		return err
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
-			"error":   "Column not found",
+			"error":   "Failed to delete column",
 		})
 	}
 
-	// Check board ownership
-	board := column.Board
-	if board.OwnerID != userUUID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+	publishBoardEvent(column.BoardID, rev, ws.TypeColumnDeleted, fiber.Map{"column_id": column.ID})
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Column deleted successfully",
+	})
+}
+
+// MoveColumn - переместить колонку
+//
+// POST /api/columns/:id/move
+//
+// Places the column right after after_id and/or before before_id on its
+// board. With neither the column goes to the end.
+func MoveColumn(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"success": false,
-			"error":   "Only board owner can delete columns",
+			"error":   "Invalid user ID",
 		})
 	}
 
-	if err := database.DB.Delete(&column).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+	columnUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"success": false,
-			"error":   "Failed to delete column",
+			"error":   "Invalid column ID",
 		})
 	}
 
+	var input struct {
+		AfterID  *string `json:"after_id"`
+		BeforeID *string `json:"before_id"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+	}
+	afterID, err := parseNeighbour(input.AfterID, "after_id")
+	if err != nil {
+		return err
+	}
+	beforeID, err := parseNeighbour(input.BeforeID, "before_id")
+	if err != nil {
+		return err
+	}
+
+	column, err := loadColumn(columnUUID, userUUID, policy.Edit)
+	if err != nil {
+		return err
+	}
+
+	var rev int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		list := columnList(column.BoardID)
+		if err := list.lock(tx); err != nil {
+			return err
+		}
+		rank, err := list.place(tx, column.ID, afterID, beforeID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Column{}).Where("id = ?", column.ID).Updates(map[string]interface{}{
+			"rank":       rank,
+			"version":    gorm.Expr("version + 1"),
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		if err := logActivity(tx, models.Activity{
+			BoardID:  column.BoardID,
+			ActorID:  userUUID,
+			Entity:   "column",
+			EntityID: column.ID,
+			Action:   "moved",
+		}); err != nil {
+			return err
+		}
+		rev, err = bumpBoardRevision(tx, column.BoardID)
+		return err
+	})
+	if err != nil {
+		return txError(err, "Failed to move column")
+	}
+
+	var moved models.Column
+	database.DB.First(&moved, "id = ?", column.ID)
+	publishBoardEvent(column.BoardID, rev, ws.TypeColumnMoved, moved)
+
+	setETag(c, moved.Version)
+
 	return c.JSON(fiber.Map{
 		"success": true,
-		"message": "Column deleted successfully",
+		"data":    moved,
 	})
 }
@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"strings"
+	"tether-server/database"
+	"tether-server/models"
+	"tether-server/policy"
+	"tether-server/utils"
+	"tether-server/ws"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Longest comment body, in characters
+const maxCommentLength = 10000
+
+// commentBody trims and validates the markdown body of a comment.
+func commentBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Comment body is required")
+	}
+	if utf8.RuneCountInString(body) > maxCommentLength {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Comment is too long")
+	}
+	return body, nil
+}
+
+// loadComment loads a comment with its card, column and board for a caller
+// who needs required on that board.
+func loadComment(commentID, userID uuid.UUID, required policy.Permission) (models.CardComment, error) {
+	var comment models.CardComment
+	if err := database.DB.Preload("Card.Column.Board").First(&comment, "id = ?", commentID).Error; err != nil {
+		return comment, fiber.NewError(fiber.StatusNotFound, "Comment not found")
+	}
+	// Comments of deleted cards are gone with them
+	if comment.Card.ID == uuid.Nil {
+		return comment, fiber.NewError(fiber.StatusNotFound, "Comment not found")
+	}
+	return comment, authorizeBoard(&comment.Card.Column.Board, userID, required)
+}
+
+// mentionedMembers resolves the @mentions in body to members of the board
+// (see isBoardMember), leaving out the author. Anyone else's name is treated
+// as plain text, so mentions can't be used to notify strangers through a
+// public board.
+func mentionedMembers(board models.Board, authorID uuid.UUID, body string) ([]models.User, error) {
+	names := utils.ParseMentions(body)
+	if len(names) == 0 {
+		return nil, nil
+	}
+	var candidates []models.User
+	if err := database.DB.Where("username IN ? AND id <> ?", names, authorID).Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	users := make([]models.User, 0, len(candidates))
+	for _, u := range candidates {
+		member, err := isBoardMember(board, u.ID)
+		if err != nil {
+			return nil, err
+		}
+		if member {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+// mentionNotifications builds the notifications for users mentioned in a
+// comment.
+func mentionNotifications(comment models.CardComment, boardID uuid.UUID, users []models.User) []models.Notification {
+	notifications := make([]models.Notification, 0, len(users))
+	for _, u := range users {
+		cardID, commentID := comment.CardID, comment.ID
+		notifications = append(notifications, models.Notification{
+			UserID:    u.ID,
+			ActorID:   comment.AuthorID,
+			Type:      "mention",
+			BoardID:   &boardID,
+			CardID:    &cardID,
+			CommentID: &commentID,
+		})
+	}
+	return notifications
+}
+
+// addMentions records users as mentioned in a comment, skipping those it
+// already mentioned, and returns the newly mentioned ones.
+func addMentions(tx *gorm.DB, commentID uuid.UUID, users []models.User) ([]models.User, error) {
+	if len(users) == 0 {
+		return nil, nil
+	}
+	var existing []uuid.UUID
+	if err := tx.Model(&models.CommentMention{}).Where("comment_id = ?", commentID).Pluck("user_id", &existing).Error; err != nil {
+		return nil, err
+	}
+	known := map[uuid.UUID]bool{}
+	for _, id := range existing {
+		known[id] = true
+	}
+
+	var added []models.User
+	var mentions []models.CommentMention
+	for _, u := range users {
+		if known[u.ID] {
+			continue
+		}
+		added = append(added, u)
+		mentions = append(mentions, models.CommentMention{ID: uuid.New(), CommentID: commentID, UserID: u.ID, CreatedAt: time.Now()})
+	}
+	if len(mentions) == 0 {
+		return nil, nil
+	}
+	return added, tx.Omit("User").Create(&mentions).Error
+}
+
+// loadCommentForResponse reloads a comment with the relations clients show.
+func loadCommentForResponse(id uuid.UUID) models.CardComment {
+	var comment models.CardComment
+	database.DB.Preload("Author").Preload("Mentions.User").First(&comment, "id = ?", id)
+	return comment
+}
+
+// GET /api/cards/:id/comments
+//
+// The card's comments, oldest first.
+func GetCardComments(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	cardID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid card ID"})
+	}
+	if _, err := loadCard(cardID, userID, policy.View); err != nil {
+		return err
+	}
+
+	comments := []models.CardComment{}
+	if err := database.DB.Where("card_id = ?", cardID).Preload("Author").Preload("Mentions.User").
+		Order("created_at asc, id asc").Find(&comments).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to get comments"})
+	}
+	return c.JSON(fiber.Map{"success": true, "data": comments})
+}
+
+// POST /api/cards/:id/comments
+//
+// Adds a markdown comment. Board members mentioned as @username are
+// notified.
+func CreateCardComment(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	cardID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid card ID"})
+	}
+
+	var input struct {
+		Body string `json:"body"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+	body, err := commentBody(input.Body)
+	if err != nil {
+		return err
+	}
+
+	card, err := loadCard(cardID, userID, policy.Comment)
+	if err != nil {
+		return err
+	}
+	board := card.Column.Board
+	mentioned, err := mentionedMembers(board, userID, body)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to resolve mentions"})
+	}
+
+	comment := models.CardComment{
+		ID:        uuid.New(),
+		CardID:    card.ID,
+		AuthorID:  userID,
+		Body:      body,
+		CreatedAt: time.Now(),
+	}
+	notifications := mentionNotifications(comment, board.ID, mentioned)
+
+	var rev int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockBoards(tx, board.ID); err != nil {
+			return err
+		}
+		if err := tx.Omit("Author", "Card", "Mentions").Create(&comment).Error; err != nil {
+			return err
+		}
+		if _, err := addMentions(tx, comment.ID, mentioned); err != nil {
+			return err
+		}
+		if err := createNotifications(tx, notifications); err != nil {
+			return err
+		}
+		rev, err = bumpBoardRevision(tx, board.ID)
+		return err
+	})
+	if err != nil {
+		return txError(err, "Failed to create comment")
+	}
+
+	comment = loadCommentForResponse(comment.ID)
+	publishBoardEvent(board.ID, rev, ws.TypeCommentCreated, comment)
+	pushNotifications(notifications, comment.Author)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "data": comment})
+}
+
+// PUT /api/comments/:id
+//
+// Replaces the body of the caller's own comment. Only users the edit newly
+// mentions are notified.
+func UpdateCardComment(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	commentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid comment ID"})
+	}
+
+	var input struct {
+		Body string `json:"body"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+	body, err := commentBody(input.Body)
+	if err != nil {
+		return err
+	}
+
+	comment, err := loadComment(commentID, userID, policy.Comment)
+	if err != nil {
+		return err
+	}
+	if comment.AuthorID != userID {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Only the author can edit a comment"})
+	}
+	if body == comment.Body {
+		return c.JSON(fiber.Map{"success": true, "data": loadCommentForResponse(comment.ID)})
+	}
+
+	board := comment.Card.Column.Board
+	mentioned, err := mentionedMembers(board, userID, body)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to resolve mentions"})
+	}
+
+	var rev int64
+	var notifications []models.Notification
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockBoards(tx, board.ID); err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := tx.Model(&models.CardComment{}).Where("id = ?", comment.ID).Updates(map[string]interface{}{
+			"body":       body,
+			"edited_at":  now,
+			"updated_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		added, err := addMentions(tx, comment.ID, mentioned)
+		if err != nil {
+			return err
+		}
+		notifications = mentionNotifications(comment, board.ID, added)
+		if err := createNotifications(tx, notifications); err != nil {
+			return err
+		}
+		rev, err = bumpBoardRevision(tx, board.ID)
+		return err
+	})
+	if err != nil {
+		return txError(err, "Failed to update comment")
+	}
+
+	comment = loadCommentForResponse(comment.ID)
+	publishBoardEvent(board.ID, rev, ws.TypeCommentUpdated, comment)
+	pushNotifications(notifications, comment.Author)
+
+	return c.JSON(fiber.Map{"success": true, "data": comment})
+}
+
+// DELETE /api/comments/:id
+//
+// Authors can delete their own comments, board admins any comment.
+func DeleteCardComment(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	commentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid comment ID"})
+	}
+
+	required := policy.Comment
+	comment, err := loadComment(commentID, userID, policy.View)
+	if err != nil {
+		return err
+	}
+	if comment.AuthorID != userID {
+		required = policy.Admin
+	}
+	board := comment.Card.Column.Board
+	if err := authorizeBoard(&board, userID, required); err != nil {
+		return err
+	}
+
+	var rev int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockBoards(tx, board.ID); err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.CardComment{}, "id = ?", comment.ID).Error; err != nil {
+			return err
+		}
+		rev, err = bumpBoardRevision(tx, board.ID)
+		return err
+	})
+	if err != nil {
+		return txError(err, "Failed to delete comment")
+	}
+
+	publishBoardEvent(board.ID, rev, ws.TypeCommentDeleted, fiber.Map{
+		"comment_id": comment.ID,
+		"card_id":    comment.CardID,
+	})
+
+	return c.JSON(fiber.Map{"success": true, "message": "Comment deleted successfully"})
+}
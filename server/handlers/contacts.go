@@ -0,0 +1,679 @@
+package handlers
+
+import (
+	"strings"
+	"tether-server/database"
+	"tether-server/models"
+	"tether-server/policy"
+	"tether-server/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Contact and company list page sizes
+const (
+	defaultContactPageSize = 50
+	maxContactPageSize     = 100
+)
+
+// workspaceMembership returns userID's membership of a workspace, or 403.
+func workspaceMembership(workspaceID, userID uuid.UUID) (models.WorkspaceMember, error) {
+	var member models.WorkspaceMember
+	if err := database.DB.Where("workspace_id = ? AND user_id = ?", workspaceID, userID).First(&member).Error; err != nil {
+		return member, fiber.NewError(fiber.StatusForbidden, "Access denied")
+	}
+	return member, nil
+}
+
+// loadContact resolves the contact from the route for a member of its
+// workspace.
+func loadContact(c *fiber.Ctx) (models.Contact, models.WorkspaceMember, error) {
+	var contact models.Contact
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return contact, models.WorkspaceMember{}, fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+	}
+	contactID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return contact, models.WorkspaceMember{}, fiber.NewError(fiber.StatusBadRequest, "Invalid contact ID")
+	}
+	if err := database.DB.Preload("Company").First(&contact, "id = ?", contactID).Error; err != nil {
+		return contact, models.WorkspaceMember{}, fiber.NewError(fiber.StatusNotFound, "Contact not found")
+	}
+	member, err := workspaceMembership(contact.WorkspaceID, userID)
+	return contact, member, err
+}
+
+// loadCompany resolves the company from the route for a member of its
+// workspace.
+func loadCompany(c *fiber.Ctx) (models.Company, models.WorkspaceMember, error) {
+	var company models.Company
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return company, models.WorkspaceMember{}, fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+	}
+	companyID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return company, models.WorkspaceMember{}, fiber.NewError(fiber.StatusBadRequest, "Invalid company ID")
+	}
+	if err := database.DB.First(&company, "id = ?", companyID).Error; err != nil {
+		return company, models.WorkspaceMember{}, fiber.NewError(fiber.StatusNotFound, "Company not found")
+	}
+	member, err := workspaceMembership(company.WorkspaceID, userID)
+	return company, member, err
+}
+
+// findContactByEmail returns the workspace's contact with email, if any.
+func findContactByEmail(db *gorm.DB, workspaceID uuid.UUID, email string, except uuid.UUID) (models.Contact, bool) {
+	var contact models.Contact
+	if email == "" {
+		return contact, false
+	}
+	err := db.Where("workspace_id = ? AND email = ? AND id <> ?", workspaceID, email, except).First(&contact).Error
+	return contact, err == nil
+}
+
+// findCompanyByDomain returns the workspace's company with domain, if any.
+func findCompanyByDomain(db *gorm.DB, workspaceID uuid.UUID, domain string, except uuid.UUID) (models.Company, bool) {
+	var company models.Company
+	if domain == "" {
+		return company, false
+	}
+	err := db.Where("workspace_id = ? AND domain = ? AND id <> ?", workspaceID, domain, except).First(&company).Error
+	return company, err == nil
+}
+
+// workspaceCompany parses a company_id sent by the client and checks that
+// the company belongs to the workspace. "" means none.
+func workspaceCompany(workspaceID uuid.UUID, s string) (*uuid.UUID, error) {
+	if s == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid company ID")
+	}
+	var count int64
+	database.DB.Model(&models.Company{}).Where("id = ? AND workspace_id = ?", id, workspaceID).Count(&count)
+	if count == 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Company not found in this workspace")
+	}
+	return &id, nil
+}
+
+// contactEmail normalizes and validates an optional email.
+func contactEmail(email string) (string, error) {
+	email = utils.NormalizeEmail(email)
+	if email != "" && !utils.IsValidEmail(email) {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Invalid email address")
+	}
+	return email, nil
+}
+
+// pageParams reads ?limit= and ?offset= for contact and company lists.
+func pageParams(c *fiber.Ctx) (limit, offset int) {
+	limit = c.QueryInt("limit", defaultContactPageSize)
+	if limit <= 0 {
+		limit = defaultContactPageSize
+	}
+	if limit > maxContactPageSize {
+		limit = maxContactPageSize
+	}
+	offset = c.QueryInt("offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// likePattern turns user input into an ILIKE substring pattern.
+func likePattern(q string) string {
+	q = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(q)
+	return "%" + q + "%"
+}
+
+// GET /api/workspaces/:id/contacts?q=&company_id=&limit=&offset=
+func GetContacts(c *fiber.Ctx) error {
+	workspace, _, err := loadWorkspaceMembership(c)
+	if err != nil {
+		return err
+	}
+	limit, offset := pageParams(c)
+
+	q := database.DB.Where("workspace_id = ?", workspace.ID)
+	if search := strings.TrimSpace(c.Query("q")); search != "" {
+		q = q.Where("(name ILIKE ? OR email ILIKE ?)", likePattern(search), likePattern(search))
+	}
+	if companyID := c.Query("company_id"); companyID != "" {
+		id, err := uuid.Parse(companyID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid company ID"})
+		}
+		q = q.Where("company_id = ?", id)
+	}
+
+	contacts := []models.Contact{}
+	if err := q.Preload("Company").Order("lower(name), id").Limit(limit + 1).Offset(offset).Find(&contacts).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to get contacts"})
+	}
+	n, hasMore := searchPage(len(contacts), limit)
+	return c.JSON(fiber.Map{"success": true, "data": contacts[:n], "has_more": hasMore})
+}
+
+// POST /api/workspaces/:id/contacts
+//
+// Creates a contact. Emails are unique per workspace: a duplicate is
+// answered with 409 and the existing contact. Without company_id the
+// contact joins the company owning its email domain, if there is one.
+func CreateContact(c *fiber.Ctx) error {
+	workspace, me, err := loadWorkspaceMembership(c)
+	if err != nil {
+		return err
+	}
+
+	var input struct {
+		Name      string `json:"name"`
+		Email     string `json:"email"`
+		Phone     string `json:"phone"`
+		Position  string `json:"position"`
+		CompanyID string `json:"company_id"`
+		Notes     string `json:"notes"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	email, err := contactEmail(input.Email)
+	if err != nil {
+		return err
+	}
+	if input.Name == "" {
+		input.Name = email
+	}
+	if input.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Name or email is required"})
+	}
+	if existing, ok := findContactByEmail(database.DB, workspace.ID, email, uuid.Nil); ok {
+		database.DB.Preload("Company").First(&existing, "id = ?", existing.ID)
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"success": false, "error": "A contact with this email already exists", "data": existing})
+	}
+
+	companyID, err := workspaceCompany(workspace.ID, input.CompanyID)
+	if err != nil {
+		return err
+	}
+	if companyID == nil {
+		if company, ok := findCompanyByDomain(database.DB, workspace.ID, utils.CompanyDomain(email), uuid.Nil); ok {
+			companyID = &company.ID
+		}
+	}
+
+	contact := models.Contact{
+		ID:          uuid.New(),
+		WorkspaceID: workspace.ID,
+		Name:        input.Name,
+		Email:       email,
+		Phone:       strings.TrimSpace(input.Phone),
+		Position:    strings.TrimSpace(input.Position),
+		CompanyID:   companyID,
+		Notes:       input.Notes,
+		CreatedByID: me.UserID,
+	}
+	if err := database.DB.Omit("Company").Create(&contact).Error; err != nil {
+		// A concurrent request may have taken the email since the check above
+		if existing, ok := findContactByEmail(database.DB, workspace.ID, email, uuid.Nil); ok {
+			database.DB.Preload("Company").First(&existing, "id = ?", existing.ID)
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"success": false, "error": "A contact with this email already exists", "data": existing})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to create contact"})
+	}
+	database.DB.Preload("Company").First(&contact, "id = ?", contact.ID)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "data": contact})
+}
+
+// GET /api/contacts/:id
+func GetContact(c *fiber.Ctx) error {
+	contact, _, err := loadContact(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"success": true, "data": contact})
+}
+
+// PUT /api/contacts/:id
+func UpdateContact(c *fiber.Ctx) error {
+	contact, _, err := loadContact(c)
+	if err != nil {
+		return err
+	}
+
+	var input struct {
+		Name      *string `json:"name"`
+		Email     *string `json:"email"`
+		Phone     *string `json:"phone"`
+		Position  *string `json:"position"`
+		CompanyID *string `json:"company_id"`
+		Notes     *string `json:"notes"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+
+	updates := map[string]interface{}{}
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Name is required"})
+		}
+		updates["name"] = name
+	}
+	if input.Email != nil {
+		email, err := contactEmail(*input.Email)
+		if err != nil {
+			return err
+		}
+		if existing, ok := findContactByEmail(database.DB, contact.WorkspaceID, email, contact.ID); ok {
+			database.DB.Preload("Company").First(&existing, "id = ?", existing.ID)
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"success": false, "error": "A contact with this email already exists", "data": existing})
+		}
+		updates["email"] = email
+	}
+	if input.Phone != nil {
+		updates["phone"] = strings.TrimSpace(*input.Phone)
+	}
+	if input.Position != nil {
+		updates["position"] = strings.TrimSpace(*input.Position)
+	}
+	if input.CompanyID != nil {
+		companyID, err := workspaceCompany(contact.WorkspaceID, *input.CompanyID)
+		if err != nil {
+			return err
+		}
+		updates["company_id"] = companyID
+	}
+	if input.Notes != nil {
+		updates["notes"] = *input.Notes
+	}
+	if len(updates) > 0 {
+		updates["updated_at"] = time.Now()
+		if err := database.DB.Model(&models.Contact{}).Where("id = ?", contact.ID).Updates(updates).Error; err != nil {
+			// A concurrent request may have taken the email since the check above
+			if email, ok := updates["email"].(string); ok {
+				if existing, ok := findContactByEmail(database.DB, contact.WorkspaceID, email, contact.ID); ok {
+					database.DB.Preload("Company").First(&existing, "id = ?", existing.ID)
+					return c.Status(fiber.StatusConflict).JSON(fiber.Map{"success": false, "error": "A contact with this email already exists", "data": existing})
+				}
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to update contact"})
+		}
+	}
+
+	var updated models.Contact
+	database.DB.Preload("Company").First(&updated, "id = ?", contact.ID)
+	return c.JSON(fiber.Map{"success": true, "data": updated})
+}
+
+// DELETE /api/contacts/:id
+//
+// Workspace admins only. Cards linked to the contact keep their company.
+func DeleteContact(c *fiber.Ctx) error {
+	contact, me, err := loadContact(c)
+	if err != nil {
+		return err
+	}
+	if workspaceRoleRank[me.Role] < workspaceRoleRank["admin"] {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Only workspace admins can delete contacts"})
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Card{}).Where("contact_id = ?", contact.ID).Update("contact_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Contact{}, "id = ?", contact.ID).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to delete contact"})
+	}
+	return c.JSON(fiber.Map{"success": true, "message": "Contact deleted successfully"})
+}
+
+// dealCard is a card on a contact's or company's timeline.
+type dealCard struct {
+	ID         uuid.UUID  `json:"id"`
+	Title      string     `json:"title"`
+	Status     string     `json:"status"`
+	Priority   string     `json:"priority"`
+	Value      float64    `json:"value"`
+	ContactID  *uuid.UUID `json:"contact_id"`
+	CompanyID  *uuid.UUID `json:"company_id"`
+	BoardID    uuid.UUID  `json:"board_id"`
+	BoardName  string     `json:"board_name"`
+	ColumnID   uuid.UUID  `json:"column_id"`
+	ColumnName string     `json:"column_name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// dealTimeline answers with the cards matching cond (on the cards table,
+// named arguments in args) on boards the caller can see, newest first.
+func dealTimeline(c *fiber.Ctx, userID uuid.UUID, cond string, args map[string]interface{}) error {
+	args["viewer"] = userID
+	deals := []dealCard{}
+	if err := database.DB.Raw(`
+		SELECT cards.id, cards.title, cards.status, cards.priority, cards.value, cards.contact_id, cards.company_id,
+			boards.id AS board_id, boards.name AS board_name, columns.id AS column_id, columns.name AS column_name,
+			cards.created_at, cards.updated_at
+		FROM cards
+		JOIN columns ON columns.id = cards.column_id
+		JOIN boards ON boards.id = columns.board_id
+		WHERE cards.deleted_at IS NULL AND columns.deleted_at IS NULL AND `+policy.ListedBoardsSQL+` AND `+cond+`
+		ORDER BY cards.created_at DESC, cards.id`, args).Scan(&deals).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to get timeline"})
+	}
+	return c.JSON(fiber.Map{"success": true, "data": deals})
+}
+
+// GET /api/contacts/:id/timeline
+//
+// Every deal card referencing the contact, on boards the caller can see.
+func GetContactTimeline(c *fiber.Ctx) error {
+	contact, me, err := loadContact(c)
+	if err != nil {
+		return err
+	}
+	return dealTimeline(c, me.UserID, "cards.contact_id = @contact", map[string]interface{}{"contact": contact.ID})
+}
+
+// GET /api/workspaces/:id/companies?q=&limit=&offset=
+func GetCompanies(c *fiber.Ctx) error {
+	workspace, _, err := loadWorkspaceMembership(c)
+	if err != nil {
+		return err
+	}
+	limit, offset := pageParams(c)
+
+	q := database.DB.Where("workspace_id = ?", workspace.ID)
+	if search := strings.TrimSpace(c.Query("q")); search != "" {
+		q = q.Where("(name ILIKE ? OR domain ILIKE ?)", likePattern(search), likePattern(search))
+	}
+	companies := []models.Company{}
+	if err := q.Order("lower(name), id").Limit(limit + 1).Offset(offset).Find(&companies).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to get companies"})
+	}
+	n, hasMore := searchPage(len(companies), limit)
+	return c.JSON(fiber.Map{"success": true, "data": companies[:n], "has_more": hasMore})
+}
+
+// POST /api/workspaces/:id/companies
+//
+// Creates a company. domain (or a website URL it is taken from) is unique
+// per workspace: a duplicate is answered with 409 and the existing company.
+func CreateCompany(c *fiber.Ctx) error {
+	workspace, me, err := loadWorkspaceMembership(c)
+	if err != nil {
+		return err
+	}
+
+	var input struct {
+		Name   string `json:"name"`
+		Domain string `json:"domain"`
+		Phone  string `json:"phone"`
+		Notes  string `json:"notes"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Company name is required"})
+	}
+	domain := utils.NormalizeDomain(input.Domain)
+	if existing, ok := findCompanyByDomain(database.DB, workspace.ID, domain, uuid.Nil); ok {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"success": false, "error": "A company with this domain already exists", "data": existing})
+	}
+
+	company := models.Company{
+		ID:          uuid.New(),
+		WorkspaceID: workspace.ID,
+		Name:        input.Name,
+		Domain:      domain,
+		Phone:       strings.TrimSpace(input.Phone),
+		Notes:       input.Notes,
+		CreatedByID: me.UserID,
+	}
+	if err := database.DB.Create(&company).Error; err != nil {
+		// A concurrent request may have taken the domain since the check above
+		if existing, ok := findCompanyByDomain(database.DB, workspace.ID, domain, uuid.Nil); ok {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"success": false, "error": "A company with this domain already exists", "data": existing})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to create company"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "data": company})
+}
+
+// GET /api/companies/:id
+//
+// The company with its contacts.
+func GetCompany(c *fiber.Ctx) error {
+	company, _, err := loadCompany(c)
+	if err != nil {
+		return err
+	}
+	contacts := []models.Contact{}
+	database.DB.Where("company_id = ?", company.ID).Order("lower(name), id").Find(&contacts)
+	return c.JSON(fiber.Map{"success": true, "data": company, "contacts": contacts})
+}
+
+// PUT /api/companies/:id
+func UpdateCompany(c *fiber.Ctx) error {
+	company, _, err := loadCompany(c)
+	if err != nil {
+		return err
+	}
+
+	var input struct {
+		Name   *string `json:"name"`
+		Domain *string `json:"domain"`
+		Phone  *string `json:"phone"`
+		Notes  *string `json:"notes"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+
+	updates := map[string]interface{}{}
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Company name is required"})
+		}
+		updates["name"] = name
+	}
+	if input.Domain != nil {
+		domain := utils.NormalizeDomain(*input.Domain)
+		if existing, ok := findCompanyByDomain(database.DB, company.WorkspaceID, domain, company.ID); ok {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"success": false, "error": "A company with this domain already exists", "data": existing})
+		}
+		updates["domain"] = domain
+	}
+	if input.Phone != nil {
+		updates["phone"] = strings.TrimSpace(*input.Phone)
+	}
+	if input.Notes != nil {
+		updates["notes"] = *input.Notes
+	}
+	if len(updates) > 0 {
+		updates["updated_at"] = time.Now()
+		if err := database.DB.Model(&models.Company{}).Where("id = ?", company.ID).Updates(updates).Error; err != nil {
+			// A concurrent request may have taken the domain since the check above
+			if domain, ok := updates["domain"].(string); ok {
+				if existing, ok := findCompanyByDomain(database.DB, company.WorkspaceID, domain, company.ID); ok {
+					return c.Status(fiber.StatusConflict).JSON(fiber.Map{"success": false, "error": "A company with this domain already exists", "data": existing})
+				}
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to update company"})
+		}
+	}
+
+	database.DB.First(&company, "id = ?", company.ID)
+	return c.JSON(fiber.Map{"success": true, "data": company})
+}
+
+// DELETE /api/companies/:id
+//
+// Workspace admins only. Contacts and cards of the company are kept and
+// unlinked from it.
+func DeleteCompany(c *fiber.Ctx) error {
+	company, me, err := loadCompany(c)
+	if err != nil {
+		return err
+	}
+	if workspaceRoleRank[me.Role] < workspaceRoleRank["admin"] {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Only workspace admins can delete companies"})
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Card{}).Where("company_id = ?", company.ID).Update("company_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Contact{}).Where("company_id = ?", company.ID).Update("company_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Company{}, "id = ?", company.ID).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to delete company"})
+	}
+	return c.JSON(fiber.Map{"success": true, "message": "Company deleted successfully"})
+}
+
+// GET /api/companies/:id/timeline
+//
+// Every deal card linked to the company or to one of its contacts, on
+// boards the caller can see.
+func GetCompanyTimeline(c *fiber.Ctx) error {
+	company, me, err := loadCompany(c)
+	if err != nil {
+		return err
+	}
+	return dealTimeline(c, me.UserID,
+		"(cards.company_id = @company OR cards.contact_id IN (SELECT id FROM contacts WHERE company_id = @company AND deleted_at IS NULL))",
+		map[string]interface{}{"company": company.ID})
+}
+
+// cardContactLinks resolves contact_id / company_id sent for a card on
+// board. They must belong to the board's workspace; "" clears them. A
+// contact sent without a company brings its own company along when the
+// card has none.
+func cardContactLinks(board models.Board, contactID, companyID *string, currentCompany *uuid.UUID) (contact, company *uuid.UUID, setCompany bool, err error) {
+	if (contactID != nil && *contactID != "") || (companyID != nil && *companyID != "") {
+		if board.WorkspaceID == nil {
+			return nil, nil, false, fiber.NewError(fiber.StatusBadRequest, "Contacts and companies can only be linked on workspace boards")
+		}
+	}
+	if companyID != nil {
+		if *companyID != "" {
+			if company, err = workspaceCompany(*board.WorkspaceID, *companyID); err != nil {
+				return nil, nil, false, err
+			}
+		}
+		setCompany = true
+	}
+	if contactID != nil && *contactID != "" {
+		id, err := uuid.Parse(*contactID)
+		if err != nil {
+			return nil, nil, false, fiber.NewError(fiber.StatusBadRequest, "Invalid contact ID")
+		}
+		var c models.Contact
+		if err := database.DB.First(&c, "id = ? AND workspace_id = ?", id, *board.WorkspaceID).Error; err != nil {
+			return nil, nil, false, fiber.NewError(fiber.StatusBadRequest, "Contact not found in this workspace")
+		}
+		contact = &id
+		if companyID == nil && currentCompany == nil && c.CompanyID != nil {
+			company, setCompany = c.CompanyID, true
+		}
+	}
+	return contact, company, setCompany, nil
+}
+
+// dropForeignLinks removes labels and custom field values of other boards,
+// and contacts and companies of other workspaces, from a card that moved to
+// boardID.
+func dropForeignLinks(tx *gorm.DB, cardID, boardID uuid.UUID) error {
+	if err := dropForeignLabels(tx, cardID, boardID); err != nil {
+		return err
+	}
+	if err := tx.Where("card_id = ? AND field_id NOT IN (SELECT id FROM custom_fields WHERE board_id = ?)", cardID, boardID).
+		Delete(&models.CardFieldValue{}).Error; err != nil {
+		return err
+	}
+	for _, link := range []struct{ column, table string }{{"contact_id", "contacts"}, {"company_id", "companies"}} {
+		if err := tx.Exec(`UPDATE cards SET `+link.column+` = NULL
+			WHERE id = ? AND `+link.column+` IS NOT NULL AND `+link.column+` NOT IN (
+				SELECT t.id FROM `+link.table+` t JOIN boards ON boards.workspace_id = t.workspace_id WHERE boards.id = ?)`,
+			cardID, boardID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findOrCreateCompany returns the workspace's company with domain or, when
+// there is no domain, with name, creating it inside tx when missing.
+func findOrCreateCompany(tx *gorm.DB, workspaceID, userID uuid.UUID, name, domain string) (*uuid.UUID, error) {
+	name, domain = strings.TrimSpace(name), utils.NormalizeDomain(domain)
+	if name == "" && domain == "" {
+		return nil, nil
+	}
+	var company models.Company
+	q := tx.Where("workspace_id = ?", workspaceID)
+	if domain != "" {
+		q = q.Where("domain = ?", domain)
+	} else {
+		q = q.Where("lower(name) = lower(?)", name)
+	}
+	err := q.First(&company).Error
+	if err == gorm.ErrRecordNotFound {
+		if name == "" {
+			name = domain
+		}
+		company = models.Company{ID: uuid.New(), WorkspaceID: workspaceID, Name: name, Domain: domain, CreatedByID: userID}
+		err = tx.Create(&company).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &company.ID, nil
+}
+
+// findOrCreateContact returns the workspace's contact with the same email
+// or, without an email, the same name and company, creating it inside tx
+// when missing.
+func findOrCreateContact(tx *gorm.DB, workspaceID, userID uuid.UUID, details exportContact, companyID *uuid.UUID) (*uuid.UUID, error) {
+	email := utils.NormalizeEmail(details.Email)
+	name := strings.TrimSpace(details.Name)
+	if name == "" {
+		name = email
+	}
+	if name == "" {
+		return nil, nil
+	}
+	var contact models.Contact
+	q := tx.Where("workspace_id = ?", workspaceID)
+	if email != "" {
+		q = q.Where("email = ?", email)
+	} else {
+		q = q.Where("email = '' AND lower(name) = lower(?) AND company_id IS NOT DISTINCT FROM ?", name, companyID)
+	}
+	err := q.First(&contact).Error
+	if err == gorm.ErrRecordNotFound {
+		contact = models.Contact{ID: uuid.New(), WorkspaceID: workspaceID, Name: name, Email: email,
+			Phone: strings.TrimSpace(details.Phone), Position: strings.TrimSpace(details.Position), CompanyID: companyID, CreatedByID: userID}
+		err = tx.Create(&contact).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &contact.ID, nil
+}
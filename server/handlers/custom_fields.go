@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"strings"
+	"tether-server/database"
+	"tether-server/models"
+	"tether-server/policy"
+	"tether-server/ws"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Longest custom field and option name, in bytes
+const maxFieldNameLength = 100
+
+var customFieldTypes = []string{
+	models.FieldText, models.FieldNumber, models.FieldDate, models.FieldSelect,
+	models.FieldMultiSelect, models.FieldUser, models.FieldURL,
+}
+
+func isSelectField(fieldType string) bool {
+	return fieldType == models.FieldSelect || fieldType == models.FieldMultiSelect
+}
+
+// fieldName trims and validates a field or option name.
+func fieldName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Name is required")
+	}
+	if len(name) > maxFieldNameLength {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Name is too long")
+	}
+	return name, nil
+}
+
+// fieldNameTaken reports whether the board has another custom field with the
+// same name, ignoring case.
+func fieldNameTaken(boardID uuid.UUID, name string, except uuid.UUID) bool {
+	var count int64
+	database.DB.Model(&models.CustomField{}).
+		Where("board_id = ? AND lower(name) = lower(?) AND id <> ?", boardID, name, except).Count(&count)
+	return count > 0
+}
+
+// fieldOptions validates the options sent for a select field. Options
+// without an id are new; options of current left out are returned as
+// removed.
+func fieldOptions(input []models.FieldOption, current models.FieldOptions) (models.FieldOptions, []string, error) {
+	if len(input) == 0 {
+		return nil, nil, fiber.NewError(fiber.StatusBadRequest, "Select fields need at least one option")
+	}
+	known := map[string]bool{}
+	for _, o := range current {
+		known[o.ID] = true
+	}
+	options := make(models.FieldOptions, 0, len(input))
+	names, kept := map[string]bool{}, map[string]bool{}
+	for _, o := range input {
+		name, err := fieldName(o.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if names[strings.ToLower(name)] {
+			return nil, nil, fiber.NewError(fiber.StatusBadRequest, "Option names must be unique")
+		}
+		names[strings.ToLower(name)] = true
+		if o.ID == "" {
+			o.ID = uuid.NewString()
+		} else if !known[o.ID] || kept[o.ID] {
+			return nil, nil, fiber.NewError(fiber.StatusBadRequest, "Unknown option ID")
+		}
+		kept[o.ID] = true
+		options = append(options, models.FieldOption{ID: o.ID, Name: name, Color: o.Color})
+	}
+	var removed []string
+	for _, o := range current {
+		if !kept[o.ID] {
+			removed = append(removed, o.ID)
+		}
+	}
+	return options, removed, nil
+}
+
+// dropFieldOptions removes deleted options from the values of a select
+// field inside tx.
+func dropFieldOptions(tx *gorm.DB, fieldID uuid.UUID, removed []string) error {
+	if len(removed) == 0 {
+		return nil
+	}
+	if err := tx.Where("field_id = ? AND text IN ?", fieldID, removed).Delete(&models.CardFieldValue{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec("UPDATE card_field_values SET option_ids = option_ids - ARRAY[?]::text[] WHERE field_id = ? AND option_ids IS NOT NULL",
+		removed, fieldID).Error; err != nil {
+		return err
+	}
+	return tx.Where("field_id = ? AND option_ids = '[]'::jsonb", fieldID).Delete(&models.CardFieldValue{}).Error
+}
+
+// loadCustomField loads a custom field with its board for a caller who
+// needs required on that board.
+func loadCustomField(fieldID, userID uuid.UUID, required policy.Permission) (models.CustomField, models.Board, error) {
+	var field models.CustomField
+	if err := database.DB.First(&field, "id = ?", fieldID).Error; err != nil {
+		return field, models.Board{}, fiber.NewError(fiber.StatusNotFound, "Custom field not found")
+	}
+	board, err := loadBoard(field.BoardID, userID, required)
+	return field, board, err
+}
+
+// GET /api/boards/:id/fields
+func GetBoardFields(c *fiber.Ctx) error {
+	board, _, err := loadRouteBoard(c, policy.View)
+	if err != nil {
+		return err
+	}
+	fields := []models.CustomField{}
+	if err := orderByRank(database.DB.Where("board_id = ?", board.ID)).Find(&fields).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to get custom fields"})
+	}
+	return c.JSON(fiber.Map{"success": true, "data": fields})
+}
+
+// POST /api/boards/:id/fields
+//
+// Adds a custom field at the end of the board's fields.
+func CreateCustomField(c *fiber.Ctx) error {
+	board, _, err := loadRouteBoard(c, policy.Edit)
+	if err != nil {
+		return err
+	}
+
+	var input struct {
+		Name    string               `json:"name"`
+		Type    string               `json:"type"`
+		Options []models.FieldOption `json:"options"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+	name, err := fieldName(input.Name)
+	if err != nil {
+		return err
+	}
+	if err := checkEnum(input.Type, customFieldTypes, "type"); err != nil {
+		return err
+	}
+	if fieldNameTaken(board.ID, name, uuid.Nil) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"success": false, "error": "The board already has a field with this name"})
+	}
+	field := models.CustomField{ID: uuid.New(), BoardID: board.ID, Name: name, Type: input.Type}
+	if isSelectField(input.Type) {
+		if field.Options, _, err = fieldOptions(input.Options, nil); err != nil {
+			return err
+		}
+	}
+
+	var rev int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		list := customFieldList(board.ID)
+		if err := list.lock(tx); err != nil {
+			return err
+		}
+		if field.Rank, err = list.place(tx, field.ID, nil, nil); err != nil {
+			return err
+		}
+		if err := tx.Create(&field).Error; err != nil {
+			return err
+		}
+		rev, err = bumpBoardRevision(tx, board.ID)
+		return err
+	})
+	if err != nil {
+		return txError(err, "Failed to create custom field")
+	}
+
+	publishBoardEvent(board.ID, rev, ws.TypeCustomFieldCreated, field)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "data": field})
+}
+
+// PUT /api/fields/:id
+//
+// Renames the field, replaces its options or moves it between after_id and
+// before_id. The type cannot change. Values using a removed option lose it.
+func UpdateCustomField(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	fieldID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid custom field ID"})
+	}
+
+	var input struct {
+		Name     *string               `json:"name"`
+		Type     *string               `json:"type"`
+		Options  *[]models.FieldOption `json:"options"`
+		AfterID  *string               `json:"after_id"`
+		BeforeID *string               `json:"before_id"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+	afterID, err := parseNeighbour(input.AfterID, "after_id")
+	if err != nil {
+		return err
+	}
+	beforeID, err := parseNeighbour(input.BeforeID, "before_id")
+	if err != nil {
+		return err
+	}
+
+	field, board, err := loadCustomField(fieldID, userID, policy.Edit)
+	if err != nil {
+		return err
+	}
+	if input.Type != nil && *input.Type != field.Type {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "The type of a field cannot be changed"})
+	}
+
+	updates := map[string]interface{}{}
+	if input.Name != nil {
+		name, err := fieldName(*input.Name)
+		if err != nil {
+			return err
+		}
+		if fieldNameTaken(board.ID, name, field.ID) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"success": false, "error": "The board already has a field with this name"})
+		}
+		updates["name"] = name
+	}
+	var removed []string
+	if input.Options != nil {
+		if !isSelectField(field.Type) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Only select fields have options"})
+		}
+		options, gone, err := fieldOptions(*input.Options, field.Options)
+		if err != nil {
+			return err
+		}
+		updates["options"], removed = options, gone
+	}
+	moving := afterID != nil || beforeID != nil
+	if len(updates) == 0 && !moving {
+		return c.JSON(fiber.Map{"success": true, "data": field})
+	}
+
+	var rev int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockBoards(tx, board.ID); err != nil {
+			return err
+		}
+		if moving {
+			list := customFieldList(board.ID)
+			if err := list.lock(tx); err != nil {
+				return err
+			}
+			rank, err := list.place(tx, field.ID, afterID, beforeID)
+			if err != nil {
+				return err
+			}
+			updates["rank"] = rank
+		}
+		updates["updated_at"] = time.Now()
+		if err := tx.Model(&models.CustomField{}).Where("id = ?", field.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := dropFieldOptions(tx, field.ID, removed); err != nil {
+			return err
+		}
+		rev, err = bumpBoardRevision(tx, board.ID)
+		return err
+	})
+	if err != nil {
+		return txError(err, "Failed to update custom field")
+	}
+
+	database.DB.First(&field, "id = ?", field.ID)
+	publishBoardEvent(board.ID, rev, ws.TypeCustomFieldUpdated, field)
+	return c.JSON(fiber.Map{"success": true, "data": field})
+}
+
+// DELETE /api/fields/:id
+//
+// Deletes the field and its values on every card.
+func DeleteCustomField(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	fieldID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid custom field ID"})
+	}
+
+	field, board, err := loadCustomField(fieldID, userID, policy.Edit)
+	if err != nil {
+		return err
+	}
+
+	var rev int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockBoards(tx, board.ID); err != nil {
+			return err
+		}
+		if err := tx.Where("field_id = ?", field.ID).Delete(&models.CardFieldValue{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&field).Error; err != nil {
+			return err
+		}
+		rev, err = bumpBoardRevision(tx, board.ID)
+		return err
+	})
+	if err != nil {
+		return txError(err, "Failed to delete custom field")
+	}
+
+	publishBoardEvent(board.ID, rev, ws.TypeCustomFieldDeleted, fiber.Map{"field_id": field.ID})
+	return c.JSON(fiber.Map{"success": true, "message": "Custom field deleted successfully"})
+}
@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"tether-server/database"
+	"tether-server/models"
+	"tether-server/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// How long email invitations stay valid
+const emailInvitationTTL = 7 * 24 * time.Hour
+
+var errInvitationUnavailable = errors.New("invitation is no longer valid")
+
+// POST /api/workspaces/:id/invitations
+//
+// With an email, invites that address and mails them a link. Without one,
+// creates a shareable link invitation limited by expires_in_hours and
+// max_uses (both optional).
+func CreateWorkspaceInvitation(c *fiber.Ctx) error {
+	workspace, me, err := loadWorkspaceMembership(c)
+	if err != nil {
+		return err
+	}
+	if workspaceRoleRank[me.Role] < workspaceRoleRank["admin"] {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Only workspace admins can invite people"})
+	}
+	var input struct {
+		Email          string `json:"email"`
+		Role           string `json:"role"`
+		ExpiresInHours int    `json:"expires_in_hours"`
+		MaxUses        int    `json:"max_uses"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+	if input.Role == "" {
+		input.Role = "member"
+	}
+	if input.Role != "admin" && input.Role != "member" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Role must be 'admin' or 'member'"})
+	}
+	// Admins may only hand out roles below their own
+	if workspaceRoleRank[input.Role] >= workspaceRoleRank[me.Role] {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Only the workspace owner can invite admins"})
+	}
+	if input.ExpiresInHours < 0 || input.MaxUses < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "expires_in_hours and max_uses must not be negative"})
+	}
+
+	token, err := utils.GenerateEmailToken()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to generate invitation token"})
+	}
+	now := time.Now()
+	invitation := models.WorkspaceInvitation{
+		ID:          uuid.New(),
+		WorkspaceID: workspace.ID,
+		InviterID:   me.UserID,
+		Token:       token,
+		Role:        input.Role,
+		MaxUses:     input.MaxUses,
+		Status:      "pending",
+		CreatedAt:   now,
+	}
+	if input.ExpiresInHours > 0 {
+		expiresAt := now.Add(time.Duration(input.ExpiresInHours) * time.Hour)
+		invitation.ExpiresAt = &expiresAt
+	}
+
+	email := strings.ToLower(strings.TrimSpace(input.Email))
+	if email == "" {
+		invitation.Kind = "link"
+	} else {
+		if !utils.IsValidEmail(email) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid email format"})
+		}
+		var count int64
+		database.DB.Model(&models.WorkspaceMember{}).
+			Joins("JOIN users ON users.id = workspace_members.user_id").
+			Where("workspace_members.workspace_id = ? AND lower(users.email) = ?", workspace.ID, email).
+			Count(&count)
+		if count > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"success": false, "error": "User is already a member"})
+		}
+		// Re-inviting replaces the earlier pending invitation
+		database.DB.Model(&models.WorkspaceInvitation{}).
+			Where("workspace_id = ? AND kind = ? AND email = ? AND status = ?", workspace.ID, "email", email, "pending").
+			Updates(map[string]interface{}{"status": "revoked", "responded_at": now})
+
+		expiresAt := now.Add(emailInvitationTTL)
+		invitation.Kind = "email"
+		invitation.Email = email
+		invitation.ExpiresAt = &expiresAt
+		invitation.MaxUses = 1
+	}
+
+	if err := database.DB.Create(&invitation).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to create invitation"})
+	}
+	if invitation.Kind == "email" {
+		var inviter models.User
+		database.DB.First(&inviter, "id = ?", me.UserID)
+		if err := utils.SendWorkspaceInvitationEmail(email, token, workspace.Name, inviter.DisplayName); err != nil {
+			log.Printf("Failed to send invitation email: %v", err)
+		}
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "data": invitation})
+}
+
+// GET /api/workspaces/:id/invitations
+//
+// Lists invitations that can still be accepted.
+func GetWorkspaceInvitations(c *fiber.Ctx) error {
+	workspace, me, err := loadWorkspaceMembership(c)
+	if err != nil {
+		return err
+	}
+	if workspaceRoleRank[me.Role] < workspaceRoleRank["admin"] {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Only workspace admins can view invitations"})
+	}
+	var invitations []models.WorkspaceInvitation
+	if err := usableInvitations(database.DB).
+		Where("workspace_id = ?", workspace.ID).
+		Preload("Inviter").
+		Order("created_at desc").
+		Find(&invitations).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to get invitations"})
+	}
+	return c.JSON(fiber.Map{"success": true, "data": invitations})
+}
+
+// DELETE /api/workspaces/:id/invitations/:invitationId
+func RevokeWorkspaceInvitation(c *fiber.Ctx) error {
+	workspace, me, err := loadWorkspaceMembership(c)
+	if err != nil {
+		return err
+	}
+	if workspaceRoleRank[me.Role] < workspaceRoleRank["admin"] {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Only workspace admins can revoke invitations"})
+	}
+	invitationID, err := uuid.Parse(c.Params("invitationId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid invitation ID"})
+	}
+	result := database.DB.Model(&models.WorkspaceInvitation{}).
+		Where("id = ? AND workspace_id = ? AND status = ?", invitationID, workspace.ID, "pending").
+		Updates(map[string]interface{}{"status": "revoked", "responded_at": time.Now()})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to revoke invitation"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Invitation not found"})
+	}
+	return c.JSON(fiber.Map{"success": true, "message": "Invitation revoked successfully"})
+}
+
+// GET /api/invitations
+//
+// Lists pending email invitations addressed to the caller.
+func GetMyInvitations(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	var invitations []models.WorkspaceInvitation
+	if err := usableInvitations(database.DB).
+		Where("kind = ? AND email = ?", "email", strings.ToLower(user.Email)).
+		Preload("Workspace").Preload("Inviter").
+		Order("created_at desc").
+		Find(&invitations).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to get invitations"})
+	}
+	return c.JSON(fiber.Map{"success": true, "data": invitations})
+}
+
+// GET /api/invitations/:token
+//
+// Shows what an invitation link leads to before accepting it.
+func GetInvitation(c *fiber.Ctx) error {
+	invitation, err := findUsableInvitation(c.Params("token"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Invitation not found or expired"})
+	}
+	return c.JSON(fiber.Map{"success": true, "data": fiber.Map{
+		"id":         invitation.ID,
+		"kind":       invitation.Kind,
+		"role":       invitation.Role,
+		"expires_at": invitation.ExpiresAt,
+		"workspace":  fiber.Map{"id": invitation.Workspace.ID, "name": invitation.Workspace.Name, "slug": invitation.Workspace.Slug},
+		"inviter":    fiber.Map{"id": invitation.Inviter.ID, "display_name": invitation.Inviter.DisplayName, "avatar_url": invitation.Inviter.AvatarURL},
+	}})
+}
+
+// POST /api/invitations/:token/accept
+func AcceptInvitation(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	invitation, err := findUsableInvitation(c.Params("token"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Invitation not found or expired"})
+	}
+	if invitation.Kind == "email" && !strings.EqualFold(invitation.Email, user.Email) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "This invitation was sent to a different email"})
+	}
+
+	var member models.WorkspaceMember
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		member, err = acceptInvitation(tx, invitation, user.ID)
+		return err
+	})
+	if err == errInvitationUnavailable {
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{"success": false, "error": "Invitation is no longer valid"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to accept invitation"})
+	}
+	return c.JSON(fiber.Map{"success": true, "data": member})
+}
+
+// POST /api/invitations/:token/decline
+func DeclineInvitation(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	invitation, err := findUsableInvitation(c.Params("token"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Invitation not found or expired"})
+	}
+	// Link invitations are shared with many people; ignoring one is enough
+	if invitation.Kind != "email" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Only email invitations can be declined"})
+	}
+	if !strings.EqualFold(invitation.Email, user.Email) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "This invitation was sent to a different email"})
+	}
+	if err := database.DB.Model(&invitation).Updates(map[string]interface{}{"status": "declined", "responded_at": time.Now()}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to decline invitation"})
+	}
+	return c.JSON(fiber.Map{"success": true, "message": "Invitation declined"})
+}
+
+// acceptPendingInvitations adds a user whose email was just verified to
+// every workspace that invited that email. It must not run before
+// verification: accepting uses up the invitation, so whoever registered the
+// address first could otherwise burn it.
+func acceptPendingInvitations(user models.User) {
+	var invitations []models.WorkspaceInvitation
+	if err := usableInvitations(database.DB).
+		Where("kind = ? AND email = ?", "email", strings.ToLower(user.Email)).
+		Find(&invitations).Error; err != nil {
+		log.Printf("Failed to load invitations for %s: %v", user.Email, err)
+		return
+	}
+	for _, invitation := range invitations {
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			_, err := acceptInvitation(tx, invitation, user.ID)
+			return err
+		})
+		if err != nil && err != errInvitationUnavailable {
+			log.Printf("Failed to accept invitation %s: %v", invitation.ID, err)
+		}
+	}
+}
+
+// acceptInvitation uses up one acceptance of the invitation and makes userID
+// a workspace member. Existing members keep their current role.
+func acceptInvitation(tx *gorm.DB, invitation models.WorkspaceInvitation, userID uuid.UUID) (models.WorkspaceMember, error) {
+	var member models.WorkspaceMember
+	now := time.Now()
+	updates := map[string]interface{}{"use_count": gorm.Expr("use_count + 1")}
+	if invitation.Kind == "email" {
+		updates["status"] = "accepted"
+		updates["accepted_by_id"] = userID
+		updates["responded_at"] = now
+	}
+	// Claim a use atomically so concurrent acceptances cannot exceed max_uses
+	result := usableInvitations(tx.Model(&models.WorkspaceInvitation{})).
+		Where("id = ?", invitation.ID).
+		Updates(updates)
+	if result.Error != nil {
+		return member, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return member, errInvitationUnavailable
+	}
+
+	err := tx.Where("workspace_id = ? AND user_id = ?", invitation.WorkspaceID, userID).First(&member).Error
+	if err == nil {
+		return member, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return member, err
+	}
+	member = models.WorkspaceMember{
+		ID:          uuid.New(),
+		WorkspaceID: invitation.WorkspaceID,
+		UserID:      userID,
+		Role:        invitation.Role,
+		JoinedAt:    now,
+	}
+	return member, tx.Create(&member).Error
+}
+
+// usableInvitations scopes a query to invitations that can still be
+// accepted: pending, not expired and not used up.
+func usableInvitations(db *gorm.DB) *gorm.DB {
+	return db.Where("status = ? AND (expires_at IS NULL OR expires_at > ?) AND (max_uses = 0 OR use_count < max_uses)", "pending", time.Now())
+}
+
+func findUsableInvitation(token string) (models.WorkspaceInvitation, error) {
+	var invitation models.WorkspaceInvitation
+	err := usableInvitations(database.DB).
+		Where("token = ?", token).
+		Preload("Workspace").Preload("Inviter").
+		First(&invitation).Error
+	if err == nil && invitation.Workspace.ID == uuid.Nil {
+		// The workspace has been deleted
+		err = gorm.ErrRecordNotFound
+	}
+	return invitation, err
+}
+
+// currentUser loads the authenticated user. Errors are *fiber.Error values.
+func currentUser(c *fiber.Ctx) (models.User, error) {
+	var user models.User
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return user, fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+	}
+	if err := database.DB.First(&user, "id = ?", userID).Error; err != nil {
+		return user, fiber.NewError(fiber.StatusNotFound, "User not found")
+	}
+	return user, nil
+}
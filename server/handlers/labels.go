@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"strings"
+	"tether-server/database"
+	"tether-server/models"
+	"tether-server/policy"
+	"tether-server/ws"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Longest label name, in bytes
+const maxLabelNameLength = 100
+
+// withCardRelations preloads what clients show with a card.
+func withCardRelations(db *gorm.DB) *gorm.DB {
+	return db.Preload("Assignees").Preload("Labels", orderByName).Preload("Contact").Preload("Company").Preload("FieldValues").Preload("CreatedBy")
+}
+
+// orderByName is a Preload condition that returns labels alphabetically.
+func orderByName(db *gorm.DB) *gorm.DB {
+	return db.Order("lower(name), id")
+}
+
+// parseIDList parses a list of ids sent by the client, dropping duplicates.
+func parseIDList(values []string, name string) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, 0, len(values))
+	for _, v := range values {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid "+name)
+		}
+		ids = append(ids, id)
+	}
+	return uniqueIDs(ids, uuid.Nil), nil
+}
+
+// checkLabels verifies that every label in ids belongs to the board.
+func checkLabels(boardID uuid.UUID, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var count int64
+	if err := database.DB.Model(&models.Label{}).Where("board_id = ? AND id IN ?", boardID, ids).Count(&count).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to check labels")
+	}
+	if count != int64(len(ids)) {
+		return fiber.NewError(fiber.StatusBadRequest, "Labels must belong to the card's board")
+	}
+	return nil
+}
+
+// setCardAssignees replaces the card's assignees inside tx.
+func setCardAssignees(tx *gorm.DB, cardID uuid.UUID, userIDs []uuid.UUID) error {
+	if err := tx.Where("card_id = ?", cardID).Delete(&models.CardAssignee{}).Error; err != nil {
+		return err
+	}
+	if len(userIDs) == 0 {
+		return nil
+	}
+	rows := make([]models.CardAssignee, len(userIDs))
+	for i, id := range userIDs {
+		rows[i] = models.CardAssignee{CardID: cardID, UserID: id, CreatedAt: time.Now()}
+	}
+	return tx.Create(&rows).Error
+}
+
+// setCardLabels replaces the card's labels inside tx.
+func setCardLabels(tx *gorm.DB, cardID uuid.UUID, labelIDs []uuid.UUID) error {
+	if err := tx.Where("card_id = ?", cardID).Delete(&models.CardLabel{}).Error; err != nil {
+		return err
+	}
+	if len(labelIDs) == 0 {
+		return nil
+	}
+	rows := make([]models.CardLabel, len(labelIDs))
+	for i, id := range labelIDs {
+		rows[i] = models.CardLabel{CardID: cardID, LabelID: id, CreatedAt: time.Now()}
+	}
+	return tx.Create(&rows).Error
+}
+
+// dropForeignLabels removes labels of other boards from a card that moved
+// to boardID.
+func dropForeignLabels(tx *gorm.DB, cardID, boardID uuid.UUID) error {
+	return tx.Where("card_id = ? AND label_id NOT IN (SELECT id FROM labels WHERE board_id = ?)", cardID, boardID).
+		Delete(&models.CardLabel{}).Error
+}
+
+// cardAssigneeIDs and cardLabelIDs return a card's current associations, for
+// activity diffs.
+func cardAssigneeIDs(card models.Card) []uuid.UUID {
+	ids := make([]uuid.UUID, len(card.Assignees))
+	for i, u := range card.Assignees {
+		ids[i] = u.ID
+	}
+	return ids
+}
+
+func cardLabelIDs(card models.Card) []uuid.UUID {
+	ids := make([]uuid.UUID, len(card.Labels))
+	for i, l := range card.Labels {
+		ids[i] = l.ID
+	}
+	return ids
+}
+
+// sameIDs reports whether a and b hold the same ids, in any order.
+func sameIDs(a, b []uuid.UUID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[uuid.UUID]bool, len(a))
+	for _, id := range a {
+		set[id] = true
+	}
+	for _, id := range b {
+		if !set[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// labelName trims and validates a label name.
+func labelName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Name is required")
+	}
+	if len(name) > maxLabelNameLength {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Name is too long")
+	}
+	return name, nil
+}
+
+// labelNameTaken reports whether the board has another label with the same
+// name, ignoring case.
+func labelNameTaken(boardID uuid.UUID, name string, except uuid.UUID) bool {
+	var count int64
+	database.DB.Model(&models.Label{}).
+		Where("board_id = ? AND lower(name) = lower(?) AND id <> ?", boardID, name, except).Count(&count)
+	return count > 0
+}
+
+// loadLabel loads a label with its board for a caller who needs required on
+// that board.
+func loadLabel(labelID, userID uuid.UUID, required policy.Permission) (models.Label, models.Board, error) {
+	var label models.Label
+	if err := database.DB.First(&label, "id = ?", labelID).Error; err != nil {
+		return label, models.Board{}, fiber.NewError(fiber.StatusNotFound, "Label not found")
+	}
+	board, err := loadBoard(label.BoardID, userID, required)
+	return label, board, err
+}
+
+// GET /api/boards/:id/labels
+func GetBoardLabels(c *fiber.Ctx) error {
+	board, _, err := loadRouteBoard(c, policy.View)
+	if err != nil {
+		return err
+	}
+	labels := []models.Label{}
+	if err := orderByName(database.DB.Where("board_id = ?", board.ID)).Find(&labels).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to get labels"})
+	}
+	return c.JSON(fiber.Map{"success": true, "data": labels})
+}
+
+// POST /api/boards/:id/labels
+func CreateLabel(c *fiber.Ctx) error {
+	board, _, err := loadRouteBoard(c, policy.Edit)
+	if err != nil {
+		return err
+	}
+
+	var input struct {
+		Name  string `json:"name"`
+		Color string `json:"color"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+	name, err := labelName(input.Name)
+	if err != nil {
+		return err
+	}
+	if labelNameTaken(board.ID, name, uuid.Nil) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"success": false, "error": "The board already has a label with this name"})
+	}
+	if input.Color == "" {
+		input.Color = "#6B7280"
+	}
+
+	label := models.Label{ID: uuid.New(), BoardID: board.ID, Name: name, Color: input.Color}
+	var rev int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockBoards(tx, board.ID); err != nil {
+			return err
+		}
+		if err := tx.Create(&label).Error; err != nil {
+			return err
+		}
+		rev, err = bumpBoardRevision(tx, board.ID)
+		return err
+	})
+	if err != nil {
+		return txError(err, "Failed to create label")
+	}
+
+	publishBoardEvent(board.ID, rev, ws.TypeLabelCreated, label)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "data": label})
+}
+
+// PUT /api/labels/:id
+func UpdateLabel(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	labelID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid label ID"})
+	}
+
+	var input struct {
+		Name  *string `json:"name"`
+		Color *string `json:"color"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+
+	label, board, err := loadLabel(labelID, userID, policy.Edit)
+	if err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{}
+	if input.Name != nil {
+		name, err := labelName(*input.Name)
+		if err != nil {
+			return err
+		}
+		if labelNameTaken(board.ID, name, label.ID) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"success": false, "error": "The board already has a label with this name"})
+		}
+		updates["name"] = name
+	}
+	if input.Color != nil && *input.Color != "" {
+		updates["color"] = *input.Color
+	}
+	if len(updates) == 0 {
+		return c.JSON(fiber.Map{"success": true, "data": label})
+	}
+
+	var rev int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockBoards(tx, board.ID); err != nil {
+			return err
+		}
+		updates["updated_at"] = time.Now()
+		if err := tx.Model(&models.Label{}).Where("id = ?", label.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		rev, err = bumpBoardRevision(tx, board.ID)
+		return err
+	})
+	if err != nil {
+		return txError(err, "Failed to update label")
+	}
+
+	database.DB.First(&label, "id = ?", label.ID)
+	publishBoardEvent(board.ID, rev, ws.TypeLabelUpdated, label)
+	return c.JSON(fiber.Map{"success": true, "data": label})
+}
+
+// DELETE /api/labels/:id
+//
+// Deletes the label and takes it off every card.
+func DeleteLabel(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	labelID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid label ID"})
+	}
+
+	label, board, err := loadLabel(labelID, userID, policy.Edit)
+	if err != nil {
+		return err
+	}
+
+	var rev int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockBoards(tx, board.ID); err != nil {
+			return err
+		}
+		if err := tx.Where("label_id = ?", label.ID).Delete(&models.CardLabel{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&label).Error; err != nil {
+			return err
+		}
+		rev, err = bumpBoardRevision(tx, board.ID)
+		return err
+	})
+	if err != nil {
+		return txError(err, "Failed to delete label")
+	}
+
+	publishBoardEvent(board.ID, rev, ws.TypeLabelDeleted, fiber.Map{"label_id": label.ID})
+	return c.JSON(fiber.Map{"success": true, "message": "Label deleted successfully"})
+}
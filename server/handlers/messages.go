@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"tether-server/config"
+	"tether-server/database"
+	"tether-server/models"
+	"tether-server/ws"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// findMessageForUser loads a message together with its chat, checking that
+// the user is a member of that chat.
+func findMessageForUser(messageID, userID uuid.UUID) (models.Message, models.Chat, error) {
+	var msg models.Message
+	if err := database.DB.First(&msg, "id = ?", messageID).Error; err != nil {
+		return msg, models.Chat{}, err
+	}
+	chat, err := findChatForUser(msg.ChatID, userID)
+	return msg, chat, err
+}
+
+// withinEditWindow reports whether the configured edit window still allows
+// the author to change msg.
+func withinEditWindow(msg models.Message) bool {
+	window := config.AppConfig.MessageEditWindow
+	return window <= 0 || time.Since(msg.CreatedAt) <= window
+}
+
+// PUT /api/messages/:id
+func UpdateMessage(c *fiber.Ctx) error {
+	userIDStr := c.Locals("user_id").(string)
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	messageID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid message ID"})
+	}
+	var input struct {
+		Content      string `json:"content"`
+		Ciphertext   string `json:"ciphertext"`
+		Nonce        string `json:"nonce"`
+		Alg          string `json:"alg"`
+		EphemeralPub string `json:"ephemeral_pub"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+
+	msg, chat, err := findMessageForUser(messageID, userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Message not found"})
+	}
+	if msg.SenderID != userID || msg.Type != "text" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Only the author can edit a message"})
+	}
+	if msg.DeletedAt != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Message has been deleted"})
+	}
+	if !withinEditWindow(msg) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Edit window has expired"})
+	}
+	// An edit keeps the message's kind: E2EE messages are replaced with a new
+	// envelope, plaintext messages with new content.
+	if msg.Ciphertext != "" {
+		if input.Ciphertext == "" || input.Content != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Encrypted messages must be edited with a new ciphertext"})
+		}
+	} else if input.Content == "" || input.Ciphertext != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Empty message"})
+	}
+
+	now := time.Now()
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		previous := models.MessageEdit{
+			ID:           uuid.New(),
+			MessageID:    msg.ID,
+			Content:      msg.Content,
+			Ciphertext:   msg.Ciphertext,
+			Nonce:        msg.Nonce,
+			Alg:          msg.Alg,
+			EphemeralPub: msg.EphemeralPub,
+			EditedAt:     now,
+		}
+		if err := tx.Create(&previous).Error; err != nil {
+			return err
+		}
+		return tx.Model(&msg).Updates(map[string]interface{}{
+			"content":       input.Content,
+			"ciphertext":    input.Ciphertext,
+			"nonce":         input.Nonce,
+			"alg":           input.Alg,
+			"ephemeral_pub": input.EphemeralPub,
+			"edited_at":     now,
+		}).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to edit message"})
+	}
+	msg.Content = input.Content
+	msg.Ciphertext = input.Ciphertext
+	msg.Nonce = input.Nonce
+	msg.Alg = input.Alg
+	msg.EphemeralPub = input.EphemeralPub
+	msg.EditedAt = &now
+	fillMessagePreviews([]*models.Message{&msg})
+	fillAttachments([]*models.Message{&msg})
+
+	ws.Publish(chatMemberIDs(chat.ID), ws.TypeMessageEdited, chat.ID, msg)
+	return c.JSON(fiber.Map{"success": true, "data": msg})
+}
+
+// DELETE /api/messages/:id?scope=me|everyone
+//
+// scope=me (default) hides the message from the caller's history only.
+// scope=everyone replaces it with a tombstone for all members; allowed for
+// the author within the edit window and for group chat owners and admins.
+func DeleteMessage(c *fiber.Ctx) error {
+	userIDStr := c.Locals("user_id").(string)
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	messageID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid message ID"})
+	}
+	scope := c.Query("scope", "me")
+	if scope != "me" && scope != "everyone" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Scope must be 'me' or 'everyone'"})
+	}
+
+	msg, chat, err := findMessageForUser(messageID, userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Message not found"})
+	}
+
+	if scope == "me" {
+		hide := models.MessageHide{ID: uuid.New(), MessageID: msg.ID, UserID: userID, CreatedAt: time.Now()}
+		if err := database.DB.Where("message_id = ? AND user_id = ?", msg.ID, userID).FirstOrCreate(&hide).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to delete message"})
+		}
+		// Only the caller's other devices need to know
+		ws.Publish([]uuid.UUID{userID}, ws.TypeMessageDeleted, chat.ID, fiber.Map{"message_id": msg.ID, "scope": scope})
+		return c.JSON(fiber.Map{"success": true, "message": "Message deleted successfully"})
+	}
+
+	allowed := msg.SenderID == userID && msg.Type == "text" && withinEditWindow(msg)
+	if !allowed && chat.Type == "group" {
+		var member models.ChatMember
+		if err := database.DB.Where("chat_id = ? AND user_id = ?", chat.ID, userID).First(&member).Error; err == nil {
+			allowed = chatRoleRank[member.Role] >= chatRoleRank["admin"]
+		}
+	}
+	if !allowed {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Access denied"})
+	}
+	if msg.DeletedAt != nil {
+		return c.JSON(fiber.Map{"success": true, "message": "Message deleted successfully"})
+	}
+
+	now := time.Now()
+	var objectKeys []string
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Retracting a message also retracts its earlier versions and files
+		if err := tx.Where("message_id = ?", msg.ID).Delete(&models.MessageEdit{}).Error; err != nil {
+			return err
+		}
+		keys, err := deleteAttachments(tx, "message_id = ?", msg.ID)
+		if err != nil {
+			return err
+		}
+		objectKeys = keys
+		return tx.Model(&msg).Updates(map[string]interface{}{
+			"content":       "",
+			"ciphertext":    "",
+			"nonce":         "",
+			"alg":           "",
+			"ephemeral_pub": "",
+			"deleted_at":    now,
+		}).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to delete message"})
+	}
+	removeUnreferencedObjects(objectKeys)
+
+	ws.Publish(chatMemberIDs(chat.ID), ws.TypeMessageDeleted, chat.ID, fiber.Map{"message_id": msg.ID, "scope": scope, "deleted_at": now})
+	return c.JSON(fiber.Map{"success": true, "message": "Message deleted successfully"})
+}
+
+// GET /api/messages/:id/edits
+func GetMessageEdits(c *fiber.Ctx) error {
+	userIDStr := c.Locals("user_id").(string)
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	messageID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid message ID"})
+	}
+	msg, _, err := findMessageForUser(messageID, userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Message not found"})
+	}
+	var edits []models.MessageEdit
+	if err := database.DB.Where("message_id = ?", msg.ID).Order("edited_at asc").Find(&edits).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to get message history"})
+	}
+	return c.JSON(fiber.Map{"success": true, "data": edits})
+}
+
+// POST /api/messages/:id/forward
+//
+// Copies a message into another chat the caller belongs to. Plaintext content
+// is copied by the server; E2EE messages must be re-encrypted by the client
+// for the target chat and sent as a new envelope.
+func ForwardMessage(c *fiber.Ctx) error {
+	userIDStr := c.Locals("user_id").(string)
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	messageID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid message ID"})
+	}
+	var input struct {
+		ChatID       uuid.UUID `json:"chat_id"`
+		ClientID     string    `json:"client_id"`
+		Ciphertext   string    `json:"ciphertext"`
+		Nonce        string    `json:"nonce"`
+		Alg          string    `json:"alg"`
+		EphemeralPub string    `json:"ephemeral_pub"`
+		// Re-uploaded copies of encrypted attachments, which are not
+		// carried over by the server
+		AttachmentIDs []uuid.UUID `json:"attachment_ids"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.ChatID == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+
+	source, _, err := findMessageForUser(messageID, userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Message not found"})
+	}
+	if source.Type != "text" || source.DeletedAt != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Message cannot be forwarded"})
+	}
+	target, err := findChatForUser(input.ChatID, userID)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Access denied"})
+	}
+
+	copied := messageInput{ClientID: input.ClientID, AttachmentIDs: input.AttachmentIDs, forwardedFrom: &source}
+	if source.Ciphertext != "" {
+		if input.Ciphertext == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Encrypted messages must be re-encrypted for the target chat"})
+		}
+		copied.Ciphertext = input.Ciphertext
+		copied.Nonce = input.Nonce
+		copied.Alg = input.Alg
+		copied.EphemeralPub = input.EphemeralPub
+	} else {
+		copied.Content = source.Content
+	}
+
+	msg, created, err := createMessage(target, userID, copied)
+	if err == errInvalidAttachment {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Attachments must be completed uploads of yours in the same chat"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to forward message"})
+	}
+	if created {
+		ws.Publish(otherParticipants(target.ID, userID), ws.TypeMessageNew, target.ID, msg)
+	}
+	return c.JSON(fiber.Map{"success": true, "data": msg})
+}
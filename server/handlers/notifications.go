@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"tether-server/database"
+	"tether-server/models"
+	"tether-server/ws"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Notification list page sizes
+const (
+	defaultNotificationPageSize = 50
+	maxNotificationPageSize     = 100
+)
+
+// createNotifications stores notifications inside tx. Push them with
+// pushNotifications once the transaction has committed.
+func createNotifications(tx *gorm.DB, notifications []models.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	now := time.Now()
+	for i := range notifications {
+		notifications[i].ID = uuid.New()
+		notifications[i].CreatedAt = now
+	}
+	return tx.Omit("Actor").Create(&notifications).Error
+}
+
+// pushNotifications sends each notification to its user's open sockets.
+func pushNotifications(notifications []models.Notification, actor models.User) {
+	for _, n := range notifications {
+		n.Actor = actor
+		ws.Publish([]uuid.UUID{n.UserID}, ws.TypeNotification, uuid.Nil, n)
+	}
+}
+
+// GET /api/notifications?unread=true&before=&limit=
+//
+// The caller's notifications, newest first.
+func GetNotifications(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	limit := c.QueryInt("limit", defaultNotificationPageSize)
+	if limit <= 0 {
+		limit = defaultNotificationPageSize
+	}
+	if limit > maxNotificationPageSize {
+		limit = maxNotificationPageSize
+	}
+
+	q := database.DB.Where("user_id = ?", userID)
+	if c.QueryBool("unread") {
+		q = q.Where("read_at IS NULL")
+	}
+	if before := c.Query("before"); before != "" {
+		id, err := uuid.Parse(before)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid cursor"})
+		}
+		var cursor models.Notification
+		if err := database.DB.First(&cursor, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Notification not found"})
+		}
+		q = q.Where("(created_at, id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+	}
+
+	notifications := []models.Notification{}
+	if err := q.Preload("Actor").Order("created_at desc, id desc").Limit(limit + 1).Find(&notifications).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to get notifications"})
+	}
+	hasMore := len(notifications) > limit
+	if hasMore {
+		notifications = notifications[:limit]
+	}
+
+	var unread int64
+	database.DB.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&unread)
+
+	return c.JSON(fiber.Map{"success": true, "data": notifications, "has_more": hasMore, "unread_count": unread})
+}
+
+// POST /api/notifications/:id/read
+func MarkNotificationRead(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid notification ID"})
+	}
+
+	var notification models.Notification
+	if err := database.DB.First(&notification, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Notification not found"})
+	}
+	if notification.ReadAt == nil {
+		now := time.Now()
+		if err := database.DB.Model(&notification).Update("read_at", now).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to update notification"})
+		}
+		notification.ReadAt = &now
+	}
+	return c.JSON(fiber.Map{"success": true, "data": notification})
+}
+
+// POST /api/notifications/read
+//
+// Marks all of the caller's notifications as read.
+func MarkAllNotificationsRead(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	result := database.DB.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to update notifications"})
+	}
+	return c.JSON(fiber.Map{"success": true, "data": fiber.Map{"updated": result.RowsAffected}})
+}
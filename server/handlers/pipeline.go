@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"tether-server/database"
+	"tether-server/policy"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// pipelineStages are the deal statuses of CRM cards in pipeline order, with
+// the chance of a deal in that stage being won, used for weighted value.
+var pipelineStages = []struct {
+	status      string
+	probability float64
+}{
+	{"new", 0.1},
+	{"contacted", 0.2},
+	{"qualified", 0.4},
+	{"proposal", 0.6},
+	{"negotiation", 0.8},
+	{"closed-won", 1},
+	{"closed-lost", 0},
+}
+
+// Statuses that end a deal; they have no time in stage
+var closedStatuses = []string{"closed-won", "closed-lost"}
+
+// stagesSQL is pipelineStages as a VALUES list, joined as
+// stages(status, probability).
+var stagesSQL = func() string {
+	rows := make([]string, len(pipelineStages))
+	for i, s := range pipelineStages {
+		rows[i] = fmt.Sprintf("('%s', %g::numeric)", s.status, s.probability)
+	}
+	return "(VALUES " + strings.Join(rows, ", ") + ") AS stages(status, probability)"
+}()
+
+type pipelineStatus struct {
+	Status        string   `json:"status"`
+	Deals         int64    `json:"deals"`
+	Value         float64  `json:"value"`
+	WeightedValue float64  `json:"weighted_value"`
+	AvgHours      *float64 `json:"avg_hours_in_stage" gorm:"-"` // null for closed statuses and stages no deal has been in
+}
+
+type pipelineColumn struct {
+	ColumnID      uuid.UUID `json:"column_id"`
+	Name          string    `json:"name"`
+	Deals         int64     `json:"deals"`
+	Value         float64   `json:"value"`
+	WeightedValue float64   `json:"weighted_value"`
+}
+
+type pipelineTotals struct {
+	Deals         int64    `json:"deals"`
+	Value         float64  `json:"value"`
+	WeightedValue float64  `json:"weighted_value"`
+	OpenDeals     int64    `json:"open_deals"`
+	OpenValue     float64  `json:"open_value"`
+	WonDeals      int64    `json:"won_deals"`
+	WonValue      float64  `json:"won_value"`
+	LostDeals     int64    `json:"lost_deals"`
+	LostValue     float64  `json:"lost_value"`
+	WinRate       *float64 `json:"win_rate"` // won / (won + lost); null until a deal is closed
+}
+
+// parseDateParam accepts an RFC 3339 time or a date. A date used as the end
+// of a range includes that whole day.
+func parseDateParam(s string, end bool) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return nil, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// GET /api/boards/:id/pipeline?from=&to=&assignees=&labels=
+//
+// Sales pipeline of a CRM board: deal counts and summed and weighted value
+// per status and per column, win rate and average time spent in each open
+// stage. from/to limit it to deals created in that range; assignees and
+// labels filter as on GET /boards/:id.
+func GetBoardPipeline(c *fiber.Ctx) error {
+	board, userID, err := loadRouteBoard(c, policy.View)
+	if err != nil {
+		return err
+	}
+	if board.Type != "crm" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Pipeline analytics are only available for CRM boards"})
+	}
+
+	from, err := parseDateParam(c.Query("from"), false)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid from date"})
+	}
+	to, err := parseDateParam(c.Query("to"), true)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid to date"})
+	}
+	filter, err := parseCardFilter(c, userID)
+	if err != nil {
+		return err
+	}
+
+	// Conditions on the cards that count, as named arguments
+	args := map[string]interface{}{"board": board.ID, "closed": closedStatuses}
+	cardConds := []string{"cards.deleted_at IS NULL"}
+	if from != nil {
+		cardConds = append(cardConds, "cards.created_at >= @from")
+		args["from"] = *from
+	}
+	if to != nil {
+		cardConds = append(cardConds, "cards.created_at < @to")
+		args["to"] = *to
+	}
+	if cond, filterArgs := filter.sql(); cond != "" {
+		cardConds = append(cardConds, cond)
+		for k, v := range filterArgs {
+			args[k] = v
+		}
+	}
+	cardCond := strings.Join(cardConds, " AND ")
+	boardCond := "columns.board_id = @board AND columns.deleted_at IS NULL"
+
+	var statusRows []pipelineStatus
+	if err := database.DB.Raw(`
+		SELECT cards.status, count(*) AS deals, COALESCE(sum(cards.value), 0) AS value,
+			COALESCE(sum(cards.value * COALESCE(stages.probability, 0)), 0) AS weighted_value
+		FROM cards
+		JOIN columns ON columns.id = cards.column_id
+		LEFT JOIN `+stagesSQL+` ON stages.status = cards.status
+		WHERE `+boardCond+` AND `+cardCond+`
+		GROUP BY cards.status`, args).Scan(&statusRows).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to compute pipeline"})
+	}
+
+	columns := []pipelineColumn{}
+	if err := database.DB.Raw(`
+		SELECT columns.id AS column_id, columns.name, count(cards.id) AS deals, COALESCE(sum(cards.value), 0) AS value,
+			COALESCE(sum(cards.value * COALESCE(stages.probability, 0)), 0) AS weighted_value
+		FROM columns
+		LEFT JOIN cards ON cards.column_id = columns.id AND `+cardCond+`
+		LEFT JOIN `+stagesSQL+` ON stages.status = cards.status
+		WHERE `+boardCond+`
+		GROUP BY columns.id, columns.name, columns.rank
+		ORDER BY columns.rank COLLATE "C", columns.id`, args).Scan(&columns).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to compute pipeline"})
+	}
+
+	// A stint in a stage lasts until the card's next status change, or until
+	// now for the stage it is in
+	var stageTimes []struct {
+		Status   string
+		AvgHours float64
+	}
+	if err := database.DB.Raw(`
+		SELECT stints.status, avg(EXTRACT(EPOCH FROM stints.left_at - stints.entered_at)) / 3600 AS avg_hours
+		FROM (
+			SELECT h.to_status AS status, h.changed_at AS entered_at,
+				COALESCE(lead(h.changed_at) OVER (PARTITION BY h.card_id ORDER BY h.changed_at, h.id), now()) AS left_at
+			FROM card_status_changes h
+			JOIN cards ON cards.id = h.card_id
+			JOIN columns ON columns.id = cards.column_id
+			WHERE `+boardCond+` AND `+cardCond+`
+		) AS stints
+		WHERE stints.status NOT IN @closed
+		GROUP BY stints.status`, args).Scan(&stageTimes).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to compute pipeline"})
+	}
+
+	// Every stage in pipeline order, then any statuses outside the pipeline
+	byStatus := make([]pipelineStatus, 0, len(pipelineStages))
+	rows := map[string]pipelineStatus{}
+	for _, row := range statusRows {
+		rows[row.Status] = row
+	}
+	for _, stage := range pipelineStages {
+		row := rows[stage.status]
+		row.Status = stage.status
+		byStatus = append(byStatus, row)
+		delete(rows, stage.status)
+	}
+	for _, row := range statusRows {
+		if _, ok := rows[row.Status]; ok {
+			byStatus = append(byStatus, row)
+		}
+	}
+	for i := range byStatus {
+		for _, t := range stageTimes {
+			if t.Status == byStatus[i].Status {
+				hours := t.AvgHours
+				byStatus[i].AvgHours = &hours
+			}
+		}
+	}
+
+	var totals pipelineTotals
+	for _, row := range byStatus {
+		totals.Deals += row.Deals
+		totals.Value += row.Value
+		totals.WeightedValue += row.WeightedValue
+		switch row.Status {
+		case "closed-won":
+			totals.WonDeals, totals.WonValue = row.Deals, row.Value
+		case "closed-lost":
+			totals.LostDeals, totals.LostValue = row.Deals, row.Value
+		default:
+			totals.OpenDeals += row.Deals
+			totals.OpenValue += row.Value
+		}
+	}
+	if closed := totals.WonDeals + totals.LostDeals; closed > 0 {
+		rate := float64(totals.WonDeals) / float64(closed)
+		totals.WinRate = &rate
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": fiber.Map{
+		"totals":    totals,
+		"by_status": byStatus,
+		"by_column": columns,
+	}})
+}
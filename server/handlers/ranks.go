@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"tether-server/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// rankOrder sorts columns and cards by rank. Ranks compare bytewise, which
+// the database collation may not do.
+const rankOrder = `rank COLLATE "C", id`
+
+// Ranks longer than this trigger renumbering of their list
+const maxRankLength = 48
+
+var errListChanged = fiber.NewError(fiber.StatusConflict, "The list has changed, reload and try again")
+
+// orderByRank is a Preload condition that returns columns or cards in order.
+func orderByRank(db *gorm.DB) *gorm.DB {
+	return db.Order(rankOrder)
+}
+
+// rankedList is the ordered set of cards of one column, columns or custom
+// fields of one board, checklists of one card or items of one checklist.
+type rankedList struct {
+	table       string    // "cards", "columns", "custom_fields", "checklists" or "checklist_items"
+	parentTable string    // "columns", "boards", "cards" or "checklists"
+	parentKey   string    // "column_id", "board_id", "card_id" or "checklist_id"
+	parentID    uuid.UUID // the column, board, card or checklist
+}
+
+func cardList(columnID uuid.UUID) rankedList {
+	return rankedList{"cards", "columns", "column_id", columnID}
+}
+
+func columnList(boardID uuid.UUID) rankedList {
+	return rankedList{"columns", "boards", "board_id", boardID}
+}
+
+func customFieldList(boardID uuid.UUID) rankedList {
+	return rankedList{"custom_fields", "boards", "board_id", boardID}
+}
+
+func checklistList(cardID uuid.UUID) rankedList {
+	return rankedList{"checklists", "cards", "card_id", cardID}
+}
+
+func checklistItemList(checklistID uuid.UUID) rankedList {
+	return rankedList{"checklist_items", "checklists", "checklist_id", checklistID}
+}
+
+type rankedItem struct {
+	ID   uuid.UUID
+	Rank string
+}
+
+// lock takes a row lock on the list's parent so that concurrent moves into
+// the same list are serialized. It must run inside a transaction.
+func (l rankedList) lock(tx *gorm.DB) error {
+	var ids []uuid.UUID
+	err := tx.Table(l.parentTable).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND deleted_at IS NULL", l.parentID).Pluck("id", &ids).Error
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Not found")
+	}
+	return nil
+}
+
+// items returns the list in order, leaving out the item being placed.
+func (l rankedList) items(tx *gorm.DB, except uuid.UUID) ([]rankedItem, error) {
+	var items []rankedItem
+	err := tx.Table(l.table).Select("id, rank").
+		Where(l.parentKey+" = ? AND id <> ? AND deleted_at IS NULL", l.parentID, except).
+		Order(rankOrder).Scan(&items).Error
+	return items, err
+}
+
+// place returns a rank for item directly after the sibling after and
+// before the sibling before. Either may be nil; with neither the item goes
+// to the end. When both are given they must be adjacent, otherwise the
+// client's view is stale and errListChanged is returned. Lock the list
+// first.
+func (l rankedList) place(tx *gorm.DB, item uuid.UUID, after, before *uuid.UUID) (string, error) {
+	items, err := l.items(tx, item)
+	if err != nil {
+		return "", err
+	}
+	i, err := insertionIndex(items, after, before)
+	if err != nil {
+		return "", err
+	}
+
+	lower, upper := neighbourRanks(items, i)
+	if upper == "" || lower < upper {
+		if rank := utils.RankBetween(lower, upper); len(rank) <= maxRankLength {
+			return rank, nil
+		}
+	}
+
+	// Duplicate ranks or no room left: renumber the siblings, keeping their
+	// order and leaving slot i for the item
+	ranks := utils.RankSequence(len(items) + 1)
+	for j := range items {
+		rank := ranks[j]
+		if j >= i {
+			rank = ranks[j+1]
+		}
+		if err := tx.Table(l.table).Where("id = ?", items[j].ID).Update("rank", rank).Error; err != nil {
+			return "", err
+		}
+	}
+	return ranks[i], nil
+}
+
+// insertionIndex finds where in items a new item goes so that it follows
+// after and precedes before.
+func insertionIndex(items []rankedItem, after, before *uuid.UUID) (int, error) {
+	indexOf := func(id uuid.UUID) int {
+		for i := range items {
+			if items[i].ID == id {
+				return i
+			}
+		}
+		return -1
+	}
+
+	switch {
+	case after != nil:
+		i := indexOf(*after)
+		if i < 0 {
+			return 0, fiber.NewError(fiber.StatusBadRequest, "after_id is not in the target list")
+		}
+		if before != nil && (i+1 >= len(items) || items[i+1].ID != *before) {
+			return 0, errListChanged
+		}
+		return i + 1, nil
+	case before != nil:
+		i := indexOf(*before)
+		if i < 0 {
+			return 0, fiber.NewError(fiber.StatusBadRequest, "before_id is not in the target list")
+		}
+		return i, nil
+	default:
+		return len(items), nil
+	}
+}
+
+func neighbourRanks(items []rankedItem, i int) (lower, upper string) {
+	if i > 0 {
+		lower = items[i-1].Rank
+	}
+	if i < len(items) {
+		upper = items[i].Rank
+	}
+	return lower, upper
+}
+
+// parseNeighbour parses an optional after_id / before_id value.
+func parseNeighbour(s *string, name string) (*uuid.UUID, error) {
+	if s == nil || *s == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(*s)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid "+name)
+	}
+	return &id, nil
+}
+
+// txError passes *fiber.Error values returned from a transaction through
+// and reports anything else as a 500 with msg.
+func txError(err error, msg string) error {
+	if fe, ok := err.(*fiber.Error); ok {
+		return fe
+	}
+	return fiber.NewError(fiber.StatusInternalServerError, msg)
+}
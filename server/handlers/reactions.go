@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"strings"
+	"tether-server/database"
+	"tether-server/models"
+	"tether-server/ws"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Maximum number of distinct emoji on a single message
+const maxDistinctReactions = 20
+
+// validEmoji performs a light sanity check: a short, printable token with no
+// whitespace. Clients are responsible for offering real emoji.
+func validEmoji(emoji string) bool {
+	if emoji == "" || len(emoji) > 32 || !utf8.ValidString(emoji) {
+		return false
+	}
+	return strings.IndexFunc(emoji, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}) < 0
+}
+
+// POST /api/messages/:id/reactions
+func AddReaction(c *fiber.Ctx) error {
+	userIDStr := c.Locals("user_id").(string)
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	messageID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid message ID"})
+	}
+	var input struct {
+		Emoji string `json:"emoji"`
+	}
+	if err := c.BodyParser(&input); err != nil || !validEmoji(input.Emoji) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid emoji"})
+	}
+
+	// Проверка доступа: участник чата, в котором находится сообщение
+	msg, chat, err := findMessageForUser(messageID, userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Message not found"})
+	}
+	if msg.Type != "text" || msg.DeletedAt != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Cannot react to this message"})
+	}
+
+	// The message row lock serializes reactions on the message, so concurrent
+	// new emoji cannot both pass the distinct limit
+	reaction := models.MessageReaction{ID: uuid.New(), MessageID: msg.ID, UserID: userID, Emoji: input.Emoji, CreatedAt: time.Now()}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.Message{}, "id = ?", msg.ID).Error; err != nil {
+			return err
+		}
+		var existing int64
+		if err := tx.Model(&models.MessageReaction{}).Where("message_id = ? AND emoji = ?", msg.ID, input.Emoji).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing == 0 {
+			var distinct int64
+			if err := tx.Model(&models.MessageReaction{}).Where("message_id = ?", msg.ID).Distinct("emoji").Count(&distinct).Error; err != nil {
+				return err
+			}
+			if distinct >= maxDistinctReactions {
+				return fiber.NewError(fiber.StatusBadRequest, "Too many different reactions on this message")
+			}
+		}
+		return tx.Where("message_id = ? AND user_id = ? AND emoji = ?", msg.ID, userID, input.Emoji).
+			FirstOrCreate(&reaction).Error
+	})
+	if err != nil {
+		return txError(err, "Failed to add reaction")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": publishReactions(chat, msg, userID, input.Emoji, "added")})
+}
+
+// DELETE /api/messages/:id/reactions?emoji=
+func RemoveReaction(c *fiber.Ctx) error {
+	userIDStr := c.Locals("user_id").(string)
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	messageID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid message ID"})
+	}
+	emoji := c.Query("emoji")
+	if !validEmoji(emoji) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid emoji"})
+	}
+
+	msg, chat, err := findMessageForUser(messageID, userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Message not found"})
+	}
+
+	result := database.DB.Where("message_id = ? AND user_id = ? AND emoji = ?", msg.ID, userID, emoji).Delete(&models.MessageReaction{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to remove reaction"})
+	}
+	if result.RowsAffected == 0 {
+		return c.JSON(fiber.Map{"success": true, "data": reactionSummaries(msg.ID, userID)})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": publishReactions(chat, msg, userID, emoji, "removed")})
+}
+
+// publishReactions sends a reaction event with the message's updated totals
+// to every chat member and returns the totals as seen by userID.
+func publishReactions(chat models.Chat, msg models.Message, userID uuid.UUID, emoji, action string) []models.ReactionSummary {
+	summaries := reactionSummaries(msg.ID, userID)
+	// Reacted is per viewer, so the broadcast only carries the counts
+	totals := make([]fiber.Map, len(summaries))
+	for i, s := range summaries {
+		totals[i] = fiber.Map{"emoji": s.Emoji, "count": s.Count}
+	}
+	ws.Publish(chatMemberIDs(chat.ID), ws.TypeReaction, chat.ID, fiber.Map{
+		"message_id": msg.ID,
+		"user_id":    userID,
+		"emoji":      emoji,
+		"action":     action,
+		"reactions":  totals,
+	})
+	return summaries
+}
+
+func reactionSummaries(messageID, userID uuid.UUID) []models.ReactionSummary {
+	msg := models.Message{ID: messageID}
+	fillReactions([]*models.Message{&msg}, userID)
+	if msg.Reactions == nil {
+		return []models.ReactionSummary{}
+	}
+	return msg.Reactions
+}
+
+// fillReactions attaches aggregated reaction counts to each message, in the
+// order each emoji was first used.
+func fillReactions(messages []*models.Message, userID uuid.UUID) {
+	if len(messages) == 0 {
+		return
+	}
+	ids := make([]uuid.UUID, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	var rows []struct {
+		MessageID uuid.UUID
+		models.ReactionSummary
+	}
+	database.DB.Model(&models.MessageReaction{}).
+		Select("message_id, emoji, COUNT(*) AS count, BOOL_OR(user_id = ?) AS reacted", userID).
+		Where("message_id IN ?", ids).
+		Group("message_id, emoji").
+		Order("MIN(created_at) asc").
+		Scan(&rows)
+
+	byMessage := make(map[uuid.UUID][]models.ReactionSummary)
+	for _, row := range rows {
+		byMessage[row.MessageID] = append(byMessage[row.MessageID], row.ReactionSummary)
+	}
+	for _, msg := range messages {
+		msg.Reactions = byMessage[msg.ID]
+	}
+}
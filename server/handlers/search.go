@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"strings"
+	"tether-server/database"
+	"tether-server/policy"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Search result page sizes
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 50
+	// Longest query accepted, in characters
+	maxSearchQueryLength = 200
+)
+
+// Text search configuration used by the search indexes and queries. 'simple'
+// does no stemming, which keeps mixed-language content searchable. The
+// expressions below must match the ones in database.createIndexes for the
+// indexes to be used.
+const (
+	userSearchDocument    = "to_tsvector('simple', coalesce(users.display_name, '') || ' ' || coalesce(users.bio, ''))"
+	messageSearchDocument = "to_tsvector('simple', m.content)"
+	cardSearchDocument    = "to_tsvector('simple', coalesce(cards.title, '') || ' ' || coalesce(cards.description, ''))"
+	boardSearchDocument   = "to_tsvector('simple', coalesce(boards.name, '') || ' ' || coalesce(boards.description, ''))"
+	contactNameDocument   = "to_tsvector('simple', name)" // contacts and companies
+)
+
+// Snippets are built from HTML-escaped text, so the only markup in them is
+// the <mark> around matches and clients may render them as HTML.
+const headlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5, FragmentDelimiter=\" … \""
+
+func escapedHTML(column string) string {
+	return "replace(replace(replace(coalesce(" + column + ", ''), '&', '&amp;'), '<', '&lt;'), '>', '&gt;')"
+}
+
+func headline(column string) string {
+	return "ts_headline('simple', " + escapedHTML(column) + ", to_tsquery('simple', @query), '" + strings.ReplaceAll(headlineOptions, "'", "''") + "')"
+}
+
+// searchTerms splits a query into words of letters and digits.
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// prefixTSQuery turns user input into a to_tsquery expression that matches
+// every word, the last one as a prefix so results appear while typing. It
+// returns "" when the input has no searchable words. Only letters and digits
+// reach the expression, so it needs no further escaping.
+func prefixTSQuery(query string) string {
+	terms := searchTerms(strings.ToLower(query))
+	if len(terms) == 0 {
+		return ""
+	}
+	terms[len(terms)-1] += ":*"
+	return strings.Join(terms, " & ")
+}
+
+// escapeLike escapes LIKE wildcards in s.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// searchParams reads the common q/limit/offset parameters. Errors are
+// *fiber.Error values.
+func searchParams(c *fiber.Ctx) (query, tsquery string, limit, offset int, err error) {
+	query = strings.TrimSpace(c.Query("q", c.Query("query")))
+	if query == "" {
+		return "", "", 0, 0, fiber.NewError(fiber.StatusBadRequest, "Query parameter is required")
+	}
+	if len([]rune(query)) > maxSearchQueryLength {
+		return "", "", 0, 0, fiber.NewError(fiber.StatusBadRequest, "Query is too long")
+	}
+	limit = c.QueryInt("limit", defaultSearchPageSize)
+	if limit <= 0 {
+		limit = defaultSearchPageSize
+	}
+	if limit > maxSearchPageSize {
+		limit = maxSearchPageSize
+	}
+	offset = c.QueryInt("offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+	return query, prefixTSQuery(query), limit, offset, nil
+}
+
+// searchPage trims the extra row fetched to detect further pages.
+func searchPage(n, limit int) (int, bool) {
+	if n > limit {
+		return limit, true
+	}
+	return n, false
+}
+
+type userSearchResult struct {
+	ID          uuid.UUID  `json:"id"`
+	Username    string     `json:"username"`
+	DisplayName string     `json:"display_name"`
+	Bio         string     `json:"bio"`
+	AvatarURL   string     `json:"avatar_url"`
+	LastSeen    *time.Time `json:"last_seen"`
+	Rank        float64    `json:"rank"`
+	Snippet     string     `json:"snippet,omitempty"`
+}
+
+// GET /api/users/search?q=&limit=&offset=
+//
+// Ranks users by trigram similarity of their username and display name,
+// plus full-text relevance of display name and bio. The legacy query=
+// parameter is still accepted.
+func SearchUsers(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+	query, tsquery, limit, offset, err := searchParams(c)
+	if err != nil {
+		return err
+	}
+
+	args := map[string]interface{}{
+		"me":     userID,
+		"q":      strings.ToLower(query),
+		"prefix": escapeLike(strings.ToLower(query)) + "%",
+		"query":  tsquery,
+	}
+	// Queries of punctuation only can still match usernames by prefix
+	textMatch, textRank, snippet := "FALSE", "0", "''"
+	if tsquery != "" {
+		textMatch = userSearchDocument + " @@ to_tsquery('simple', @query)"
+		textRank = "ts_rank(" + userSearchDocument + ", to_tsquery('simple', @query))"
+		snippet = "CASE WHEN page.text_match THEN " + headline("page.bio") + " ELSE '' END"
+	}
+
+	results := []userSearchResult{}
+	if err := database.DB.Raw(`
+		SELECT page.*, `+snippet+` AS snippet
+		FROM (
+			SELECT users.id, users.username, users.display_name, users.bio, users.avatar_url, users.last_seen,
+				`+textMatch+` AS text_match,
+				GREATEST(similarity(lower(users.username), @q), similarity(lower(users.display_name), @q))
+					+ CASE WHEN lower(users.username) LIKE @prefix THEN 1 ELSE 0 END
+					+ `+textRank+` AS rank
+			FROM users
+			WHERE users.deleted_at IS NULL AND users.id <> @me
+				AND (lower(users.username) LIKE @prefix OR lower(users.username) % @q OR lower(users.display_name) % @q
+					OR lower(users.display_name) LIKE '%' || @prefix OR `+textMatch+`)
+			ORDER BY rank DESC, users.username
+			LIMIT @limit OFFSET @offset
+		) AS page
+		ORDER BY page.rank DESC, page.username`,
+		withPage(args, limit+1, offset)).Scan(&results).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to search users"})
+	}
+
+	n, hasMore := searchPage(len(results), limit)
+	return c.JSON(fiber.Map{"success": true, "data": results[:n], "has_more": hasMore})
+}
+
+type messageSearchResult struct {
+	ID        uuid.UUID `json:"id"`
+	ChatID    uuid.UUID `json:"chat_id"`
+	SenderID  uuid.UUID `json:"sender_id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	Rank      float64   `json:"rank"`
+	Snippet   string    `json:"snippet"`
+}
+
+// GET /api/search/messages?q=&chat_id=&limit=&offset=
+//
+// Searches plaintext messages in the caller's chats, optionally in one chat.
+// E2EE messages are never searched: the server cannot read them. Use
+// GET /api/chats/:chatId/messages?around=<id> to open a result in context.
+func SearchMessages(c *fiber.Ctx) error {
+	userIDStr := c.Locals("user_id").(string)
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	_, tsquery, limit, offset, err := searchParams(c)
+	if err != nil {
+		return err
+	}
+	results := []messageSearchResult{}
+	if tsquery == "" {
+		return c.JSON(fiber.Map{"success": true, "data": results, "has_more": false})
+	}
+
+	args := map[string]interface{}{"me": userID, "query": tsquery}
+	chatFilter := ""
+	if chatIDStr := c.Query("chat_id"); chatIDStr != "" {
+		chatID, err := uuid.Parse(chatIDStr)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid chat ID"})
+		}
+		if _, err := findChatForUser(chatID, userID); err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Access denied"})
+		}
+		chatFilter = "AND m.chat_id = @chat"
+		args["chat"] = chatID
+	}
+
+	// The WHERE clause mirrors the partial index on messages
+	if err := database.DB.Raw(`
+		SELECT page.*, `+headline("page.content")+` AS snippet
+		FROM (
+			SELECT m.id, m.chat_id, m.sender_id, m.content, m.created_at,
+				ts_rank(`+messageSearchDocument+`, to_tsquery('simple', @query)) AS rank
+			FROM messages m
+			JOIN chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id = @me
+			WHERE m.type = 'text' AND m.ciphertext = '' AND m.deleted_at IS NULL
+				AND `+messageSearchDocument+` @@ to_tsquery('simple', @query)
+				AND NOT EXISTS (SELECT 1 FROM message_hides h WHERE h.message_id = m.id AND h.user_id = @me)
+				`+chatFilter+`
+			ORDER BY rank DESC, m.created_at DESC, m.id DESC
+			LIMIT @limit OFFSET @offset
+		) AS page
+		ORDER BY page.rank DESC, page.created_at DESC, page.id DESC`,
+		withPage(args, limit+1, offset)).Scan(&results).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to search messages"})
+	}
+
+	n, hasMore := searchPage(len(results), limit)
+	return c.JSON(fiber.Map{"success": true, "data": results[:n], "has_more": hasMore})
+}
+
+type cardSearchResult struct {
+	ID        uuid.UUID `json:"id"`
+	Title     string    `json:"title"`
+	ColumnID  uuid.UUID `json:"column_id"`
+	BoardID   uuid.UUID `json:"board_id"`
+	BoardName string    `json:"board_name"`
+	Status    string    `json:"status"`
+	Priority  string    `json:"priority"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Rank      float64   `json:"rank"`
+	Snippet   string    `json:"snippet"`
+}
+
+// GET /api/search/cards?q=&board_id=&labels=&assignees=&limit=&offset=
+func SearchCards(c *fiber.Ctx) error {
+	userIDStr := c.Locals("user_id").(string)
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	_, tsquery, limit, offset, err := searchParams(c)
+	if err != nil {
+		return err
+	}
+	results := []cardSearchResult{}
+	if tsquery == "" {
+		return c.JSON(fiber.Map{"success": true, "data": results, "has_more": false})
+	}
+
+	args := map[string]interface{}{"viewer": userID, "query": tsquery}
+	cardFilters := ""
+	if boardIDStr := c.Query("board_id"); boardIDStr != "" {
+		boardID, err := uuid.Parse(boardIDStr)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid board ID"})
+		}
+		cardFilters = "AND boards.id = @board"
+		args["board"] = boardID
+	}
+	filter, err := parseCardFilter(c, userID)
+	if err != nil {
+		return err
+	}
+	if cond, filterArgs := filter.sql(); cond != "" {
+		cardFilters += " AND " + cond
+		for k, v := range filterArgs {
+			args[k] = v
+		}
+	}
+
+	if err := database.DB.Raw(`
+		SELECT page.*, `+headline("page.description")+` AS snippet
+		FROM (
+			SELECT cards.id, cards.title, cards.description, cards.column_id, boards.id AS board_id, boards.name AS board_name,
+				cards.status, cards.priority, cards.updated_at,
+				ts_rank(`+cardSearchDocument+`, to_tsquery('simple', @query)) AS rank
+			FROM cards
+			JOIN columns ON columns.id = cards.column_id
+			JOIN boards ON boards.id = columns.board_id
+			WHERE cards.deleted_at IS NULL AND columns.deleted_at IS NULL AND `+policy.ListedBoardsSQL+`
+				AND (`+cardSearchDocument+` @@ to_tsquery('simple', @query)
+					OR cards.contact_id IN (SELECT id FROM contacts WHERE `+contactNameDocument+` @@ to_tsquery('simple', @query))
+					OR cards.company_id IN (SELECT id FROM companies WHERE `+contactNameDocument+` @@ to_tsquery('simple', @query)))
+				`+cardFilters+`
+			ORDER BY rank DESC, cards.updated_at DESC, cards.id
+			LIMIT @limit OFFSET @offset
+		) AS page
+		ORDER BY page.rank DESC, page.updated_at DESC, page.id`,
+		withPage(args, limit+1, offset)).Scan(&results).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to search cards"})
+	}
+
+	n, hasMore := searchPage(len(results), limit)
+	return c.JSON(fiber.Map{"success": true, "data": results[:n], "has_more": hasMore})
+}
+
+type boardSearchResult struct {
+	ID          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	Type        string     `json:"type"`
+	WorkspaceID *uuid.UUID `json:"workspace_id"`
+	Color       string     `json:"color"`
+	Rank        float64    `json:"rank"`
+	Snippet     string     `json:"snippet"`
+}
+
+// GET /api/search/boards?q=&limit=&offset=
+func SearchBoards(c *fiber.Ctx) error {
+	userIDStr := c.Locals("user_id").(string)
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	_, tsquery, limit, offset, err := searchParams(c)
+	if err != nil {
+		return err
+	}
+	results := []boardSearchResult{}
+	if tsquery == "" {
+		return c.JSON(fiber.Map{"success": true, "data": results, "has_more": false})
+	}
+
+	args := map[string]interface{}{"viewer": userID, "query": tsquery}
+	if err := database.DB.Raw(`
+		SELECT page.*, `+headline("page.description")+` AS snippet
+		FROM (
+			SELECT boards.id, boards.name, boards.description, boards.type, boards.workspace_id, boards.color,
+				ts_rank(`+boardSearchDocument+`, to_tsquery('simple', @query)) AS rank
+			FROM boards
+			WHERE `+policy.ListedBoardsSQL+` AND `+boardSearchDocument+` @@ to_tsquery('simple', @query)
+			ORDER BY rank DESC, boards.name, boards.id
+			LIMIT @limit OFFSET @offset
+		) AS page
+		ORDER BY page.rank DESC, page.name, page.id`,
+		withPage(args, limit+1, offset)).Scan(&results).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to search boards"})
+	}
+
+	n, hasMore := searchPage(len(results), limit)
+	return c.JSON(fiber.Map{"success": true, "data": results[:n], "has_more": hasMore})
+}
+
+func withPage(args map[string]interface{}, limit, offset int) map[string]interface{} {
+	args["limit"] = limit
+	args["offset"] = offset
+	return args
+}
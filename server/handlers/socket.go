@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"tether-server/database"
+	"tether-server/models"
+	"tether-server/ws"
+
+	"github.com/google/uuid"
+)
+
+var errAccessDenied = errors.New("access denied")
+
+// RegisterSocketHandlers wires inbound WebSocket events to the chat and
+// board handlers.
+func RegisterSocketHandlers() {
+	ws.Handle(ws.TypeMessageNew, socketMessageNew)
+	ws.Handle(ws.TypeTyping, socketTyping)
+	ws.Handle(ws.TypeRead, socketRead)
+	ws.Handle(ws.TypeBoardSubscribe, socketBoardSubscribe)
+	ws.Handle(ws.TypeBoardUnsubscribe, socketBoardUnsubscribe)
+	ws.OnPresence(socketPresence)
+}
+
+// message.new — persist the message, ack the sender with the stored message
+// and fan it out to the other participants. The envelope id doubles as the
+// message client id, so a re-sent envelope is acked with the original message.
+func socketMessageNew(c *ws.Client, env *ws.Envelope) error {
+	chat, err := findChatForUser(*env.ChatID, c.UserID)
+	if err != nil {
+		return errAccessDenied
+	}
+
+	var input messageInput
+	if err := env.Decode(&input); err != nil {
+		return err
+	}
+	input.ClientID = env.ID
+
+	msg, created, err := createMessage(chat, c.UserID, input)
+	if err == errEmptyMessage || err == errInvalidReply || err == errInvalidAttachment {
+		return err
+	}
+	if err != nil {
+		return errors.New("failed to send message")
+	}
+
+	ack, err := ws.NewEnvelope(ws.TypeMessageAck, env.ID, chat.ID, msg)
+	if err != nil {
+		return err
+	}
+	c.Reply(ack)
+
+	if created {
+		ws.Publish(otherParticipants(chat.ID, c.UserID), ws.TypeMessageNew, chat.ID, msg)
+	}
+	return nil
+}
+
+// typing — relay a typing indicator to the other participants.
+func socketTyping(c *ws.Client, env *ws.Envelope) error {
+	chat, err := findChatForUser(*env.ChatID, c.UserID)
+	if err != nil {
+		return errAccessDenied
+	}
+
+	input := struct {
+		Typing bool `json:"typing"`
+	}{Typing: true}
+	if len(env.Payload) > 0 {
+		if err := env.Decode(&input); err != nil {
+			return err
+		}
+	}
+
+	ws.Publish(otherParticipants(chat.ID, c.UserID), ws.TypeTyping, chat.ID, map[string]interface{}{
+		"user_id": c.UserID,
+		"typing":  input.Typing,
+	})
+	return nil
+}
+
+// read — advance the user's read cursor; the other members get a read event.
+func socketRead(c *ws.Client, env *ws.Envelope) error {
+	chat, err := findChatForUser(*env.ChatID, c.UserID)
+	if err != nil {
+		return errAccessDenied
+	}
+
+	var input struct {
+		MessageID uuid.UUID `json:"message_id"`
+	}
+	if len(env.Payload) > 0 {
+		if err := env.Decode(&input); err != nil {
+			return err
+		}
+	}
+
+	if _, err := markChatRead(chat, c.UserID, input.MessageID); err != nil {
+		if err == errMessageNotFound {
+			return err
+		}
+		return errors.New("failed to mark chat as read")
+	}
+	return nil
+}
+
+// socketPresence announces a user going online or offline to everyone they
+// share a chat with, and records last_seen when the last socket closes.
+func socketPresence(userID uuid.UUID, online bool) {
+	now := time.Now()
+	if !online {
+		database.DB.Model(&models.User{}).Where("id = ?", userID).Update("last_seen", now)
+	}
+
+	// Everyone who shares at least one chat with the user
+	var contacts []uuid.UUID
+	if err := database.DB.Table("chat_members AS mine").
+		Joins("JOIN chat_members AS theirs ON theirs.chat_id = mine.chat_id").
+		Where("mine.user_id = ? AND theirs.user_id <> ?", userID, userID).
+		Distinct().Pluck("theirs.user_id", &contacts).Error; err != nil {
+		return
+	}
+
+	payload := map[string]interface{}{
+		"user_id": userID,
+		"online":  online,
+	}
+	if !online {
+		payload["last_seen"] = now
+	}
+	ws.Publish(contacts, ws.TypePresence, uuid.Nil, payload)
+}
@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"tether-server/database"
+	"tether-server/models"
+	"tether-server/utils"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// trelloBoard is the part of a Trello board export (Menu → Print, export
+// and share → Export as JSON) that is imported.
+type trelloBoard struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Desc  string `json:"desc"`
+	Prefs struct {
+		BackgroundColor string `json:"backgroundColor"`
+	} `json:"prefs"`
+	Labels     []trelloLabel     `json:"labels"`
+	Lists      []trelloList      `json:"lists"`
+	Cards      []trelloCard      `json:"cards"`
+	Checklists []trelloChecklist `json:"checklists"`
+	Members    []trelloMember    `json:"members"`
+}
+
+type trelloLabel struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+type trelloList struct {
+	ID     string  `json:"id"`
+	Name   string  `json:"name"`
+	Closed bool    `json:"closed"`
+	Pos    float64 `json:"pos"`
+}
+
+type trelloCard struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Desc      string     `json:"desc"`
+	Closed    bool       `json:"closed"`
+	Due       *time.Time `json:"due"`
+	IDList    string     `json:"idList"`
+	Pos       float64    `json:"pos"`
+	IDLabels  []string   `json:"idLabels"`
+	IDMembers []string   `json:"idMembers"`
+	Cover     struct {
+		Color string `json:"color"`
+	} `json:"cover"`
+}
+
+type trelloChecklist struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	IDCard     string            `json:"idCard"`
+	Pos        float64           `json:"pos"`
+	CheckItems []trelloCheckItem `json:"checkItems"`
+}
+
+type trelloCheckItem struct {
+	Name  string  `json:"name"`
+	State string  `json:"state"` // "complete" or "incomplete"
+	Pos   float64 `json:"pos"`
+}
+
+type trelloMember struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	FullName string `json:"fullName"`
+	Email    string `json:"email"` // only present for the member who exported the board
+}
+
+// Trello label and cover colors; "_dark" and "_light" shades map to the
+// base color
+var trelloColors = map[string]string{
+	"green":  "#61BD4F",
+	"yellow": "#F2D600",
+	"orange": "#FF9F1A",
+	"red":    "#EB5A46",
+	"purple": "#C377E0",
+	"blue":   "#0079BF",
+	"sky":    "#00C2E0",
+	"lime":   "#51E898",
+	"pink":   "#FF78CB",
+	"black":  "#344563",
+}
+
+func trelloColor(name string) string {
+	name = strings.TrimSuffix(strings.TrimSuffix(name, "_dark"), "_light")
+	return trelloColors[name]
+}
+
+// trelloSkipped counts what a Trello import leaves out.
+type trelloSkipped struct {
+	ArchivedLists int `json:"archived_lists"`
+	ArchivedCards int `json:"archived_cards"` // including cards of archived lists
+}
+
+// unmappedMember is a Trello member assigned to imported cards who has no
+// user here; their assignments are dropped.
+type unmappedMember struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	FullName string `json:"full_name"`
+	Cards    int    `json:"cards"`
+	Reason   string `json:"reason"`
+}
+
+// isTrelloExport tells a Trello board export from one of ours.
+func isTrelloExport(data []byte) bool {
+	var probe struct {
+		Format string          `json:"format"`
+		Lists  json.RawMessage `json:"lists"`
+	}
+	return json.Unmarshal(data, &probe) == nil && probe.Format == "" && probe.Lists != nil
+}
+
+// parseTrelloBoard converts a Trello board export. Open lists become
+// columns and open cards keep their Trello order; cards are assigned to
+// Trello member IDs, which assignTrelloMembers replaces with usernames.
+// Rows in import errors are positions of cards in the file.
+func parseTrelloBoard(data []byte) (boardExport, []trelloMember, trelloSkipped, error) {
+	export := boardExport{Format: boardExportFormat, Version: boardExportVersion}
+	var skipped trelloSkipped
+	var board trelloBoard
+	if err := json.Unmarshal(data, &board); err != nil {
+		return export, nil, skipped, fmt.Errorf("Invalid JSON: %v", err)
+	}
+	if board.Lists == nil {
+		return export, nil, skipped, fmt.Errorf("Not a Trello board export")
+	}
+
+	export.Board = exportBoard{Name: board.Name, Description: board.Desc}
+	if strings.HasPrefix(board.Prefs.BackgroundColor, "#") {
+		export.Board.Color = board.Prefs.BackgroundColor
+	}
+
+	// Trello labels may have no name; those are named after their color
+	labels := map[string]string{}
+	for _, l := range board.Labels {
+		name := strings.TrimSpace(l.Name)
+		if name == "" {
+			if l.Color == "" {
+				continue
+			}
+			name = strings.ToUpper(l.Color[:1]) + strings.ReplaceAll(l.Color[1:], "_", " ")
+		}
+		labels[l.ID] = name
+		export.Labels = append(export.Labels, exportLabel{Name: name, Color: trelloColor(l.Color)})
+	}
+
+	lists := append([]trelloList{}, board.Lists...)
+	sort.SliceStable(lists, func(i, j int) bool { return lists[i].Pos < lists[j].Pos })
+	columns := map[string]int{}
+	for _, l := range lists {
+		if l.Closed {
+			skipped.ArchivedLists++
+			continue
+		}
+		columns[l.ID] = len(export.Columns)
+		export.Columns = append(export.Columns, exportColumn{Name: l.Name, Cards: []exportCard{}})
+	}
+
+	checklists := map[string][]trelloChecklist{}
+	for _, cl := range board.Checklists {
+		checklists[cl.IDCard] = append(checklists[cl.IDCard], cl)
+	}
+
+	type placedCard struct {
+		pos  float64
+		card exportCard
+	}
+	placed := make([][]placedCard, len(export.Columns))
+	for i, tc := range board.Cards {
+		column, ok := columns[tc.IDList]
+		if tc.Closed || !ok {
+			skipped.ArchivedCards++
+			continue
+		}
+		card := exportCard{
+			Title:       tc.Name,
+			Description: tc.Desc,
+			Color:       trelloColor(tc.Cover.Color),
+			DueDate:     tc.Due,
+			Assignees:   tc.IDMembers,
+			row:         i + 1,
+		}
+		for _, id := range tc.IDLabels {
+			if name, ok := labels[id]; ok {
+				card.Labels = append(card.Labels, name)
+			}
+		}
+		card.Checklists = trelloChecklists(checklists[tc.ID])
+		placed[column] = append(placed[column], placedCard{pos: tc.Pos, card: card})
+	}
+	for i, cards := range placed {
+		sort.SliceStable(cards, func(a, b int) bool { return cards[a].pos < cards[b].pos })
+		for _, p := range cards {
+			export.Columns[i].Cards = append(export.Columns[i].Cards, p.card)
+		}
+	}
+	return export, board.Members, skipped, nil
+}
+
+func trelloChecklists(checklists []trelloChecklist) []exportChecklist {
+	sort.SliceStable(checklists, func(i, j int) bool { return checklists[i].Pos < checklists[j].Pos })
+	var result []exportChecklist
+	for _, cl := range checklists {
+		items := append([]trelloCheckItem{}, cl.CheckItems...)
+		sort.SliceStable(items, func(i, j int) bool { return items[i].Pos < items[j].Pos })
+		ec := exportChecklist{Title: cl.Name, Items: []exportChecklistItem{}}
+		for _, item := range items {
+			ec.Items = append(ec.Items, exportChecklistItem{Title: item.Name, Done: item.State == "complete"})
+		}
+		result = append(result, ec)
+	}
+	return result
+}
+
+// assignTrelloMembers replaces the Trello member IDs assigned to cards with
+// the usernames in matched and reports the members left out, with the
+// reasons matchTrelloMembers gave.
+func assignTrelloMembers(export *boardExport, members []trelloMember, matched, reasons map[string]string) []unmappedMember {
+	counts := map[string]int{}
+	for i := range export.Columns {
+		for j := range export.Columns[i].Cards {
+			card := &export.Columns[i].Cards[j]
+			var usernames []string
+			for _, id := range card.Assignees {
+				if username, ok := matched[id]; ok {
+					usernames = append(usernames, username)
+				} else {
+					counts[id]++
+				}
+			}
+			card.Assignees = usernames
+		}
+	}
+
+	var unmapped []unmappedMember
+	for _, m := range members {
+		if counts[m.ID] == 0 {
+			continue
+		}
+		reason := reasons[m.ID]
+		if reason == "" {
+			reason = "No matching user"
+		}
+		unmapped = append(unmapped, unmappedMember{ID: m.ID, Username: m.Username, FullName: m.FullName, Cards: counts[m.ID], Reason: reason})
+		delete(counts, m.ID)
+	}
+	// Cards may name members missing from the export's member list
+	var unknown []string
+	for id := range counts {
+		unknown = append(unknown, id)
+	}
+	sort.Strings(unknown)
+	for _, id := range unknown {
+		unmapped = append(unmapped, unmappedMember{ID: id, Cards: counts[id], Reason: "Not listed in the export"})
+	}
+	return unmapped
+}
+
+// userDirectory looks up the users Trello members are matched with.
+type userDirectory interface {
+	// findUsers returns the users with any of the usernames or (normalized)
+	// emails.
+	findUsers(usernames, emails []string) ([]models.User, error)
+	// canAssign reports whether the user may be assigned on the new board.
+	canAssign(userID uuid.UUID) bool
+}
+
+// boardUsers is the userDirectory of a board being imported.
+type boardUsers struct {
+	board models.Board
+}
+
+func (d boardUsers) findUsers(usernames, emails []string) ([]models.User, error) {
+	var users []models.User
+	err := database.DB.Select("id, username, email").
+		Where("username IN ? OR lower(email) IN ?", append(usernames, ""), append(emails, "")).
+		Find(&users).Error
+	return users, err
+}
+
+func (d boardUsers) canAssign(userID uuid.UUID) bool {
+	return checkAssignees(d.board, []uuid.UUID{userID}) == nil
+}
+
+// matchTrelloMembers finds users for Trello members: by the username or
+// email given for the member's ID or username in overrides (an empty value
+// leaves the member out), otherwise by the member's username or email.
+// Users who could not be assigned on the board are not matched.
+func matchTrelloMembers(members []trelloMember, overrides map[string]string, users userDirectory) (map[string]string, map[string]string, error) {
+	matched := map[string]string{}
+	reasons := map[string]string{}
+
+	keys := map[string][]string{}
+	var usernames, emails []string
+	for _, m := range members {
+		override, ok := overrides[m.ID]
+		if !ok {
+			override, ok = overrides[m.Username]
+		}
+		switch {
+		case ok && strings.TrimSpace(override) == "":
+			reasons[m.ID] = "Skipped"
+			continue
+		case ok:
+			keys[m.ID] = []string{strings.TrimSpace(override)}
+		default:
+			keys[m.ID] = []string{m.Username}
+			if m.Email != "" {
+				keys[m.ID] = append(keys[m.ID], m.Email)
+			}
+		}
+		for _, key := range keys[m.ID] {
+			if strings.Contains(key, "@") {
+				emails = append(emails, utils.NormalizeEmail(key))
+			} else {
+				usernames = append(usernames, key)
+			}
+		}
+	}
+	if len(usernames) == 0 && len(emails) == 0 {
+		return matched, reasons, nil
+	}
+
+	found, err := users.findUsers(usernames, emails)
+	if err != nil {
+		return nil, nil, err
+	}
+	byKey := map[string]models.User{}
+	for _, u := range found {
+		byKey[u.Username] = u
+		byKey[utils.NormalizeEmail(u.Email)] = u
+	}
+
+	allowed := map[uuid.UUID]bool{}
+	for _, m := range members {
+		for _, key := range keys[m.ID] {
+			if strings.Contains(key, "@") {
+				key = utils.NormalizeEmail(key)
+			}
+			u, ok := byKey[key]
+			if !ok {
+				continue
+			}
+			ok, checked := allowed[u.ID]
+			if !checked {
+				ok = users.canAssign(u.ID)
+				allowed[u.ID] = ok
+			}
+			if ok {
+				matched[m.ID] = u.Username
+				delete(reasons, m.ID)
+				break
+			}
+			reasons[m.ID] = u.Username + " has no access to the board"
+		}
+	}
+	return matched, reasons, nil
+}
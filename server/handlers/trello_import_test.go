@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"tether-server/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func loadTrelloFixture(t *testing.T, name string) (boardExport, []trelloMember, trelloSkipped) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isTrelloExport(data) {
+		t.Fatalf("%s not detected as a Trello export", name)
+	}
+	export, members, skipped, err := parseTrelloBoard(data)
+	if err != nil {
+		t.Fatalf("parseTrelloBoard(%s): %v", name, err)
+	}
+	return export, members, skipped
+}
+
+func cardTitles(column exportColumn) []string {
+	titles := []string{}
+	for _, card := range column.Cards {
+		titles = append(titles, card.Title)
+	}
+	return titles
+}
+
+func TestParseTrelloBoardOrder(t *testing.T) {
+	export, _, skipped := loadTrelloFixture(t, "trello_board.json")
+
+	if export.Board.Name != "Product roadmap" || export.Board.Description != "Quarterly planning" || export.Board.Color != "#0079BF" {
+		t.Errorf("board = %+v", export.Board)
+	}
+	want := []struct {
+		column string
+		cards  []string
+	}{
+		{"To Do", []string{"Onboarding emails", "Fix login redirect"}},
+		{"Doing", []string{"Search v2"}},
+		{"Done", []string{}},
+	}
+	if len(export.Columns) != len(want) {
+		t.Fatalf("got %d columns, want %d", len(export.Columns), len(want))
+	}
+	for i, w := range want {
+		column := export.Columns[i]
+		if column.Name != w.column {
+			t.Errorf("column %d = %q, want %q", i, column.Name, w.column)
+		}
+		if got := cardTitles(column); !reflect.DeepEqual(got, w.cards) {
+			t.Errorf("cards of %q = %q, want %q", w.column, got, w.cards)
+		}
+	}
+
+	if want := (trelloSkipped{ArchivedLists: 1, ArchivedCards: 2}); skipped != want {
+		t.Errorf("skipped = %+v, want %+v", skipped, want)
+	}
+}
+
+func TestParseTrelloBoardCards(t *testing.T) {
+	export, _, _ := loadTrelloFixture(t, "trello_board.json")
+
+	wantLabels := []exportLabel{{Name: "Green dark", Color: "#61BD4F"}, {Name: "Bug", Color: "#EB5A46"}}
+	if !reflect.DeepEqual(export.Labels, wantLabels) {
+		t.Errorf("labels = %+v, want %+v", export.Labels, wantLabels)
+	}
+
+	login := export.Columns[0].Cards[1]
+	due := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"row", login.row, 1},
+		{"description", login.Description, "Users land on a blank page"},
+		{"color", login.Color, "#00C2E0"},
+		{"due date", login.DueDate != nil && login.DueDate.Equal(due), true},
+		{"labels", login.Labels, []string{"Bug", "Green dark"}},
+		{"checklists", login.Checklists, []exportChecklist{
+			{Title: "Release", Items: []exportChecklistItem{{Title: "Release notes", Done: true}}},
+			{Title: "QA", Items: []exportChecklistItem{{Title: "Chrome", Done: true}, {Title: "Safari", Done: false}}},
+		}},
+		{"no due date", export.Columns[0].Cards[0].DueDate == nil, true},
+		{"no cover", export.Columns[0].Cards[0].Color, ""},
+		{"no checklists", export.Columns[0].Cards[0].Checklists, []exportChecklist(nil)},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s = %#v, want %#v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestParseTrelloBoardRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"invalid JSON", `{"lists": [`, "Invalid JSON"},
+		{"no lists", `{"name": "Board"}`, "Not a Trello board export"},
+	}
+	for _, tt := range tests {
+		_, _, _, err := parseTrelloBoard([]byte(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+	if isTrelloExport([]byte(`{"format": "tether.board", "version": 1, "columns": []}`)) {
+		t.Error("board export detected as a Trello export")
+	}
+}
+
+// stubUsers is a userDirectory over a fixed set of users.
+type stubUsers struct {
+	users    []models.User
+	assignee map[string]bool // usernames that canAssign allows
+}
+
+func (d stubUsers) findUsers(usernames, emails []string) ([]models.User, error) {
+	var found []models.User
+	for _, u := range d.users {
+		for _, name := range usernames {
+			if u.Username == name {
+				found = append(found, u)
+			}
+		}
+		for _, email := range emails {
+			if strings.ToLower(u.Email) == email {
+				found = append(found, u)
+			}
+		}
+	}
+	return found, nil
+}
+
+func (d stubUsers) canAssign(userID uuid.UUID) bool {
+	for _, u := range d.users {
+		if u.ID == userID {
+			return d.assignee[u.Username]
+		}
+	}
+	return false
+}
+
+func TestTrelloMembers(t *testing.T) {
+	users := stubUsers{
+		users: []models.User{
+			{ID: uuid.New(), Username: "alice", Email: "alice@example.com"},
+			{ID: uuid.New(), Username: "carol", Email: "carol@example.com"},
+			{ID: uuid.New(), Username: "d.doe", Email: "dave@example.com"},
+			{ID: uuid.New(), Username: "robert", Email: "bob@example.com"},
+			{ID: uuid.New(), Username: "erin_local", Email: "erin@corp.com"},
+		},
+		assignee: map[string]bool{"alice": true, "d.doe": true, "robert": true, "erin_local": true},
+	}
+	notListed := unmappedMember{ID: "mem-gone", Cards: 2, Reason: "Not listed in the export"}
+	carol := unmappedMember{ID: "mem-carol", Username: "carol", FullName: "Carol Chen", Cards: 2, Reason: "carol has no access to the board"}
+	bob := unmappedMember{ID: "mem-bob", Username: "bobby_t", FullName: "Bob Tables", Cards: 1, Reason: "No matching user"}
+	erin := unmappedMember{ID: "mem-erin", Username: "erin", FullName: "Erin Eve", Cards: 1, Reason: "No matching user"}
+
+	tests := []struct {
+		name      string
+		overrides map[string]string
+		assignees [][]string // by card
+		unmapped  []unmappedMember
+	}{
+		{
+			name:      "username and email",
+			assignees: [][]string{{"alice"}, {"alice", "d.doe"}, nil},
+			unmapped:  []unmappedMember{bob, carol, erin, notListed},
+		},
+		{
+			name:      "override by username",
+			overrides: map[string]string{"bobby_t": "robert"},
+			assignees: [][]string{{"alice", "robert"}, {"alice", "d.doe"}, nil},
+			unmapped:  []unmappedMember{carol, erin, notListed},
+		},
+		{
+			name:      "override by ID with email",
+			overrides: map[string]string{"mem-erin": " Erin@Corp.com "},
+			assignees: [][]string{{"alice"}, {"alice", "d.doe", "erin_local"}, nil},
+			unmapped:  []unmappedMember{bob, carol, notListed},
+		},
+		{
+			name:      "empty override skips",
+			overrides: map[string]string{"mem-alice": "", "dave": ""},
+			assignees: [][]string{nil, nil, nil},
+			unmapped: []unmappedMember{
+				{ID: "mem-alice", Username: "alice", FullName: "Alice Archer", Cards: 2, Reason: "Skipped"},
+				bob, carol,
+				{ID: "mem-dave", Username: "dave", FullName: "Dave Doe", Cards: 1, Reason: "Skipped"},
+				erin, notListed,
+			},
+		},
+		{
+			name:      "override without user",
+			overrides: map[string]string{"alice": "nobody"},
+			assignees: [][]string{nil, {"d.doe"}, nil},
+			unmapped: []unmappedMember{
+				{ID: "mem-alice", Username: "alice", FullName: "Alice Archer", Cards: 2, Reason: "No matching user"},
+				bob, carol, erin, notListed,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			export, members, _ := loadTrelloFixture(t, "trello_members.json")
+			matched, reasons, err := matchTrelloMembers(members, tt.overrides, users)
+			if err != nil {
+				t.Fatal(err)
+			}
+			unmapped := assignTrelloMembers(&export, members, matched, reasons)
+
+			var assignees [][]string
+			for _, card := range export.Columns[0].Cards {
+				assignees = append(assignees, card.Assignees)
+			}
+			if !reflect.DeepEqual(assignees, tt.assignees) {
+				t.Errorf("assignees = %q, want %q", assignees, tt.assignees)
+			}
+			if !reflect.DeepEqual(unmapped, tt.unmapped) {
+				t.Errorf("unmapped = %+v\nwant %+v", unmapped, tt.unmapped)
+			}
+		})
+	}
+}
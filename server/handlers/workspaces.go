@@ -0,0 +1,416 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"tether-server/database"
+	"tether-server/models"
+	"tether-server/policy"
+	"tether-server/utils"
+	"tether-server/ws"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// workspaceRoleRank orders workspace roles so that a member may only manage
+// members ranked strictly below them.
+var workspaceRoleRank = map[string]int{"member": 1, "admin": 2, "owner": 3}
+
+// loadWorkspaceMembership resolves the workspace id from the route and
+// returns the workspace with the caller's membership in it. Errors are
+// *fiber.Error values rendered by the app's error handler.
+func loadWorkspaceMembership(c *fiber.Ctx) (models.Workspace, models.WorkspaceMember, error) {
+	var workspace models.Workspace
+	var member models.WorkspaceMember
+
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return workspace, member, fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+	}
+	workspaceID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return workspace, member, fiber.NewError(fiber.StatusBadRequest, "Invalid workspace ID")
+	}
+	if err := database.DB.First(&workspace, "id = ?", workspaceID).Error; err != nil {
+		return workspace, member, fiber.NewError(fiber.StatusNotFound, "Workspace not found")
+	}
+	if err := database.DB.Where("workspace_id = ? AND user_id = ?", workspaceID, userID).First(&member).Error; err != nil {
+		return workspace, member, fiber.NewError(fiber.StatusForbidden, "Access denied")
+	}
+	workspace.Role = member.Role
+	return workspace, member, nil
+}
+
+// GET /api/workspaces
+func GetWorkspaces(c *fiber.Ctx) error {
+	userIDStr := c.Locals("user_id").(string)
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	var workspaces []models.Workspace
+	if err := database.DB.Joins("JOIN workspace_members ON workspace_members.workspace_id = workspaces.id").
+		Where("workspace_members.user_id = ?", userID).
+		Preload("Owner").
+		Order("workspaces.name asc").
+		Find(&workspaces).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to get workspaces"})
+	}
+	var memberships []models.WorkspaceMember
+	database.DB.Where("user_id = ?", userID).Find(&memberships)
+	roles := make(map[uuid.UUID]string, len(memberships))
+	for _, m := range memberships {
+		roles[m.WorkspaceID] = m.Role
+	}
+	for i := range workspaces {
+		workspaces[i].Role = roles[workspaces[i].ID]
+	}
+	return c.JSON(fiber.Map{"success": true, "data": workspaces})
+}
+
+// POST /api/workspaces
+func CreateWorkspace(c *fiber.Ctx) error {
+	userIDStr := c.Locals("user_id").(string)
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	var input struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Type        string `json:"type"`
+		Slug        string `json:"slug"` // optional; generated from the name when empty
+		IsPublic    bool   `json:"is_public"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Workspace name is required"})
+	}
+	if input.Type == "" {
+		input.Type = "team"
+	}
+	if input.Type != "team" && input.Type != "organization" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid workspace type"})
+	}
+	if input.Slug != "" && !utils.IsValidSlug(input.Slug) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Slug may only contain lowercase letters, digits and hyphens"})
+	}
+
+	now := time.Now()
+	workspace := models.Workspace{
+		ID:          uuid.New(),
+		Name:        input.Name,
+		Description: input.Description,
+		Type:        input.Type,
+		OwnerID:     userID,
+		IsPublic:    input.IsPublic,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Role:        "owner",
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if input.Slug != "" {
+			if slugTaken(tx, input.Slug, uuid.Nil) {
+				return errSlugTaken
+			}
+			workspace.Slug = input.Slug
+		} else {
+			workspace.Slug = uniqueWorkspaceSlug(tx, input.Name)
+		}
+		if err := tx.Create(&workspace).Error; err != nil {
+			return err
+		}
+		owner := models.WorkspaceMember{ID: uuid.New(), WorkspaceID: workspace.ID, UserID: userID, Role: "owner", JoinedAt: now}
+		return tx.Create(&owner).Error
+	})
+	if err == errSlugTaken {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"success": false, "error": "Slug is already taken"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to create workspace"})
+	}
+	database.DB.Preload("Owner").First(&workspace, "id = ?", workspace.ID)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "data": workspace})
+}
+
+// GET /api/workspaces/:id
+func GetWorkspace(c *fiber.Ctx) error {
+	workspace, me, err := loadWorkspaceMembership(c)
+	if err != nil {
+		return err
+	}
+	role := workspace.Role
+	// Only the boards the caller would see in their board list
+	listed := func(db *gorm.DB) *gorm.DB { return policy.ListedBoards(db, me.UserID) }
+	if err := database.DB.Preload("Owner").Preload("Boards", listed).First(&workspace, "id = ?", workspace.ID).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to get workspace"})
+	}
+	workspace.Role = role
+	return c.JSON(fiber.Map{"success": true, "data": workspace})
+}
+
+// PUT /api/workspaces/:id
+func UpdateWorkspace(c *fiber.Ctx) error {
+	workspace, me, err := loadWorkspaceMembership(c)
+	if err != nil {
+		return err
+	}
+	if workspaceRoleRank[me.Role] < workspaceRoleRank["admin"] {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Only workspace admins can update the workspace"})
+	}
+	var input struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		Type        *string `json:"type"`
+		Slug        *string `json:"slug"`
+		IsPublic    *bool   `json:"is_public"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+	updates := map[string]interface{}{"updated_at": time.Now()}
+	if input.Name != nil {
+		if strings.TrimSpace(*input.Name) == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Workspace name is required"})
+		}
+		updates["name"] = strings.TrimSpace(*input.Name)
+	}
+	if input.Description != nil {
+		updates["description"] = *input.Description
+	}
+	if input.Type != nil {
+		if *input.Type != "team" && *input.Type != "organization" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid workspace type"})
+		}
+		updates["type"] = *input.Type
+	}
+	if input.Slug != nil && *input.Slug != workspace.Slug {
+		if !utils.IsValidSlug(*input.Slug) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Slug may only contain lowercase letters, digits and hyphens"})
+		}
+		if slugTaken(database.DB, *input.Slug, workspace.ID) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"success": false, "error": "Slug is already taken"})
+		}
+		updates["slug"] = *input.Slug
+	}
+	if input.IsPublic != nil {
+		updates["is_public"] = *input.IsPublic
+	}
+	if err := database.DB.Model(&workspace).Updates(updates).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to update workspace"})
+	}
+	database.DB.Preload("Owner").First(&workspace, "id = ?", workspace.ID)
+	workspace.Role = me.Role
+	return c.JSON(fiber.Map{"success": true, "data": workspace})
+}
+
+// DELETE /api/workspaces/:id
+//
+// Deletes the workspace together with its boards. Only the owner may do this.
+func DeleteWorkspace(c *fiber.Ctx) error {
+	workspace, me, err := loadWorkspaceMembership(c)
+	if err != nil {
+		return err
+	}
+	if me.Role != "owner" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Only the workspace owner can delete it"})
+	}
+	var boardIDs []uuid.UUID
+	database.DB.Model(&models.Board{}).Where("workspace_id = ?", workspace.ID).Pluck("id", &boardIDs)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("workspace_id = ?", workspace.ID).Delete(&models.Board{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("workspace_id = ?", workspace.ID).Delete(&models.WorkspaceMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&workspace).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to delete workspace"})
+	}
+	for _, boardID := range boardIDs {
+		ws.CloseBoard(boardID, ws.TypeBoardDeleted, fiber.Map{"board_id": boardID})
+	}
+	return c.JSON(fiber.Map{"success": true, "message": "Workspace deleted successfully"})
+}
+
+// GET /api/workspaces/:id/members
+func GetWorkspaceMembers(c *fiber.Ctx) error {
+	workspace, _, err := loadWorkspaceMembership(c)
+	if err != nil {
+		return err
+	}
+	var members []models.WorkspaceMember
+	if err := database.DB.Where("workspace_id = ?", workspace.ID).
+		Preload("User").
+		Order("CASE role WHEN 'owner' THEN 0 WHEN 'admin' THEN 1 ELSE 2 END").Order("joined_at asc").
+		Find(&members).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to get members"})
+	}
+	return c.JSON(fiber.Map{"success": true, "data": members})
+}
+
+// PUT /api/workspaces/:id/members/:userId/role
+//
+// Switches a member between admin and member. Ownership moves only through
+// POST /api/workspaces/:id/transfer.
+func UpdateWorkspaceMemberRole(c *fiber.Ctx) error {
+	workspace, me, err := loadWorkspaceMembership(c)
+	if err != nil {
+		return err
+	}
+	if me.Role != "owner" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Only the workspace owner can change roles"})
+	}
+	targetID, err := uuid.Parse(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := c.BodyParser(&input); err != nil || (input.Role != "admin" && input.Role != "member") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Role must be 'admin' or 'member'"})
+	}
+	var target models.WorkspaceMember
+	if err := database.DB.Where("workspace_id = ? AND user_id = ?", workspace.ID, targetID).First(&target).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Member not found"})
+	}
+	if target.Role == "owner" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Transfer ownership to change the owner's role"})
+	}
+	if target.Role != input.Role {
+		if err := database.DB.Model(&target).Updates(map[string]interface{}{"role": input.Role, "updated_at": time.Now()}).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to update role"})
+		}
+	}
+	resetWorkspaceBoardSubscriptions(workspace.ID)
+	return c.JSON(fiber.Map{"success": true, "data": target})
+}
+
+// DELETE /api/workspaces/:id/members/:userId
+func RemoveWorkspaceMember(c *fiber.Ctx) error {
+	workspace, me, err := loadWorkspaceMembership(c)
+	if err != nil {
+		return err
+	}
+	targetID, err := uuid.Parse(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid user ID"})
+	}
+	if targetID == me.UserID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Use leave to remove yourself"})
+	}
+	var target models.WorkspaceMember
+	if err := database.DB.Where("workspace_id = ? AND user_id = ?", workspace.ID, targetID).First(&target).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Member not found"})
+	}
+	if workspaceRoleRank[me.Role] < workspaceRoleRank["admin"] || workspaceRoleRank[me.Role] <= workspaceRoleRank[target.Role] {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Access denied"})
+	}
+	if err := database.DB.Unscoped().Delete(&target).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to remove member"})
+	}
+	resetWorkspaceBoardSubscriptions(workspace.ID)
+	return c.JSON(fiber.Map{"success": true, "message": "Member removed successfully"})
+}
+
+// POST /api/workspaces/:id/leave
+func LeaveWorkspace(c *fiber.Ctx) error {
+	_, me, err := loadWorkspaceMembership(c)
+	if err != nil {
+		return err
+	}
+	// Workspaces own boards, so they are never left without an owner
+	if me.Role == "owner" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Transfer ownership or delete the workspace before leaving"})
+	}
+	if err := database.DB.Unscoped().Delete(&me).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to leave workspace"})
+	}
+	resetWorkspaceBoardSubscriptions(me.WorkspaceID)
+	return c.JSON(fiber.Map{"success": true, "message": "Left workspace successfully"})
+}
+
+// POST /api/workspaces/:id/transfer
+//
+// Makes another member the owner; the previous owner becomes an admin.
+func TransferWorkspaceOwnership(c *fiber.Ctx) error {
+	workspace, me, err := loadWorkspaceMembership(c)
+	if err != nil {
+		return err
+	}
+	if me.Role != "owner" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Only the workspace owner can transfer ownership"})
+	}
+	var input struct {
+		UserID uuid.UUID `json:"user_id"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.UserID == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
+	}
+	if input.UserID == me.UserID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "You already own this workspace"})
+	}
+	var target models.WorkspaceMember
+	if err := database.DB.Where("workspace_id = ? AND user_id = ?", workspace.ID, input.UserID).First(&target).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Member not found"})
+	}
+
+	now := time.Now()
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&me).Updates(map[string]interface{}{"role": "admin", "updated_at": now}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&target).Updates(map[string]interface{}{"role": "owner", "updated_at": now}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&workspace).Updates(map[string]interface{}{"owner_id": target.UserID, "updated_at": now}).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Failed to transfer ownership"})
+	}
+	database.DB.Preload("Owner").First(&workspace, "id = ?", workspace.ID)
+	workspace.Role = "admin"
+	return c.JSON(fiber.Map{"success": true, "data": workspace})
+}
+
+var errSlugTaken = errors.New("slug is already taken")
+
+// slugTaken reports whether another workspace, including deleted ones whose
+// rows still hold the unique slug, uses slug.
+func slugTaken(db *gorm.DB, slug string, except uuid.UUID) bool {
+	var count int64
+	db.Unscoped().Model(&models.Workspace{}).Where("slug = ? AND id <> ?", slug, except).Count(&count)
+	return count > 0
+}
+
+// uniqueWorkspaceSlug derives a free slug from name, appending -2, -3, ...
+// when the plain slug is taken.
+func uniqueWorkspaceSlug(db *gorm.DB, name string) string {
+	base := utils.Slugify(name)
+	if base == "" {
+		base = "workspace"
+	}
+	var taken []string
+	db.Unscoped().Model(&models.Workspace{}).
+		Where("slug = ? OR slug LIKE ?", base, escapeLike(base)+"-%").
+		Pluck("slug", &taken)
+	used := make(map[string]bool, len(taken))
+	for _, s := range taken {
+		used[s] = true
+	}
+	slug := base
+	for n := 2; used[slug]; n++ {
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+	return slug
+}
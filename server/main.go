@@ -4,7 +4,9 @@ import (
 	"log"
 	"tether-server/config"
 	"tether-server/database"
+	"tether-server/handlers"
 	"tether-server/routes"
+	"tether-server/storage"
 	"tether-server/ws"
 
 	"github.com/gofiber/fiber/v2"
@@ -19,8 +21,13 @@ func main() {
 	// Подключаемся к базе данных
 	database.ConnectDB()
 
+	// Хранилище вложений
+	storage.Init()
+
 	// Создаем Fiber приложение
 	app := fiber.New(fiber.Config{
+		// Room for the largest attachment plus multipart overhead
+		BodyLimit: int(config.AppConfig.MaxUploadSize) + 1<<20,
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			code := fiber.StatusInternalServerError
 			if e, ok := err.(*fiber.Error); ok {
@@ -36,15 +43,20 @@ func main() {
 	// Middleware
 	app.Use(logger.New())
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "http://localhost:3000",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
-		AllowMethods: "GET, POST, PUT, DELETE",
+		AllowOrigins:  "http://localhost:3000",
+		AllowHeaders:  "Origin, Content-Type, Accept, Authorization, If-Match",
+		AllowMethods:  "GET, POST, PUT, DELETE",
+		ExposeHeaders: "ETag",
 	}))
 
+	// Аватары, загруженные через /api/profile/avatar
+	app.Static("/uploads", "./uploads")
+
 	// Настраиваем маршруты
 	routes.SetupRoutes(app)
 
-	// WebSocket маршрут
+	// WebSocket маршрут и обработчики входящих событий
+	handlers.RegisterSocketHandlers()
 	app.Get("/ws", ws.WebSocketHandler())
 
 	// Запускаем WebSocket hub в горутине
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Activity is one entry of a board's audit trail: who did what to the board,
+// one of its columns or one of its cards.
+type Activity struct {
+	ID        uuid.UUID    `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	BoardID   uuid.UUID    `json:"board_id" gorm:"type:uuid;not null;index:idx_activities_board_created,priority:1"`
+	CardID    *uuid.UUID   `json:"card_id,omitempty" gorm:"type:uuid;index:idx_activities_card_created,priority:1"` // set for card entries
+	ActorID   uuid.UUID    `json:"actor_id" gorm:"type:uuid;not null"`
+	Entity    string       `json:"entity" gorm:"not null"` // 'board', 'column', 'card'
+	EntityID  uuid.UUID    `json:"entity_id" gorm:"type:uuid;not null"`
+	Action    string       `json:"action" gorm:"not null"` // 'created', 'updated', 'moved', 'deleted'
+	Changes   FieldChanges `json:"changes,omitempty" gorm:"type:jsonb"`
+	CreatedAt time.Time    `json:"created_at" gorm:"index:idx_activities_board_created,priority:2;index:idx_activities_card_created,priority:2"`
+
+	// Relations
+	Actor User `json:"actor" gorm:"foreignKey:ActorID"`
+}
+
+// FieldChange is the value of one field before and after a change.
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// FieldChanges maps field names (as in the entity's JSON) to their change.
+// It is stored as jsonb.
+type FieldChanges map[string]FieldChange
+
+func (f FieldChanges) Value() (driver.Value, error) {
+	if f == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(f)
+	return string(b), err
+}
+
+func (f *FieldChanges) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*f = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, f)
+	case string:
+		return json.Unmarshal([]byte(v), f)
+	}
+	return errors.New("unsupported type for FieldChanges")
+}
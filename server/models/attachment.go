@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Attachment is a file uploaded to a chat. It is created on upload and later
+// linked to the message that carries it.
+type Attachment struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	ChatID     uuid.UUID  `json:"chat_id" gorm:"type:uuid;not null;index"`
+	UploaderID uuid.UUID  `json:"uploader_id" gorm:"type:uuid;not null"`
+	MessageID  *uuid.UUID `json:"message_id,omitempty" gorm:"type:uuid;index"`
+	FileName   string     `json:"file_name" gorm:"not null"`
+	// Sniffed from the file contents, never taken from the client. Encrypted
+	// attachments are always application/octet-stream.
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	// Image dimensions, zero for other files
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// E2EE attachments are stored as an opaque blob; KeyMetadata carries the
+	// client's wrapped key, nonce, original MIME type etc. and is not
+	// interpreted by the server.
+	Encrypted   bool   `json:"encrypted" gorm:"not null;default:false"`
+	KeyMetadata string `json:"key_metadata,omitempty" gorm:"type:text"`
+	// 'uploading' while chunks are being received, 'ready' once complete
+	Status string `json:"status" gorm:"not null;default:'ready'"`
+	// Bytes received so far for chunked uploads
+	UploadedSize int64 `json:"uploaded_size"`
+	ChunkCount   int   `json:"-"`
+
+	StorageKey   string    `json:"-" gorm:"not null"`
+	ThumbnailKey string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	// Signed download URLs; filled in by the handlers, not stored
+	URL          string `json:"url,omitempty" gorm:"-"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty" gorm:"-"`
+}
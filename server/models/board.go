@@ -8,20 +8,49 @@ import (
 )
 
 type Board struct {
-	ID          uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
-	Name        string         `json:"name" gorm:"not null"`
-	Description string         `json:"description" gorm:"type:text"`
-	Type        string         `json:"type" gorm:"not null;default:'personal'"` // 'personal', 'team', 'crm'
-	OwnerID     uuid.UUID      `json:"owner_id" gorm:"type:uuid;not null"`
-	WorkspaceID *uuid.UUID     `json:"workspace_id" gorm:"type:uuid"` // null for personal boards
-	IsPublic    bool           `json:"is_public" gorm:"default:false"`
-	Color       string         `json:"color" gorm:"default:'#3B82F6'"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	Name        string     `json:"name" gorm:"not null"`
+	Description string     `json:"description" gorm:"type:text"`
+	Type        string     `json:"type" gorm:"not null;default:'personal'"` // 'personal', 'team', 'crm'
+	OwnerID     uuid.UUID  `json:"owner_id" gorm:"type:uuid;not null"`
+	WorkspaceID *uuid.UUID `json:"workspace_id" gorm:"type:uuid"` // null for personal boards
+	IsPublic    bool       `json:"is_public" gorm:"default:false"`
+	// What everyone may do on a public board: 'view' (default), 'comment' or 'edit'
+	PublicPermission string `json:"public_permission" gorm:"not null;default:'view'"`
+	Color            string `json:"color" gorm:"default:'#3B82F6'"`
+	// Bumped by every change to the board, its columns and cards; see ws.PublishBoard
+	Revision  int64          `json:"revision" gorm:"not null;default:0"`
+	Version   int64          `json:"version" gorm:"not null;default:1"` // bumped by writes to the board itself; the ETag
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// The requesting user's effective permission; filled in by the handlers, not stored
+	Permission string `json:"permission,omitempty" gorm:"-"`
 
 	// Relations
 	Owner     User      `json:"owner" gorm:"foreignKey:OwnerID"`
 	Workspace Workspace `json:"workspace,omitempty" gorm:"foreignKey:WorkspaceID"`
 	Columns   []Column  `json:"columns,omitempty" gorm:"foreignKey:BoardID;constraint:OnDelete:CASCADE"`
+	// Custom field definitions; included with the board's cards
+	CustomFields []CustomField `json:"custom_fields,omitempty" gorm:"foreignKey:BoardID"`
+}
+
+// BoardMember overrides the permission policy.ForBoard would give a user on
+// one board. For workspace members it raises or lowers their access (even to
+// 'none'); for anyone else it grants guest access.
+type BoardMember struct {
+	ID         uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	BoardID    uuid.UUID `json:"board_id" gorm:"type:uuid;not null;uniqueIndex:idx_board_member"`
+	UserID     uuid.UUID `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_board_member"`
+	Permission string    `json:"permission" gorm:"not null"` // 'none', 'view', 'comment', 'edit', 'admin'
+	AddedByID  uuid.UUID `json:"added_by_id" gorm:"type:uuid;not null"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	// Whether the user is outside the board's workspace; filled in by the handlers
+	Guest bool `json:"guest" gorm:"-"`
+
+	// Relations
+	User User `json:"user" gorm:"foreignKey:UserID"`
 }
@@ -11,10 +11,10 @@ type Card struct {
 	ID          uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
 	Title       string         `json:"title" gorm:"not null"`
 	Description string         `json:"description" gorm:"type:text"`
-	Position    int            `json:"position" gorm:"not null"`
+	Rank        string         `json:"rank" gorm:"type:text;not null;default:''"` // order within the column, see utils.RankBetween
+	Version     int64          `json:"version" gorm:"not null;default:1"`         // bumped by every write; the ETag
 	Color       string         `json:"color" gorm:"default:'#FFFFFF'"`
 	ColumnID    uuid.UUID      `json:"column_id" gorm:"type:uuid;not null"`
-	AssigneeID  *uuid.UUID     `json:"assignee_id" gorm:"type:uuid"`
 	CreatedByID uuid.UUID      `json:"created_by_id" gorm:"type:uuid;not null"`
 	DueDate     *time.Time     `json:"due_date"`
 	CreatedAt   time.Time      `json:"created_at"`
@@ -22,16 +22,25 @@ type Card struct {
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// CRM Fields
-	LeadName     string  `json:"lead_name" gorm:"type:varchar(255)"`
-	ContactEmail string  `json:"contact_email" gorm:"type:varchar(255)"`
-	ContactPhone string  `json:"contact_phone" gorm:"type:varchar(50)"`
-	Company      string  `json:"company" gorm:"type:varchar(255)"`
-	Value        float64 `json:"value" gorm:"type:decimal(15,2)"`
-	Priority     string  `json:"priority" gorm:"default:'medium'"` // 'low', 'medium', 'high', 'urgent'
-	Status       string  `json:"status" gorm:"default:'new'"`      // 'new', 'contacted', 'qualified', 'proposal', 'negotiation', 'closed-won', 'closed-lost'
+	ContactID *uuid.UUID `json:"contact_id" gorm:"type:uuid;index"` // contacts and companies of the board's workspace
+	CompanyID *uuid.UUID `json:"company_id" gorm:"type:uuid;index"`
+	Value     float64    `json:"value" gorm:"type:decimal(15,2)"`
+	Priority  string     `json:"priority" gorm:"default:'medium'"` // 'low', 'medium', 'high', 'urgent'
+	Status    string     `json:"status" gorm:"default:'new'"`      // 'new', 'contacted', 'qualified', 'proposal', 'negotiation', 'closed-won', 'closed-lost'
+
+	// Card summary for board views; filled in by the handlers
+	CommentCount   int64 `json:"comment_count" gorm:"-"`
+	ChecklistDone  int64 `json:"checklist_done" gorm:"-"`  // done items over all checklists
+	ChecklistTotal int64 `json:"checklist_total" gorm:"-"` // items over all checklists
 
 	// Relations
-	Column    Column `json:"column,omitempty" gorm:"foreignKey:ColumnID"`
-	Assignee  *User  `json:"assignee,omitempty" gorm:"foreignKey:AssigneeID"`
-	CreatedBy User   `json:"created_by" gorm:"foreignKey:CreatedByID"`
+	Column     Column      `json:"column,omitempty" gorm:"foreignKey:ColumnID"`
+	Contact    *Contact    `json:"contact,omitempty" gorm:"foreignKey:ContactID"`
+	Company    *Company    `json:"company,omitempty" gorm:"foreignKey:CompanyID"`
+	Assignees  []User      `json:"assignees" gorm:"many2many:card_assignees"`
+	Labels     []Label     `json:"labels" gorm:"many2many:card_labels"`
+	CreatedBy  User        `json:"created_by" gorm:"foreignKey:CreatedByID"`
+	Checklists []Checklist `json:"checklists,omitempty" gorm:"foreignKey:CardID"`
+	// Values of the board's custom fields
+	FieldValues []CardFieldValue `json:"custom_fields" gorm:"foreignKey:CardID"`
 }
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CardStatusChange records a card entering a status, for time-in-stage
+// analytics on CRM boards. The first entry of a card has an empty
+// FromStatus.
+type CardStatusChange struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	CardID      uuid.UUID `json:"card_id" gorm:"type:uuid;not null;index:idx_card_status_changes_card_changed,priority:1"`
+	FromStatus  string    `json:"from_status" gorm:"not null;default:''"`
+	ToStatus    string    `json:"to_status" gorm:"not null"`
+	ChangedByID uuid.UUID `json:"changed_by_id" gorm:"type:uuid;not null"`
+	ChangedAt   time.Time `json:"changed_at" gorm:"not null;index:idx_card_status_changes_card_changed,priority:2"`
+}
@@ -7,12 +7,33 @@ import (
 )
 
 type Chat struct {
-	ID        uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
-	User1ID   uuid.UUID `json:"user1_id" gorm:"not null"`
-	User2ID   uuid.UUID `json:"user2_id" gorm:"not null"`
-	CreatedAt time.Time `json:"created_at"`
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	Type        string    `json:"type" gorm:"not null;default:'direct'"` // 'direct', 'group'
+	Title       string    `json:"title" gorm:"type:varchar(255)"`        // group chats only
+	AvatarURL   string    `json:"avatar_url"`                            // group chats only
+	CreatedByID uuid.UUID `json:"created_by_id" gorm:"type:uuid"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Messages from other members after the caller's read cursor; computed per request
+	UnreadCount int64 `json:"unread_count" gorm:"-"`
+
+	// Relations
+	Members []ChatMember `json:"members,omitempty" gorm:"foreignKey:ChatID;constraint:OnDelete:CASCADE"`
+}
+
+// ChatMember is a user's membership in a chat. Direct chats have exactly two
+// members; group chats have one owner and any number of admins and members.
+type ChatMember struct {
+	ID       uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	ChatID   uuid.UUID `json:"chat_id" gorm:"type:uuid;not null;uniqueIndex:idx_chat_member"`
+	UserID   uuid.UUID `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_chat_member;index"`
+	Role     string    `json:"role" gorm:"not null;default:'member'"` // 'owner', 'admin', 'member'
+	JoinedAt time.Time `json:"joined_at"`
+	// Read cursor: the newest message this member has read
+	LastReadMessageID *uuid.UUID `json:"last_read_message_id" gorm:"type:uuid"`
+	LastReadAt        *time.Time `json:"last_read_at"`
 
 	// Relations
-	User1 User `json:"user1" gorm:"foreignKey:User1ID"`
-	User2 User `json:"user2" gorm:"foreignKey:User2ID"`
+	User User `json:"user" gorm:"foreignKey:UserID"`
 }
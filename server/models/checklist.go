@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Checklist is a named, ordered list of items on a card.
+type Checklist struct {
+	ID        uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	CardID    uuid.UUID      `json:"card_id" gorm:"type:uuid;not null;index"`
+	Title     string         `json:"title" gorm:"not null"`
+	Rank      string         `json:"rank" gorm:"type:text;not null;default:''"` // order within the card, see utils.RankBetween
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Relations
+	Card  Card            `json:"-" gorm:"foreignKey:CardID"`
+	Items []ChecklistItem `json:"items" gorm:"foreignKey:ChecklistID"`
+}
+
+// ChecklistItem is one step of a checklist.
+type ChecklistItem struct {
+	ID          uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	ChecklistID uuid.UUID      `json:"checklist_id" gorm:"type:uuid;not null;index"`
+	Title       string         `json:"title" gorm:"not null"`
+	Rank        string         `json:"rank" gorm:"type:text;not null;default:''"` // order within the checklist
+	Done        bool           `json:"done" gorm:"not null;default:false"`
+	DoneAt      *time.Time     `json:"done_at"`
+	DoneByID    *uuid.UUID     `json:"done_by_id" gorm:"type:uuid"`
+	AssigneeID  *uuid.UUID     `json:"assignee_id" gorm:"type:uuid"`
+	DueDate     *time.Time     `json:"due_date"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Relations
+	Checklist Checklist `json:"-" gorm:"foreignKey:ChecklistID"`
+	Assignee  *User     `json:"assignee,omitempty" gorm:"foreignKey:AssigneeID"`
+}
@@ -10,7 +10,8 @@ import (
 type Column struct {
 	ID        uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
 	Name      string         `json:"name" gorm:"not null"`
-	Position  int            `json:"position" gorm:"not null"`
+	Rank      string         `json:"rank" gorm:"type:text;not null;default:''"` // order within the board, see utils.RankBetween
+	Version   int64          `json:"version" gorm:"not null;default:1"`         // bumped by every write; the ETag
 	Color     string         `json:"color" gorm:"default:'#6B7280'"`
 	BoardID   uuid.UUID      `json:"board_id" gorm:"type:uuid;not null"`
 	CreatedAt time.Time      `json:"created_at"`
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CardComment is a markdown comment in a card's discussion.
+type CardComment struct {
+	ID        uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	CardID    uuid.UUID      `json:"card_id" gorm:"type:uuid;not null;index"`
+	AuthorID  uuid.UUID      `json:"author_id" gorm:"type:uuid;not null"`
+	Body      string         `json:"body" gorm:"type:text;not null"` // markdown
+	EditedAt  *time.Time     `json:"edited_at"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Relations
+	Author   User             `json:"author" gorm:"foreignKey:AuthorID"`
+	Card     Card             `json:"-" gorm:"foreignKey:CardID"`
+	Mentions []CommentMention `json:"mentions,omitempty" gorm:"foreignKey:CommentID"`
+}
+
+// CommentMention is a user @mentioned in a comment. Keeping them lets an
+// edit notify only the users it newly mentions.
+type CommentMention struct {
+	ID        uuid.UUID `json:"-" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	CommentID uuid.UUID `json:"comment_id" gorm:"type:uuid;not null;uniqueIndex:idx_comment_mention"`
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_comment_mention"`
+	CreatedAt time.Time `json:"-"`
+
+	// Relations
+	User User `json:"user" gorm:"foreignKey:UserID"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Company is a customer organisation in a workspace's CRM. Domain is unique
+// per workspace and is how contacts are matched to their company.
+type Company struct {
+	ID          uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	WorkspaceID uuid.UUID      `json:"workspace_id" gorm:"type:uuid;not null;index"`
+	Name        string         `json:"name" gorm:"not null"`
+	Domain      string         `json:"domain" gorm:"not null;default:''"` // normalized, see utils.NormalizeDomain
+	Phone       string         `json:"phone" gorm:"type:varchar(50)"`
+	Notes       string         `json:"notes" gorm:"type:text"`
+	CreatedByID uuid.UUID      `json:"created_by_id" gorm:"type:uuid;not null"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// Contact is a person in a workspace's CRM. Email is unique per workspace.
+type Contact struct {
+	ID          uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	WorkspaceID uuid.UUID      `json:"workspace_id" gorm:"type:uuid;not null;index"`
+	Name        string         `json:"name" gorm:"not null"`
+	Email       string         `json:"email" gorm:"not null;default:''"` // normalized, see utils.NormalizeEmail
+	Phone       string         `json:"phone" gorm:"type:varchar(50)"`
+	Position    string         `json:"position"`
+	CompanyID   *uuid.UUID     `json:"company_id" gorm:"type:uuid;index"`
+	Notes       string         `json:"notes" gorm:"type:text"`
+	CreatedByID uuid.UUID      `json:"created_by_id" gorm:"type:uuid;not null"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Relations
+	Company *Company `json:"company,omitempty" gorm:"foreignKey:CompanyID"`
+}
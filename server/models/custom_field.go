@@ -0,0 +1,132 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Custom field types
+const (
+	FieldText        = "text"
+	FieldNumber      = "number"
+	FieldDate        = "date"
+	FieldSelect      = "select"
+	FieldMultiSelect = "multi_select"
+	FieldUser        = "user"
+	FieldURL         = "url"
+)
+
+// CustomField is a field defined on a board in addition to the built-in card
+// fields. Each card of the board may have a value for it, see
+// CardFieldValue.
+type CustomField struct {
+	ID        uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	BoardID   uuid.UUID      `json:"board_id" gorm:"type:uuid;not null;index"`
+	Name      string         `json:"name" gorm:"not null"`
+	Type      string         `json:"type" gorm:"not null"`      // one of the Field* constants; fixed once created
+	Options   FieldOptions   `json:"options" gorm:"type:jsonb"` // choices of select and multi_select fields
+	Rank      string         `json:"rank" gorm:"type:text;not null;default:''"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// FieldOption is one choice of a select field. Values refer to options by
+// ID, so options can be renamed.
+type FieldOption struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color,omitempty"`
+}
+
+// FieldOptions is stored as jsonb.
+type FieldOptions []FieldOption
+
+func (o FieldOptions) Value() (driver.Value, error) {
+	if o == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(o)
+	return string(b), err
+}
+
+func (o *FieldOptions) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*o = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, o)
+	case string:
+		return json.Unmarshal([]byte(v), o)
+	}
+	return errors.New("unsupported type for FieldOptions")
+}
+
+// CardFieldValue is a card's value for one custom field, kept in the column
+// for the field's type: Text for text, url and select (the option ID),
+// Number, Date, UserID, and OptionIDs for multi_select.
+type CardFieldValue struct {
+	CardID    uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	FieldID   uuid.UUID  `gorm:"type:uuid;primaryKey;index"`
+	Text      *string    `gorm:"type:text"`
+	Number    *float64   `gorm:"type:numeric"`
+	Date      *time.Time `gorm:"type:date"`
+	UserID    *uuid.UUID `gorm:"type:uuid"`
+	OptionIDs StringList `gorm:"type:jsonb"`
+	UpdatedAt time.Time
+}
+
+// JSONValue returns the value as it appears in JSON: a string, number, date
+// (YYYY-MM-DD), user ID or list of option IDs.
+func (v CardFieldValue) JSONValue() interface{} {
+	switch {
+	case v.Text != nil:
+		return *v.Text
+	case v.Number != nil:
+		return *v.Number
+	case v.Date != nil:
+		return v.Date.Format("2006-01-02")
+	case v.UserID != nil:
+		return *v.UserID
+	case v.OptionIDs != nil:
+		return v.OptionIDs
+	}
+	return nil
+}
+
+func (v CardFieldValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		FieldID uuid.UUID   `json:"field_id"`
+		Value   interface{} `json:"value"`
+	}{v.FieldID, v.JSONValue()})
+}
+
+// StringList is a list of strings stored as jsonb.
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(l)
+	return string(b), err
+}
+
+func (l *StringList) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, l)
+	case string:
+		return json.Unmarshal([]byte(v), l)
+	}
+	return errors.New("unsupported type for StringList")
+}
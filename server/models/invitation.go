@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WorkspaceInvitation lets people join a workspace. Email invitations are
+// addressed to one email and used once; link invitations can be shared and
+// used by anyone holding the token until they expire or run out of uses.
+type WorkspaceInvitation struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	WorkspaceID uuid.UUID `json:"workspace_id" gorm:"type:uuid;not null;index"`
+	InviterID   uuid.UUID `json:"inviter_id" gorm:"type:uuid;not null"`
+	Kind        string    `json:"kind" gorm:"not null"` // 'email', 'link'
+	// Lowercased addressee of email invitations
+	Email string `json:"email,omitempty" gorm:"index"`
+	// Only shown to workspace admins, who need it to share link invitations
+	Token string `json:"token,omitempty" gorm:"unique;not null"`
+	// Role granted on acceptance: 'admin' or 'member'
+	Role      string     `json:"role" gorm:"not null;default:'member'"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	// 0 means unlimited
+	MaxUses  int `json:"max_uses" gorm:"not null;default:0"`
+	UseCount int `json:"use_count" gorm:"not null;default:0"`
+	// 'pending', 'accepted', 'declined' or 'revoked'. Link invitations stay
+	// pending until revoked.
+	Status       string     `json:"status" gorm:"not null;default:'pending'"`
+	AcceptedByID *uuid.UUID `json:"accepted_by_id,omitempty" gorm:"type:uuid"`
+	RespondedAt  *time.Time `json:"responded_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+
+	// Relations
+	Workspace Workspace `json:"workspace,omitempty" gorm:"foreignKey:WorkspaceID"`
+	Inviter   User      `json:"inviter" gorm:"foreignKey:InviterID"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Label is a named colour tag defined per board and attached to its cards.
+type Label struct {
+	ID        uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	BoardID   uuid.UUID      `json:"board_id" gorm:"type:uuid;not null;index"`
+	Name      string         `json:"name" gorm:"not null"`
+	Color     string         `json:"color" gorm:"default:'#6B7280'"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// CardLabel attaches a label to a card (the join table of Card.Labels).
+type CardLabel struct {
+	CardID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	LabelID   uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	CreatedAt time.Time
+}
+
+// CardAssignee assigns a user to a card (the join table of Card.Assignees).
+type CardAssignee struct {
+	CardID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	CreatedAt time.Time
+}
@@ -8,15 +8,86 @@ import (
 
 type Message struct {
 	ID       uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
-	ChatID   uuid.UUID `json:"chat_id" gorm:"not null"`
-	SenderID uuid.UUID `json:"sender_id" gorm:"not null"`
+	ChatID   uuid.UUID `json:"chat_id" gorm:"not null;uniqueIndex:idx_messages_chat_client_id"`
+	SenderID uuid.UUID `json:"sender_id" gorm:"not null;uniqueIndex:idx_messages_chat_client_id"`
+	// Client-generated id; re-sending the same id to the same chat returns the stored message instead of a duplicate.
+	ClientID *string `json:"client_id,omitempty" gorm:"type:varchar(64);uniqueIndex:idx_messages_chat_client_id"`
+	// 'text' for user messages, 'system' for membership changes. System
+	// messages carry the event name in Content (e.g. 'member.added'), the
+	// acting user in SenderID and the affected user in TargetUserID.
+	Type         string     `json:"type" gorm:"not null;default:'text'"`
+	TargetUserID *uuid.UUID `json:"target_user_id,omitempty" gorm:"type:uuid"`
+	// Reply to an earlier message in the same chat
+	ReplyToMessageID *uuid.UUID `json:"reply_to_message_id,omitempty" gorm:"type:uuid"`
+	// Set on copies made by forwarding; the original may live in a chat the
+	// recipients cannot see, so its author is stored alongside
+	ForwardedFromMessageID *uuid.UUID `json:"forwarded_from_message_id,omitempty" gorm:"type:uuid"`
+	ForwardedFromSenderID  *uuid.UUID `json:"forwarded_from_sender_id,omitempty" gorm:"type:uuid"`
 	// Plaintext content for non-E2EE chats (legacy). Should be empty when E2EE is used.
 	Content string `json:"content"`
 	// E2EE payload fields
+	Ciphertext   string     `json:"ciphertext" gorm:"type:text"`
+	Nonce        string     `json:"nonce" gorm:"type:varchar(64)"`
+	Alg          string     `json:"alg" gorm:"type:varchar(64)"`
+	EphemeralPub string     `json:"ephemeral_pub" gorm:"type:text"`
+	CreatedAt    time.Time  `json:"created_at"`
+	EditedAt     *time.Time `json:"edited_at"`
+	// Tombstone for messages deleted for everyone: the row keeps its place in
+	// the history but its content and E2EE fields are cleared.
+	DeletedAt *time.Time `json:"deleted_at"`
+
+	// Preview of ReplyToMessageID; filled in by the handlers, not stored
+	ReplyTo *MessagePreview `json:"reply_to,omitempty" gorm:"-"`
+	// Aggregated reactions; filled in by the handlers, not stored
+	Reactions []ReactionSummary `json:"reactions,omitempty" gorm:"-"`
+	// Files sent with the message
+	Attachments []Attachment `json:"attachments,omitempty" gorm:"foreignKey:MessageID"`
+}
+
+// MessagePreview is a compact view of a referenced message. Content is
+// truncated and empty for E2EE or deleted messages.
+type MessagePreview struct {
+	ID        uuid.UUID `json:"id"`
+	SenderID  uuid.UUID `json:"sender_id"`
+	Content   string    `json:"content"`
+	Encrypted bool      `json:"encrypted"`
+	Deleted   bool      `json:"deleted"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MessageEdit keeps a previous version of an edited message.
+type MessageEdit struct {
+	ID           uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	MessageID    uuid.UUID `json:"message_id" gorm:"type:uuid;not null;index"`
+	Content      string    `json:"content"`
 	Ciphertext   string    `json:"ciphertext" gorm:"type:text"`
 	Nonce        string    `json:"nonce" gorm:"type:varchar(64)"`
 	Alg          string    `json:"alg" gorm:"type:varchar(64)"`
 	EphemeralPub string    `json:"ephemeral_pub" gorm:"type:text"`
-	CreatedAt    time.Time `json:"created_at"`
-	IsRead       bool      `json:"is_read"`
+	EditedAt     time.Time `json:"edited_at"`
+}
+
+// MessageHide hides a message from one user's history ("delete for me").
+type MessageHide struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	MessageID uuid.UUID `json:"message_id" gorm:"type:uuid;not null;uniqueIndex:idx_message_hide"`
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_message_hide"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MessageReaction is one user's emoji reaction to a message.
+type MessageReaction struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	MessageID uuid.UUID `json:"message_id" gorm:"type:uuid;not null;uniqueIndex:idx_message_reaction"`
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_message_reaction"`
+	Emoji     string    `json:"emoji" gorm:"type:varchar(32);not null;uniqueIndex:idx_message_reaction"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReactionSummary aggregates the reactions with one emoji on a message.
+// Reacted tells whether the requesting user is among them.
+type ReactionSummary struct {
+	Emoji   string `json:"emoji"`
+	Count   int64  `json:"count"`
+	Reacted bool   `json:"reacted"`
 }
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Notification tells a user about something another user did that concerns
+// them, such as mentioning them in a card comment.
+type Notification struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index:idx_notifications_user_created,priority:1"`
+	ActorID   uuid.UUID  `json:"actor_id" gorm:"type:uuid;not null"`
+	Type      string     `json:"type" gorm:"not null"` // 'mention'
+	BoardID   *uuid.UUID `json:"board_id,omitempty" gorm:"type:uuid"`
+	CardID    *uuid.UUID `json:"card_id,omitempty" gorm:"type:uuid"`
+	CommentID *uuid.UUID `json:"comment_id,omitempty" gorm:"type:uuid"`
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"index:idx_notifications_user_created,priority:2"`
+
+	// Relations
+	Actor User `json:"actor" gorm:"foreignKey:ActorID"`
+}
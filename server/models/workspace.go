@@ -19,6 +19,9 @@ type Workspace struct {
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
 
+	// The requesting user's role; filled in by the handlers, not stored
+	Role string `json:"role,omitempty" gorm:"-"`
+
 	// Relations
 	Owner   User              `json:"owner" gorm:"foreignKey:OwnerID"`
 	Boards  []Board           `json:"boards,omitempty" gorm:"foreignKey:WorkspaceID"`
@@ -27,8 +30,8 @@ type Workspace struct {
 
 type WorkspaceMember struct {
 	ID          uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
-	WorkspaceID uuid.UUID      `json:"workspace_id" gorm:"type:uuid;not null"`
-	UserID      uuid.UUID      `json:"user_id" gorm:"type:uuid;not null"`
+	WorkspaceID uuid.UUID      `json:"workspace_id" gorm:"type:uuid;not null;uniqueIndex:idx_workspace_member"`
+	UserID      uuid.UUID      `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_workspace_member"`
 	Role        string         `json:"role" gorm:"not null;default:'member'"` // 'owner', 'admin', 'member'
 	JoinedAt    time.Time      `json:"joined_at"`
 	CreatedAt   time.Time      `json:"created_at"`
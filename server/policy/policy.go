@@ -0,0 +1,191 @@
+// Package policy decides what a user may do on a board. Handlers resolve the
+// caller's effective permission once and compare it with what the action
+// needs, instead of re-implementing ownership and membership checks.
+package policy
+
+import (
+	"tether-server/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Permission is a user's access level on a board. Each level includes the
+// ones below it.
+type Permission int
+
+const (
+	None    Permission = iota
+	View               // read the board, its columns and cards
+	Comment            // View, plus comment on cards
+	Edit               // Comment, plus create, change and move columns and cards
+	Admin              // Edit, plus board settings, sharing and deletion
+)
+
+var names = []string{"none", "view", "comment", "edit", "admin"}
+
+func (p Permission) String() string {
+	if p < None || p > Admin {
+		return "none"
+	}
+	return names[p]
+}
+
+// Parse converts a stored permission name back into a Permission.
+func Parse(s string) (Permission, bool) {
+	for i, name := range names {
+		if name == s {
+			return Permission(i), true
+		}
+	}
+	return None, false
+}
+
+// Can reports whether p allows an action that needs required.
+func (p Permission) Can(required Permission) bool {
+	return p >= required
+}
+
+// ForBoard resolves userID's effective permission on board:
+//
+//   - the board owner, and owners and admins of the board's workspace, are Admin
+//   - a per-board member entry (models.BoardMember) overrides the default for
+//     workspace members, and grants guests outside the workspace access
+//   - other workspace members can Edit
+//   - anyone at all gets the board's PublicPermission on public boards
+//
+// The result is the highest level that applies.
+func ForBoard(db *gorm.DB, board models.Board, userID uuid.UUID) (Permission, error) {
+	if board.OwnerID == userID {
+		return Admin, nil
+	}
+
+	workspaceRole := ""
+	if board.WorkspaceID != nil {
+		var member models.WorkspaceMember
+		err := db.Where("workspace_id = ? AND user_id = ?", *board.WorkspaceID, userID).First(&member).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return None, err
+		}
+		workspaceRole = member.Role
+	}
+	if workspaceRole == "owner" || workspaceRole == "admin" {
+		return Admin, nil
+	}
+
+	var override models.BoardMember
+	err := db.Where("board_id = ? AND user_id = ?", board.ID, userID).First(&override).Error
+	switch {
+	case err == nil:
+		return resolve(board, userID, workspaceRole, &override.Permission), nil
+	case err != gorm.ErrRecordNotFound:
+		return None, err
+	}
+	return resolve(board, userID, workspaceRole, nil), nil
+}
+
+// ForBoards is ForBoard for many boards at once, with one lookup of userID's
+// workspace roles and one of their per-board entries. The result is indexed
+// like boards.
+func ForBoards(db *gorm.DB, boards []models.Board, userID uuid.UUID) ([]Permission, error) {
+	var workspaceIDs, boardIDs []uuid.UUID
+	for _, board := range boards {
+		boardIDs = append(boardIDs, board.ID)
+		if board.WorkspaceID != nil {
+			workspaceIDs = append(workspaceIDs, *board.WorkspaceID)
+		}
+	}
+
+	roles := map[uuid.UUID]string{}
+	if len(workspaceIDs) > 0 {
+		var members []models.WorkspaceMember
+		if err := db.Where("workspace_id IN ? AND user_id = ?", workspaceIDs, userID).Find(&members).Error; err != nil {
+			return nil, err
+		}
+		for _, m := range members {
+			roles[m.WorkspaceID] = m.Role
+		}
+	}
+
+	overrides := map[uuid.UUID]string{}
+	if len(boardIDs) > 0 {
+		var entries []models.BoardMember
+		if err := db.Where("board_id IN ? AND user_id = ?", boardIDs, userID).Find(&entries).Error; err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			overrides[e.BoardID] = e.Permission
+		}
+	}
+
+	perms := make([]Permission, len(boards))
+	for i, board := range boards {
+		role := ""
+		if board.WorkspaceID != nil {
+			role = roles[*board.WorkspaceID]
+		}
+		var override *string
+		if p, ok := overrides[board.ID]; ok {
+			override = &p
+		}
+		perms[i] = resolve(board, userID, role, override)
+	}
+	return perms, nil
+}
+
+// resolve applies the ForBoard rules to userID's workspace role on the
+// board's workspace ("" if none) and their per-board entry (nil if none).
+func resolve(board models.Board, userID uuid.UUID, workspaceRole string, override *string) Permission {
+	if board.OwnerID == userID || workspaceRole == "owner" || workspaceRole == "admin" {
+		return Admin
+	}
+
+	perm := None
+	if board.IsPublic {
+		perm = publicPermission(board)
+	}
+	switch {
+	case override != nil:
+		p, _ := Parse(*override)
+		perm = higher(perm, p)
+	case workspaceRole == "member":
+		perm = higher(perm, Edit)
+	}
+	return perm
+}
+
+// publicPermission is what public boards grant to everyone: read-only unless
+// the board's admins chose otherwise. Admin is never granted this way.
+func publicPermission(board models.Board) Permission {
+	p, ok := Parse(board.PublicPermission)
+	if !ok || p == None {
+		return View
+	}
+	if p > Edit {
+		return Edit
+	}
+	return p
+}
+
+func higher(a, b Permission) Permission {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// ListedBoardsSQL matches the boards that show up in userID's board list and
+// search results, bound as the named argument @viewer: boards they own, boards
+// shared with them, and boards of their workspaces unless an override hides
+// them. Public boards of others are reachable by link but not listed.
+const ListedBoardsSQL = `boards.deleted_at IS NULL AND (
+	boards.owner_id = @viewer
+	OR EXISTS (SELECT 1 FROM board_members bm WHERE bm.board_id = boards.id AND bm.user_id = @viewer AND bm.permission <> 'none')
+	OR EXISTS (SELECT 1 FROM workspace_members wm WHERE wm.workspace_id = boards.workspace_id AND wm.user_id = @viewer
+		AND (wm.role IN ('owner', 'admin')
+			OR NOT EXISTS (SELECT 1 FROM board_members bm WHERE bm.board_id = boards.id AND bm.user_id = @viewer))))`
+
+// ListedBoards scopes a boards query to ListedBoardsSQL.
+func ListedBoards(db *gorm.DB, userID uuid.UUID) *gorm.DB {
+	return db.Where(ListedBoardsSQL, map[string]interface{}{"viewer": userID})
+}
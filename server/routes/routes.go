@@ -29,6 +29,10 @@ func SetupRoutes(app *fiber.App) {
 	auth.Post("/refresh-token", handlers.RefreshToken)
 	auth.Post("/logout", handlers.Logout)
 
+	// Attachment downloads are authorized by signed URLs rather than tokens
+	api.Get("/files/attachments/:id", handlers.DownloadAttachment)
+	api.Get("/files/attachments/:id/thumbnail", handlers.DownloadAttachment)
+
 	// Protected routes
 	protected := api.Group("/", middleware.AuthMiddleware())
 
@@ -36,32 +40,131 @@ func SetupRoutes(app *fiber.App) {
 	protected.Get("/chats", handlers.GetChats)
 	protected.Post("/chats", handlers.CreateChat)
 	protected.Get("/chats/:chatId", handlers.GetChat)
+	protected.Put("/chats/:chatId", handlers.UpdateChat)
 	protected.Get("/chats/:chatId/messages", handlers.GetMessages)
+	protected.Post("/chats/:chatId/read", handlers.MarkChatRead)
+	protected.Post("/chats/:chatId/members", handlers.AddChatMembers)
+	protected.Delete("/chats/:chatId/members/:userId", handlers.RemoveChatMember)
+	protected.Put("/chats/:chatId/members/:userId/role", handlers.UpdateChatMemberRole)
+	protected.Post("/chats/:chatId/leave", handlers.LeaveChat)
+	protected.Post("/chats/:chatId/attachments", handlers.UploadAttachment)
+	protected.Post("/chats/:chatId/attachments/uploads", handlers.StartAttachmentUpload)
+	protected.Get("/attachments/:id", handlers.GetAttachment)
+	protected.Put("/attachments/:id/chunks", handlers.UploadAttachmentChunk)
+	protected.Post("/attachments/:id/complete", handlers.CompleteAttachmentUpload)
 	protected.Post("/messages", handlers.SendMessage)
+	protected.Put("/messages/:id", handlers.UpdateMessage)
+	protected.Delete("/messages/:id", handlers.DeleteMessage)
+	protected.Get("/messages/:id/edits", handlers.GetMessageEdits)
+	protected.Post("/messages/:id/forward", handlers.ForwardMessage)
+	protected.Post("/messages/:id/reactions", handlers.AddReaction)
+	protected.Delete("/messages/:id/reactions", handlers.RemoveReaction)
 
 	// User routes
 	protected.Get("/users/search", handlers.SearchUsers)
+
+	// Search routes
+	protected.Get("/search/users", handlers.SearchUsers)
+	protected.Get("/search/messages", handlers.SearchMessages)
+	protected.Get("/search/cards", handlers.SearchCards)
+	protected.Get("/search/boards", handlers.SearchBoards)
 	protected.Get("/profile", handlers.GetProfile)
 	protected.Put("/profile", handlers.UpdateProfile)
 	protected.Post("/profile/avatar", handlers.UploadAvatar)
 
+	// Workspace routes
+	protected.Get("/workspaces", handlers.GetWorkspaces)
+	protected.Post("/workspaces", handlers.CreateWorkspace)
+	protected.Get("/workspaces/:id", handlers.GetWorkspace)
+	protected.Put("/workspaces/:id", handlers.UpdateWorkspace)
+	protected.Delete("/workspaces/:id", handlers.DeleteWorkspace)
+	protected.Get("/workspaces/:id/members", handlers.GetWorkspaceMembers)
+	protected.Put("/workspaces/:id/members/:userId/role", handlers.UpdateWorkspaceMemberRole)
+	protected.Delete("/workspaces/:id/members/:userId", handlers.RemoveWorkspaceMember)
+	protected.Post("/workspaces/:id/leave", handlers.LeaveWorkspace)
+	protected.Post("/workspaces/:id/transfer", handlers.TransferWorkspaceOwnership)
+	protected.Get("/workspaces/:id/invitations", handlers.GetWorkspaceInvitations)
+	protected.Post("/workspaces/:id/invitations", handlers.CreateWorkspaceInvitation)
+	protected.Delete("/workspaces/:id/invitations/:invitationId", handlers.RevokeWorkspaceInvitation)
+
+	// Invitation routes
+	protected.Get("/invitations", handlers.GetMyInvitations)
+	protected.Get("/invitations/:token", handlers.GetInvitation)
+	protected.Post("/invitations/:token/accept", handlers.AcceptInvitation)
+	protected.Post("/invitations/:token/decline", handlers.DeclineInvitation)
+
 	// Board routes
 	protected.Get("/boards", handlers.GetBoards)
 	protected.Post("/boards", handlers.CreateBoard)
 	protected.Get("/boards/:id", handlers.GetBoard)
 	protected.Put("/boards/:id", handlers.UpdateBoard)
 	protected.Delete("/boards/:id", handlers.DeleteBoard)
+	protected.Get("/boards/:id/activity", handlers.GetBoardActivity)
+	protected.Get("/boards/:id/pipeline", handlers.GetBoardPipeline)
+	protected.Get("/boards/:id/members", handlers.GetBoardMembers)
+	protected.Put("/boards/:id/members/:userId", handlers.SetBoardMember)
+	protected.Delete("/boards/:id/members/:userId", handlers.RemoveBoardMember)
+	protected.Get("/boards/:id/labels", handlers.GetBoardLabels)
+	protected.Post("/boards/:id/labels", handlers.CreateLabel)
+	protected.Put("/labels/:id", handlers.UpdateLabel)
+	protected.Delete("/labels/:id", handlers.DeleteLabel)
+	protected.Get("/boards/:id/fields", handlers.GetBoardFields)
+	protected.Post("/boards/:id/fields", handlers.CreateCustomField)
+	protected.Put("/fields/:id", handlers.UpdateCustomField)
+	protected.Delete("/fields/:id", handlers.DeleteCustomField)
+	protected.Get("/boards/:id/export", handlers.ExportBoard)
+	protected.Post("/boards/import", handlers.ImportBoard)
 
 	// Column routes
 	protected.Post("/columns", handlers.CreateColumn)
+	protected.Get("/columns/:id", handlers.GetColumn)
 	protected.Put("/columns/:id", handlers.UpdateColumn)
+	protected.Post("/columns/:id/move", handlers.MoveColumn)
 	protected.Delete("/columns/:id", handlers.DeleteColumn)
 
 	// Card routes
 	protected.Post("/cards", handlers.CreateCard)
+	protected.Get("/cards/:id", handlers.GetCard)
+	protected.Get("/cards/:id/activity", handlers.GetCardActivity)
 	protected.Put("/cards/:id", handlers.UpdateCard)
+	protected.Post("/cards/:id/move", handlers.MoveCard)
 	protected.Delete("/cards/:id", handlers.DeleteCard)
 
+	// Comment routes
+	protected.Get("/cards/:id/comments", handlers.GetCardComments)
+	protected.Post("/cards/:id/comments", handlers.CreateCardComment)
+	protected.Put("/comments/:id", handlers.UpdateCardComment)
+	protected.Delete("/comments/:id", handlers.DeleteCardComment)
+
+	// Checklist routes
+	protected.Get("/cards/:id/checklists", handlers.GetCardChecklists)
+	protected.Post("/cards/:id/checklists", handlers.CreateChecklist)
+	protected.Put("/checklists/:id", handlers.UpdateChecklist)
+	protected.Delete("/checklists/:id", handlers.DeleteChecklist)
+	protected.Post("/checklists/:id/items", handlers.CreateChecklistItem)
+	protected.Put("/checklist-items/:id", handlers.UpdateChecklistItem)
+	protected.Post("/checklist-items/:id/move", handlers.MoveChecklistItem)
+	protected.Delete("/checklist-items/:id", handlers.DeleteChecklistItem)
+
+	// CRM contact routes
+	protected.Get("/workspaces/:id/contacts", handlers.GetContacts)
+	protected.Post("/workspaces/:id/contacts", handlers.CreateContact)
+	protected.Get("/contacts/:id", handlers.GetContact)
+	protected.Put("/contacts/:id", handlers.UpdateContact)
+	protected.Delete("/contacts/:id", handlers.DeleteContact)
+	protected.Get("/contacts/:id/timeline", handlers.GetContactTimeline)
+	protected.Get("/workspaces/:id/companies", handlers.GetCompanies)
+	protected.Post("/workspaces/:id/companies", handlers.CreateCompany)
+	protected.Get("/companies/:id", handlers.GetCompany)
+	protected.Put("/companies/:id", handlers.UpdateCompany)
+	protected.Delete("/companies/:id", handlers.DeleteCompany)
+	protected.Get("/companies/:id/timeline", handlers.GetCompanyTimeline)
+
+	// Notification routes
+	protected.Get("/notifications", handlers.GetNotifications)
+	protected.Post("/notifications/read", handlers.MarkAllNotificationsRead)
+	protected.Post("/notifications/:id/read", handlers.MarkNotificationRead)
+
 	// E2EE routes
 	protected.Post("/e2ee/device-keys", handlers.PublishDeviceKeys)
 	protected.Get("/e2ee/prekey-bundle/:userId", handlers.FetchPreKeyBundle)
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckKey(t *testing.T) {
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{"attachments/2024/05/3f2a.png", true},
+		{"avatar.jpg", true},
+		{"a/b_c-d.e", true},
+		{"", false},
+		{"/etc/passwd", false},
+		{"../secret", false},
+		{"attachments/../../secret", false},
+		{"attachments/./a", false},
+		{"attachments//a", false},
+		{"attachments/", false},
+		{".hidden", false},
+		{`attachments\a`, false},
+		{"with space", false},
+		{"query?x=1", false},
+		{"percent%2F", false},
+	}
+	for _, tt := range tests {
+		if err := checkKey(tt.key); (err == nil) != tt.valid {
+			t.Errorf("checkKey(%q) = %v, want valid %v", tt.key, err, tt.valid)
+		}
+	}
+}
+
+func TestLocal(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "files")
+	l := NewLocal(root)
+	ctx := context.Background()
+
+	body := "thumbnail bytes"
+	if err := l.Put(ctx, "attachments/x/a.bin", strings.NewReader(body+" extra"), int64(len(body)), ""); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	r, err := l.Get(ctx, "attachments/x/a.bin")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, _ := io.ReadAll(r)
+	r.Close()
+	if string(got) != body {
+		t.Errorf("Get = %q, want %q", got, body)
+	}
+
+	// A short body fails without leaving a partial object behind
+	if err := l.Put(ctx, "attachments/x/short.bin", strings.NewReader("abc"), 10, ""); err == nil {
+		t.Error("Put of a short body succeeded")
+	}
+	if _, err := l.Get(ctx, "attachments/x/short.bin"); err != ErrNotFound {
+		t.Errorf("Get after failed Put: err = %v, want ErrNotFound", err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(root, "attachments", "x"))
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d entries, want 1", len(entries))
+	}
+
+	if err := l.Delete(ctx, "attachments/x/a.bin"); err != nil {
+		t.Errorf("Delete: %v", err)
+	}
+	if _, err := l.Get(ctx, "attachments/x/a.bin"); err != ErrNotFound {
+		t.Errorf("Get deleted: err = %v, want ErrNotFound", err)
+	}
+	if err := l.Delete(ctx, "attachments/x/a.bin"); err != nil {
+		t.Errorf("Delete missing: %v", err)
+	}
+
+	// Keys cannot reach outside the root
+	for _, key := range []string{"../outside", "/tmp/outside", "a/../../outside"} {
+		if err := l.Put(ctx, key, strings.NewReader("x"), 1, ""); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+		if _, err := l.Get(ctx, key); err == nil || err == ErrNotFound {
+			t.Errorf("Get(%q): err = %v, want invalid key", key, err)
+		}
+		if err := l.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q) succeeded", key)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "outside")); !os.IsNotExist(err) {
+		t.Error("file written outside the root")
+	}
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"regexp"
+	"tether-server/config"
+)
+
+// ErrNotFound is returned by Get when the object does not exist.
+var ErrNotFound = errors.New("object not found")
+
+// Storage is a flat object store addressed by slash-separated keys.
+type Storage interface {
+	// Put stores size bytes read from r under key, replacing any existing object.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the object for reading. The caller must close it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Store is the backend selected by configuration.
+var Store Storage
+
+// Init selects the storage backend from config.AppConfig.
+func Init() {
+	cfg := config.AppConfig
+	switch cfg.StorageBackend {
+	case "s3":
+		Store = NewS3(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey)
+		log.Printf("Attachment storage: s3 bucket %s at %s", cfg.S3Bucket, cfg.S3Endpoint)
+	case "local":
+		Store = NewLocal(cfg.StorageDir)
+		log.Printf("Attachment storage: local directory %s", cfg.StorageDir)
+	default:
+		log.Fatalf("Unknown STORAGE_BACKEND %q", cfg.StorageBackend)
+	}
+}
+
+// Keys are generated by the server; restricting them keeps both backends
+// free of path traversal and URL-escaping concerns.
+var validKey = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*(/[A-Za-z0-9][A-Za-z0-9._-]*)*$`)
+
+func checkKey(key string) error {
+	if !validKey.MatchString(key) {
+		return errors.New("invalid storage key")
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"strings"
+)
+
+// Mail providers whose domain says nothing about the company a contact
+// works for
+var freeMailDomains = map[string]bool{
+	"gmail.com": true, "googlemail.com": true, "yahoo.com": true, "hotmail.com": true,
+	"outlook.com": true, "live.com": true, "icloud.com": true, "me.com": true,
+	"aol.com": true, "proton.me": true, "protonmail.com": true, "gmx.com": true,
+	"mail.ru": true, "yandex.ru": true, "ya.ru": true, "rambler.ru": true, "bk.ru": true,
+	"list.ru": true, "inbox.ru": true,
+}
+
+// NormalizeEmail trims and lowercases an email address so that the same
+// address always compares equal.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizeDomain reduces a domain or website URL to its lowercase host
+// without "www.", e.g. "https://www.Example.com/about" to "example.com".
+func NormalizeDomain(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if i := strings.Index(s, "://"); i >= 0 {
+		s = s[i+3:]
+	}
+	if i := strings.IndexAny(s, "/?#"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		s = s[i+1:]
+	}
+	if i := strings.Index(s, ":"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(s, "www."), ".")
+}
+
+// CompanyDomain returns the domain of an email address when it identifies
+// the sender's company, and "" for free mail providers or invalid
+// addresses.
+func CompanyDomain(email string) string {
+	email = NormalizeEmail(email)
+	i := strings.LastIndex(email, "@")
+	if i <= 0 {
+		return ""
+	}
+	domain := NormalizeDomain(email[i+1:])
+	if domain == "" || !strings.Contains(domain, ".") || freeMailDomains[domain] {
+		return ""
+	}
+	return domain
+}
@@ -33,6 +33,14 @@ func SendPasswordResetEmail(email, token, displayName string) error {
 	return nil
 }
 
+// SendWorkspaceInvitationEmail - placeholder for workspace invitation email
+func SendWorkspaceInvitationEmail(email, token, workspaceName, inviterName string) error {
+	// For now, just log the invitation link
+	inviteURL := fmt.Sprintf("http://localhost:3000/invite/%s", token)
+	log.Printf("[MOCK EMAIL] %s invited %s to workspace %q: %s", inviterName, email, workspaceName, inviteURL)
+	return nil
+}
+
 // IsValidEmail performs basic email validation
 func IsValidEmail(email string) bool {
 	// Basic email validation - in production use a proper email validation library
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+
+	// Decoders for the formats we generate thumbnails for
+	_ "image/gif"
+	_ "image/png"
+)
+
+// Size limits for thumbnail generation
+const (
+	ThumbnailSize = 320
+	// Images with more pixels than this are not decoded at all, which guards
+	// against decompression bombs.
+	maxImagePixels = 40_000_000
+)
+
+var ErrImageTooLarge = errors.New("image too large")
+
+// ImageSize returns the dimensions of a GIF, JPEG or PNG image without
+// decoding it.
+func ImageSize(data []byte) (width, height int, err error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// MakeThumbnail decodes a GIF, JPEG or PNG image and returns a JPEG that fits
+// within ThumbnailSize×ThumbnailSize, keeping the aspect ratio.
+func MakeThumbnail(data []byte) ([]byte, error) {
+	width, height, err := ImageSize(data)
+	if err != nil {
+		return nil, err
+	}
+	if width*height > maxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	tw, th := width, height
+	if tw > ThumbnailSize || th > ThumbnailSize {
+		if tw >= th {
+			tw, th = ThumbnailSize, height*ThumbnailSize/width
+		} else {
+			tw, th = width*ThumbnailSize/height, ThumbnailSize
+		}
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	rgba := image.NewRGBA(src.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), src, src.Bounds().Min, draw.Src)
+	thumb := downscale(rgba, tw, th)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// downscale shrinks src to w×h by averaging each destination pixel's box of
+// source pixels. Transparent areas are flattened onto white.
+func downscale(src *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, (y+1)*sh/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, (x+1)*sw/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					i := sy*src.Stride + sx*4
+					// Premultiplied alpha: adding the missing coverage as white
+					white := uint64(255 - src.Pix[i+3])
+					r += uint64(src.Pix[i]) + white
+					g += uint64(src.Pix[i+1]) + white
+					b += uint64(src.Pix[i+2]) + white
+					n++
+				}
+			}
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = 255
+		}
+	}
+	return dst
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func pngImage(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withPNGSize rewrites the dimensions in a PNG header, keeping its checksum
+// valid, so a tiny file can claim to be a huge image.
+func withPNGSize(data []byte, w, h uint32) []byte {
+	out := append([]byte{}, data...)
+	// 8-byte signature, then the IHDR chunk: length, type, data, CRC
+	ihdr := out[8+8 : 8+8+13]
+	binary.BigEndian.PutUint32(ihdr[0:4], w)
+	binary.BigEndian.PutUint32(ihdr[4:8], h)
+	binary.BigEndian.PutUint32(out[8+8+13:], crc32.ChecksumIEEE(out[8+4:8+8+13]))
+	return out
+}
+
+func TestMakeThumbnailSize(t *testing.T) {
+	tests := []struct {
+		name         string
+		w, h         int
+		wantW, wantH int
+	}{
+		{"small image kept", 50, 40, 50, 40},
+		{"exact size kept", ThumbnailSize, ThumbnailSize, ThumbnailSize, ThumbnailSize},
+		{"landscape", 640, 320, 320, 160},
+		{"portrait", 100, 1000, 32, 320},
+		{"square", 500, 500, 320, 320},
+		{"thin strip keeps one pixel", 2000, 1, 320, 1},
+	}
+	for _, tt := range tests {
+		thumb, err := MakeThumbnail(pngImage(t, tt.w, tt.h))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(thumb))
+		if err != nil || format != "jpeg" {
+			t.Errorf("%s: thumbnail is not a JPEG (%s, %v)", tt.name, format, err)
+			continue
+		}
+		if cfg.Width != tt.wantW || cfg.Height != tt.wantH {
+			t.Errorf("%s: %dx%d thumbnail, want %dx%d", tt.name, cfg.Width, cfg.Height, tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestMakeThumbnailRejects(t *testing.T) {
+	small := pngImage(t, 4, 4)
+	if w, h, err := ImageSize(withPNGSize(small, 8000, 6000)); err != nil || w != 8000 || h != 6000 {
+		t.Fatalf("ImageSize of rewritten header = %dx%d, %v", w, h, err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error // nil for any error
+	}{
+		{"too many pixels", withPNGSize(small, 8000, 6000), ErrImageTooLarge},
+		{"too many pixels in one row", withPNGSize(small, 50_000_000, 1), ErrImageTooLarge},
+		{"not an image", []byte("%PDF-1.4"), nil},
+		{"empty", nil, nil},
+		{"truncated", small[:len(small)/2], nil},
+	}
+	for _, tt := range tests {
+		_, err := MakeThumbnail(tt.data)
+		if err == nil || (tt.err != nil && err != tt.err) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
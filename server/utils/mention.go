@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Most distinct users a single text can mention
+const maxMentions = 50
+
+var (
+	// @name at the start of the text or after a character that can't be part
+	// of a word or an email address
+	mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.@/-])@([\p{L}\p{N}_][\p{L}\p{N}_.-]*)`)
+	// Fenced code blocks and inline code spans, where @ is not a mention
+	codeFence = regexp.MustCompile("(?s)```.*?(```|$)")
+	codeSpan  = regexp.MustCompile("`[^`\n]*`")
+)
+
+// ParseMentions returns the usernames @mentioned in a markdown text, in
+// order of first appearance and without duplicates. Mentions inside code are
+// ignored, and trailing dots or hyphens are taken as punctuation.
+func ParseMentions(markdown string) []string {
+	text := codeFence.ReplaceAllString(markdown, " ")
+	text = codeSpan.ReplaceAllString(text, " ")
+
+	var names []string
+	seen := map[string]bool{}
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		name := strings.TrimRight(m[1], ".-")
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+		if len(names) == maxMentions {
+			break
+		}
+	}
+	return names
+}
@@ -0,0 +1,88 @@
+package utils
+
+import "strings"
+
+// Ranks order cards within a column and columns within a board. They are
+// strings over rankDigits compared bytewise (in SQL, with COLLATE "C"), so a
+// moved item gets a new rank between its neighbours and no sibling has to be
+// renumbered. Ranks never end in the lowest digit, which keeps room below
+// every rank.
+const rankDigits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// RankBetween returns a rank that sorts strictly after a and before b. An
+// empty a means "before everything", an empty b "after everything". a must
+// sort before b.
+func RankBetween(a, b string) string {
+	if b != "" {
+		// Keep the common prefix, padding a with the lowest digit
+		n := 0
+		for n < len(b) && rankDigitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			return b[:n] + RankBetween(rankTail(a, n), b[n:])
+		}
+	}
+
+	lo := 0
+	if a != "" {
+		lo = strings.IndexByte(rankDigits, a[0])
+	}
+	hi := len(rankDigits)
+	if b != "" {
+		hi = strings.IndexByte(rankDigits, b[0])
+	}
+	if hi-lo > 1 {
+		// Appending and prepending step by one digit rather than halving,
+		// so ranks grow slowly when items keep being added at one end
+		switch {
+		case a != "" && b == "":
+			return string(rankDigits[lo+1])
+		case a == "" && b != "":
+			return string(rankDigits[hi-1])
+		}
+		return string(rankDigits[(lo+hi+1)/2])
+	}
+	// Adjacent first digits: b's first digit alone still sorts after a
+	// unless b is a single digit, in which case go one digit deeper after a
+	if len(b) > 1 {
+		return b[:1]
+	}
+	return string(rankDigits[lo]) + RankBetween(rankTail(a, 1), "")
+}
+
+// RankSequence returns n evenly spaced ascending ranks, used when a whole
+// list is (re)numbered at once.
+func RankSequence(n int) []string {
+	width, space := 1, uint64(len(rankDigits))
+	for space <= uint64(n) {
+		width++
+		space *= uint64(len(rankDigits))
+	}
+
+	ranks := make([]string, n)
+	buf := make([]byte, width)
+	for i := range ranks {
+		v := uint64(i+1) * space / uint64(n+1)
+		for j := width - 1; j >= 0; j-- {
+			buf[j] = rankDigits[v%uint64(len(rankDigits))]
+			v /= uint64(len(rankDigits))
+		}
+		ranks[i] = strings.TrimRight(string(buf), rankDigits[:1])
+	}
+	return ranks
+}
+
+func rankDigitAt(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return rankDigits[0]
+}
+
+func rankTail(s string, n int) string {
+	if n >= len(s) {
+		return ""
+	}
+	return s[n:]
+}
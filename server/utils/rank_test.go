@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// checkRank fails unless r is a well-formed rank strictly between a and b,
+// where an empty a or b is unbounded.
+func checkRank(t *testing.T, r, a, b string) {
+	t.Helper()
+	if r == "" || strings.Trim(r, rankDigits) != "" || r[len(r)-1] == rankDigits[0] {
+		t.Fatalf("RankBetween(%q, %q) = %q, not a valid rank", a, b, r)
+	}
+	if (a != "" && r <= a) || (b != "" && r >= b) {
+		t.Fatalf("RankBetween(%q, %q) = %q, not between them", a, b, r)
+	}
+}
+
+func TestRankBetween(t *testing.T) {
+	tests := []struct{ a, b string }{
+		{"", ""},
+		{"", "1"},
+		{"", "01"},
+		{"", "001"},
+		{"z", ""},
+		{"zz", ""},
+		{"zzz", ""},
+		{"a", "b"},
+		{"a", "a1"},
+		{"a", "a01"},
+		{"az", "b"},
+		{"a1", "a2"},
+		{"ay", "az"},
+		{"1", "z"},
+		{"i", "i001"},
+		{"0001", "001"},
+		{"yz", "z"},
+	}
+	for _, tt := range tests {
+		checkRank(t, RankBetween(tt.a, tt.b), tt.a, tt.b)
+	}
+}
+
+func TestRankBetweenRuns(t *testing.T) {
+	// Appending keeps going after the last rank, one digit longer about
+	// every 18 ranks
+	last := ""
+	for i := 0; i < 1000; i++ {
+		r := RankBetween(last, "")
+		checkRank(t, r, last, "")
+		last = r
+	}
+	if len(last) > 60 {
+		t.Errorf("after 1000 appends the rank is %d digits long", len(last))
+	}
+
+	// Prepending keeps going before the first rank
+	first := ""
+	for i := 0; i < 1000; i++ {
+		r := RankBetween("", first)
+		checkRank(t, r, "", first)
+		first = r
+	}
+	if len(first) > 60 {
+		t.Errorf("after 1000 prepends the rank is %d digits long", len(first))
+	}
+
+	// Inserting again and again right after one item, and right before one
+	lo, hi := "a", "b"
+	for i := 0; i < 200; i++ {
+		r := RankBetween(lo, hi)
+		checkRank(t, r, lo, hi)
+		hi = r
+	}
+	lo, hi = "a", "b"
+	for i := 0; i < 200; i++ {
+		r := RankBetween(lo, hi)
+		checkRank(t, r, lo, hi)
+		lo = r
+	}
+}
+
+func TestRankBetweenRandomInserts(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	ranks := []string{}
+	for i := 0; i < 2000; i++ {
+		pos := rnd.Intn(len(ranks) + 1)
+		a, b := "", ""
+		if pos > 0 {
+			a = ranks[pos-1]
+		}
+		if pos < len(ranks) {
+			b = ranks[pos]
+		}
+		r := RankBetween(a, b)
+		checkRank(t, r, a, b)
+		ranks = append(ranks[:pos], append([]string{r}, ranks[pos:]...)...)
+	}
+}
+
+func TestRankSequence(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 35, 36, 37, 100, 1295, 1296, 5000} {
+		ranks := RankSequence(n)
+		if len(ranks) != n {
+			t.Fatalf("RankSequence(%d) returned %d ranks", n, len(ranks))
+		}
+		for i, r := range ranks {
+			prev := ""
+			if i > 0 {
+				prev = ranks[i-1]
+			}
+			checkRank(t, r, prev, "")
+		}
+		// The sequence leaves room at both ends and between neighbours
+		if n > 0 {
+			checkRank(t, RankBetween("", ranks[0]), "", ranks[0])
+			checkRank(t, RankBetween(ranks[n-1], ""), ranks[n-1], "")
+		}
+		for i := 1; i < n; i++ {
+			checkRank(t, RankBetween(ranks[i-1], ranks[i]), ranks[i-1], ranks[i])
+		}
+	}
+}
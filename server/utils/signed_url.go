@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"tether-server/config"
+	"time"
+)
+
+// SignPath returns path with expires and sig query parameters that let
+// anyone holding the URL fetch it until ttl elapses, without a bearer token.
+func SignPath(path string, ttl time.Duration) string {
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	q := url.Values{}
+	q.Set("expires", expires)
+	q.Set("sig", pathSignature(path, expires))
+	return path + "?" + q.Encode()
+}
+
+// VerifySignedPath checks a signature produced by SignPath.
+func VerifySignedPath(path, expires, sig string) bool {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(pathSignature(path, expires)))
+}
+
+func pathSignature(path, expires string) string {
+	mac := hmac.New(sha256.New, []byte(config.AppConfig.JWTSecret))
+	mac.Write([]byte("signed-path\n" + path + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,252 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// ProtocolVersion is the envelope version spoken by this server.
+const ProtocolVersion = 1
+
+// Event types
+const (
+	TypeMessageNew = "message.new"
+	TypeMessageAck = "message.ack"
+	TypeTyping     = "typing"
+	TypeRead       = "read"
+	TypePresence   = "presence"
+	TypeError      = "error"
+
+	// Server-originated only
+	TypeMessageEdited  = "message.edited"
+	TypeMessageDeleted = "message.deleted"
+	TypeReaction       = "reaction"
+
+	// Board subscriptions
+	TypeBoardSubscribe   = "board.subscribe"
+	TypeBoardUnsubscribe = "board.unsubscribe"
+	TypeBoardSubscribed  = "board.subscribed"
+	// The server dropped every subscription to the board because who may
+	// see it changed; clients resubscribe and refetch.
+	TypeBoardAccessChanged = "board.access_changed"
+
+	// Board changes, carrying the board revision they produced
+	TypeBoardUpdated  = "board.updated"
+	TypeBoardDeleted  = "board.deleted"
+	TypeColumnCreated = "column.created"
+	TypeColumnUpdated = "column.updated"
+	TypeColumnMoved   = "column.moved"
+	TypeColumnDeleted = "column.deleted"
+	TypeCardCreated   = "card.created"
+	TypeCardUpdated   = "card.updated"
+	TypeCardMoved     = "card.moved"
+	TypeCardDeleted   = "card.deleted"
+
+	TypeCommentCreated = "comment.created"
+	TypeCommentUpdated = "comment.updated"
+	TypeCommentDeleted = "comment.deleted"
+
+	TypeChecklistCreated     = "checklist.created"
+	TypeChecklistUpdated     = "checklist.updated"
+	TypeChecklistDeleted     = "checklist.deleted"
+	TypeChecklistItemCreated = "checklist_item.created"
+	TypeChecklistItemUpdated = "checklist_item.updated"
+	TypeChecklistItemMoved   = "checklist_item.moved"
+	TypeChecklistItemDeleted = "checklist_item.deleted"
+
+	TypeLabelCreated = "label.created"
+	TypeLabelUpdated = "label.updated"
+	TypeLabelDeleted = "label.deleted"
+
+	TypeCustomFieldCreated = "custom_field.created"
+	TypeCustomFieldUpdated = "custom_field.updated"
+	TypeCustomFieldDeleted = "custom_field.deleted"
+
+	// Sent to the user a notification is for
+	TypeNotification = "notification"
+)
+
+// Maximum length of a client-generated envelope id.
+const maxEnvelopeIDLength = 64
+
+// Envelope is the JSON frame exchanged over the socket in both directions.
+// ID is generated by the client and echoed back in acks and errors so the
+// client can reconcile optimistic UI. Board events carry the board's
+// revision in Rev; revisions grow by one per change, so a client that sees
+// a gap has missed events and should refetch the board.
+type Envelope struct {
+	V       int             `json:"v"`
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	ChatID  *uuid.UUID      `json:"chat_id,omitempty"`
+	BoardID *uuid.UUID      `json:"board_id,omitempty"`
+	Rev     int64           `json:"rev,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// inboundRules lists the event types a client may send and whether they
+// need an id, a chat_id and a board_id.
+var inboundRules = map[string]struct {
+	needID      bool
+	needChatID  bool
+	needBoardID bool
+}{
+	TypeMessageNew:       {needID: true, needChatID: true},
+	TypeTyping:           {needChatID: true},
+	TypeRead:             {needChatID: true},
+	TypeBoardSubscribe:   {needBoardID: true},
+	TypeBoardUnsubscribe: {needBoardID: true},
+}
+
+// Validate checks an inbound envelope against the protocol.
+func (e *Envelope) Validate() error {
+	if e.V != ProtocolVersion {
+		return fmt.Errorf("unsupported protocol version %d", e.V)
+	}
+	rule, ok := inboundRules[e.Type]
+	if !ok {
+		return fmt.Errorf("unsupported event type %q", e.Type)
+	}
+	if len(e.ID) > maxEnvelopeIDLength {
+		return errors.New("id is too long")
+	}
+	if rule.needID && e.ID == "" {
+		return errors.New("id is required")
+	}
+	if rule.needChatID && (e.ChatID == nil || *e.ChatID == uuid.Nil) {
+		return errors.New("chat_id is required")
+	}
+	if rule.needBoardID && (e.BoardID == nil || *e.BoardID == uuid.Nil) {
+		return errors.New("board_id is required")
+	}
+	return nil
+}
+
+// Decode unmarshals the payload into v.
+func (e *Envelope) Decode(v interface{}) error {
+	if len(e.Payload) == 0 {
+		return errors.New("payload is required")
+	}
+	if err := json.Unmarshal(e.Payload, v); err != nil {
+		return errors.New("invalid payload")
+	}
+	return nil
+}
+
+// NewEnvelope builds an outbound envelope. chatID may be uuid.Nil for events
+// that are not scoped to a chat.
+func NewEnvelope(eventType, id string, chatID uuid.UUID, payload interface{}) (*Envelope, error) {
+	env := &Envelope{V: ProtocolVersion, Type: eventType, ID: id}
+	if chatID != uuid.Nil {
+		env.ChatID = &chatID
+	}
+	if payload != nil {
+		raw, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		env.Payload = raw
+	}
+	return env, nil
+}
+
+// NewBoardEnvelope builds an outbound envelope scoped to a board. rev is the
+// board revision the event produced, or the current one for acks.
+func NewBoardEnvelope(eventType, id string, boardID uuid.UUID, rev int64, payload interface{}) (*Envelope, error) {
+	env, err := NewEnvelope(eventType, id, uuid.Nil, payload)
+	if err != nil {
+		return nil, err
+	}
+	env.BoardID = &boardID
+	env.Rev = rev
+	return env, nil
+}
+
+// HandlerFunc processes a validated inbound envelope. A returned error is
+// reported to the sending socket as an error event echoing the envelope id.
+type HandlerFunc func(c *Client, env *Envelope) error
+
+var inboundHandlers = map[string]HandlerFunc{}
+
+// Handle registers the handler for an inbound event type. It must be called
+// before the server starts accepting connections.
+func Handle(eventType string, fn HandlerFunc) {
+	inboundHandlers[eventType] = fn
+}
+
+// PresenceFunc is notified when a user's first socket connects or last socket disconnects.
+type PresenceFunc func(userID uuid.UUID, online bool)
+
+var onPresence PresenceFunc
+
+// OnPresence registers the presence callback. It runs outside the hub loop.
+func OnPresence(fn PresenceFunc) {
+	onPresence = fn
+}
+
+func (c *Client) dispatch(raw []byte) {
+	var env Envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		c.ReplyError("", "invalid envelope")
+		return
+	}
+	if err := env.Validate(); err != nil {
+		c.ReplyError(env.ID, err.Error())
+		return
+	}
+	fn, ok := inboundHandlers[env.Type]
+	if !ok {
+		c.ReplyError(env.ID, fmt.Sprintf("unsupported event type %q", env.Type))
+		return
+	}
+	if err := fn(c, &env); err != nil {
+		c.ReplyError(env.ID, err.Error())
+	}
+}
+
+// Reply queues an envelope for this socket only.
+func (c *Client) Reply(env *Envelope) {
+	message, err := json.Marshal(env)
+	if err != nil {
+		return
+	}
+	c.Hub.deliver <- &delivery{client: c, message: message}
+}
+
+// ReplyError sends an error event to this socket, echoing the offending envelope id.
+func (c *Client) ReplyError(id, message string) {
+	env, _ := NewEnvelope(TypeError, id, uuid.Nil, map[string]string{"message": message})
+	c.Reply(env)
+}
+
+// Publish wraps payload in an envelope and sends it to every live socket of the given users.
+func Publish(userIDs []uuid.UUID, eventType string, chatID uuid.UUID, payload interface{}) {
+	env, err := NewEnvelope(eventType, "", chatID, payload)
+	if err != nil {
+		return
+	}
+	SendToUsers(userIDs, env)
+}
+
+// PublishBoard sends a board event to every socket subscribed to the board.
+func PublishBoard(boardID uuid.UUID, rev int64, eventType string, payload interface{}) {
+	env, err := NewBoardEnvelope(eventType, "", boardID, rev, payload)
+	if err != nil {
+		return
+	}
+	sendToBoard(boardID, env, false)
+}
+
+// CloseBoard sends a final event to the board's subscribers and drops
+// their subscriptions, e.g. when the board is deleted or its access rules
+// change.
+func CloseBoard(boardID uuid.UUID, eventType string, payload interface{}) {
+	env, err := NewBoardEnvelope(eventType, "", boardID, 0, payload)
+	if err != nil {
+		return
+	}
+	sendToBoard(boardID, env, true)
+}
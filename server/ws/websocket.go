@@ -1,43 +1,93 @@
 package ws
 
 import (
+	"encoding/json"
+	"errors"
 	"log"
+	"strings"
 	"sync"
+	"time"
+
+	"tether-server/utils"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// Time allowed to write a frame to the peer.
+	writeWait = 10 * time.Second
+	// Time allowed to read the next pong from the peer.
+	pongWait = 60 * time.Second
+	// Send pings with this period. Must be less than pongWait.
+	pingPeriod = (pongWait * 9) / 10
+	// Maximum inbound frame size.
+	maxMessageSize = 64 * 1024
+	// Maximum number of boards a single socket may subscribe to.
+	maxBoardSubscriptions = 50
 )
 
+// Client is a single authenticated socket. A user may hold several at once
+// (one per device or tab).
 type Client struct {
 	ID     string
-	UserID uint
+	UserID uuid.UUID
 	Conn   *websocket.Conn
 	Send   chan []byte
 	Hub    *Hub
+
+	// Boards this socket is subscribed to; guarded by Hub.mutex
+	boards map[uuid.UUID]bool
+}
+
+// delivery is a frame addressed to every live socket of the given users,
+// to the subscribers of boardID or, when client is set, to that single
+// socket. closeBoard drops the board's subscriptions after delivery.
+type delivery struct {
+	userIDs    []uuid.UUID
+	boardID    uuid.UUID
+	closeBoard bool
+	client     *Client
+	message    []byte
 }
 
 type Hub struct {
-	clients    map[*Client]bool
-	broadcast  chan []byte
+	clients    map[uuid.UUID]map[*Client]bool
+	boards     map[uuid.UUID]map[*Client]bool
+	deliver    chan *delivery
 	register   chan *Client
 	unregister chan *Client
 	mutex      sync.RWMutex
 }
 
 var hub = &Hub{
-	clients:    make(map[*Client]bool),
-	broadcast:  make(chan []byte),
+	clients:    make(map[uuid.UUID]map[*Client]bool),
+	boards:     make(map[uuid.UUID]map[*Client]bool),
+	deliver:    make(chan *delivery, 256),
 	register:   make(chan *Client),
 	unregister: make(chan *Client),
 }
 
+// WebSocketHandler authenticates the upgrade request with the same access
+// token used by the REST API and attaches the socket to the hub. Browsers
+// cannot set headers on a WebSocket handshake, so the token may also be
+// passed as the "token" query parameter.
 func WebSocketHandler() fiber.Handler {
-	return websocket.New(func(c *websocket.Conn) {
+	upgrade := websocket.New(func(c *websocket.Conn) {
+		userID, ok := c.Locals("user_id").(uuid.UUID)
+		if !ok {
+			c.Close()
+			return
+		}
+
 		client := &Client{
-			ID:   c.Query("user_id"),
-			Conn: c,
-			Send: make(chan []byte, 256),
-			Hub:  hub,
+			ID:     uuid.New().String(),
+			UserID: userID,
+			Conn:   c,
+			Send:   make(chan []byte, 256),
+			Hub:    hub,
+			boards: make(map[uuid.UUID]bool),
 		}
 
 		hub.register <- client
@@ -45,6 +95,41 @@ func WebSocketHandler() fiber.Handler {
 		go client.writePump()
 		client.readPump()
 	})
+
+	return func(c *fiber.Ctx) error {
+		if !websocket.IsWebSocketUpgrade(c) {
+			return fiber.ErrUpgradeRequired
+		}
+
+		tokenString := c.Query("token")
+		if tokenString == "" {
+			tokenString = strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+		}
+		if tokenString == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"error":   "Token required",
+			})
+		}
+
+		claims, err := utils.ValidateToken(tokenString)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid token",
+			})
+		}
+		userID, err := uuid.Parse(claims.UserID)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid token",
+			})
+		}
+
+		c.Locals("user_id", userID)
+		return upgrade(c)
+	}
 }
 
 func (c *Client) readPump() {
@@ -53,24 +138,35 @@ func (c *Client) readPump() {
 		c.Conn.Close()
 	}()
 
+	c.Conn.SetReadLimit(maxMessageSize)
+	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.Conn.SetPongHandler(func(string) error {
+		return c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
 	for {
 		_, message, err := c.Conn.ReadMessage()
 		if err != nil {
-			log.Printf("error: %v", err)
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("websocket read error: %v", err)
+			}
 			break
 		}
-		c.Hub.broadcast <- message
+		c.dispatch(message)
 	}
 }
 
 func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
 	defer func() {
+		ticker.Stop()
 		c.Conn.Close()
 	}()
 
 	for {
 		select {
 		case message, ok := <-c.Send:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
 				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
@@ -85,6 +181,12 @@ func (c *Client) writePump() {
 			if err := w.Close(); err != nil {
 				return
 			}
+
+		case <-ticker.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
 		}
 	}
 }
@@ -94,31 +196,163 @@ func (h *Hub) Run() {
 		select {
 		case client := <-h.register:
 			h.mutex.Lock()
-			h.clients[client] = true
+			first := len(h.clients[client.UserID]) == 0
+			if first {
+				h.clients[client.UserID] = make(map[*Client]bool)
+			}
+			h.clients[client.UserID][client] = true
 			h.mutex.Unlock()
+			if first {
+				notifyPresence(client.UserID, true)
+			}
 
 		case client := <-h.unregister:
 			h.mutex.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.Send)
-			}
+			h.remove(client)
 			h.mutex.Unlock()
 
-		case message := <-h.broadcast:
-			h.mutex.RLock()
-			for client := range h.clients {
-				select {
-				case client.Send <- message:
-				default:
-					close(client.Send)
-					delete(h.clients, client)
+		case d := <-h.deliver:
+			h.mutex.Lock()
+			if d.client != nil {
+				if h.clients[d.client.UserID][d.client] {
+					select {
+					case d.client.Send <- d.message:
+					default:
+						h.remove(d.client)
+					}
 				}
 			}
-			h.mutex.RUnlock()
+			for _, userID := range d.userIDs {
+				for client := range h.clients[userID] {
+					select {
+					case client.Send <- d.message:
+					default:
+						// Slow consumer: drop the socket rather than block the hub.
+						h.remove(client)
+					}
+				}
+			}
+			if d.boardID != uuid.Nil {
+				for client := range h.boards[d.boardID] {
+					select {
+					case client.Send <- d.message:
+					default:
+						h.remove(client)
+					}
+				}
+				if d.closeBoard {
+					for client := range h.boards[d.boardID] {
+						delete(client.boards, d.boardID)
+					}
+					delete(h.boards, d.boardID)
+				}
+			}
+			h.mutex.Unlock()
 		}
 	}
 }
+
+// remove detaches a client from the hub. Callers must hold h.mutex.
+func (h *Hub) remove(client *Client) {
+	sockets, ok := h.clients[client.UserID]
+	if !ok {
+		return
+	}
+	if _, ok := sockets[client]; !ok {
+		return
+	}
+	delete(sockets, client)
+	close(client.Send)
+	for boardID := range client.boards {
+		h.unsubscribe(client, boardID)
+	}
+	if len(sockets) == 0 {
+		delete(h.clients, client.UserID)
+		notifyPresence(client.UserID, false)
+	}
+}
+
+// unsubscribe removes a client from a board's subscribers. Callers must
+// hold h.mutex.
+func (h *Hub) unsubscribe(client *Client, boardID uuid.UUID) {
+	delete(client.boards, boardID)
+	delete(h.boards[boardID], client)
+	if len(h.boards[boardID]) == 0 {
+		delete(h.boards, boardID)
+	}
+}
+
+// Subscribe adds the socket to the board's subscribers. Access must have
+// been checked by the caller.
+func (c *Client) Subscribe(boardID uuid.UUID) error {
+	h := c.Hub
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if !h.clients[c.UserID][c] {
+		return errors.New("socket is closed")
+	}
+	if !c.boards[boardID] && len(c.boards) >= maxBoardSubscriptions {
+		return errors.New("too many board subscriptions")
+	}
+	if h.boards[boardID] == nil {
+		h.boards[boardID] = make(map[*Client]bool)
+	}
+	h.boards[boardID][c] = true
+	c.boards[boardID] = true
+	return nil
+}
+
+// Unsubscribe removes the socket from the board's subscribers.
+func (c *Client) Unsubscribe(boardID uuid.UUID) {
+	c.Hub.mutex.Lock()
+	c.Hub.unsubscribe(c, boardID)
+	c.Hub.mutex.Unlock()
+}
+
+// notifyPresence runs the presence callback without blocking the hub loop,
+// since the callback usually publishes events back through the hub.
+func notifyPresence(userID uuid.UUID, online bool) {
+	if onPresence != nil {
+		go onPresence(userID, online)
+	}
+}
+
+// IsOnline reports whether the user has at least one live socket.
+func (h *Hub) IsOnline(userID uuid.UUID) bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.clients[userID]) > 0
+}
+
+// Run starts the package-level hub. It blocks and is meant to be run in its own goroutine.
 func Run() {
-	// Пока WebSocket-хаб не используется, оставим пустым
+	hub.Run()
+}
+
+// IsOnline reports whether the user has at least one live socket on the package-level hub.
+func IsOnline(userID uuid.UUID) bool {
+	return hub.IsOnline(userID)
+}
+
+// SendToUsers marshals v as JSON and queues it for every live socket of the given users.
+func SendToUsers(userIDs []uuid.UUID, v interface{}) {
+	if len(userIDs) == 0 {
+		return
+	}
+	message, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("websocket: failed to marshal event: %v", err)
+		return
+	}
+	hub.deliver <- &delivery{userIDs: userIDs, message: message}
+}
+
+// sendToBoard marshals v as JSON and queues it for the board's subscribers.
+func sendToBoard(boardID uuid.UUID, v interface{}, closeBoard bool) {
+	message, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("websocket: failed to marshal event: %v", err)
+		return
+	}
+	hub.deliver <- &delivery{boardID: boardID, closeBoard: closeBoard, message: message}
 }